@@ -0,0 +1,198 @@
+// Package apperror defines the errors the API responds with. Handlers and middleware return them instead of
+// writing error responses, and Handler turns every error into the same JSON body: the message, a stable
+// machine-readable code, the offending fields of invalid requests and the ID of the request.
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Code identifies the kind of an error for clients, it never changes once published
+type Code string
+
+const (
+	CodeBadRequest           Code = "bad_request"       // The request breaks a rule
+	CodeValidation           Code = "validation_failed" // Fields of the request are invalid, see the details
+	CodeMalformedRequest     Code = "malformed_request" // The body of the request cannot be decoded
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeConflict             Code = "conflict"
+	CodePreconditionFailed   Code = "precondition_failed"   // The resource changed since it was fetched, fetch it again
+	CodePreconditionRequired Code = "precondition_required" // The request must carry If-Match
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeTooManyRequests      Code = "too_many_requests"
+	CodeInternal             Code = "internal_error"
+	CodeUnavailable          Code = "service_unavailable"
+
+	// Clients act on these to recover
+	CodeTokenRevoked  Code = "token_revoked"  // Sign in again
+	CodeTokenOutdated Code = "token_outdated" // Refresh the token to pick up the current roles
+	CodeSessionFull   Code = "session_full"
+)
+
+// statusCodes are the codes of errors not created by this package, e.g. the ones of Echo
+var statusCodes = map[int]Code{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusPreconditionRequired:  CodePreconditionRequired,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusTooManyRequests:       CodeTooManyRequests,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// FieldError tells what is wrong with a field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a failure responded with its status, its message is shown to the user
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Fields  []FieldError
+	Err     error // The underlying error, logged but never responded
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Invalid is a validation error of a single field
+func Invalid(field string, message string) *Error {
+	return Validation(message, FieldError{Field: field, Message: message})
+}
+
+// Validation is a validation error of fields, message sums them up
+func Validation(message string, fields ...FieldError) *Error {
+	err := New(http.StatusBadRequest, CodeValidation, message)
+	err.Fields = fields
+	return err
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+func PreconditionFailed(message string) *Error {
+	return New(http.StatusPreconditionFailed, CodePreconditionFailed, message)
+}
+
+func PreconditionRequired(message string) *Error {
+	return New(http.StatusPreconditionRequired, CodePreconditionRequired, message)
+}
+
+// Internal is a failure of the server, err is logged while only message is responded
+func Internal(message string, err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message, Err: err}
+}
+
+// Wrap keeps errors of this package as they are, other errors become internal errors with message
+func Wrap(err error, message string) error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return Internal(message, err)
+}
+
+// Bind is the error of a request body that could not be bound, naming the field of the wrong type if any.
+// The error of the decoder is not responded as it exposes the Go types.
+func Bind(err error) *Error {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Code == http.StatusUnsupportedMediaType {
+		return &Error{Status: httpErr.Code, Code: CodeUnsupportedMediaType, Message: "Unsupported content type", Err: err}
+	}
+
+	appErr := &Error{Status: http.StatusBadRequest, Code: CodeMalformedRequest, Message: "Invalid request body", Err: err}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && len(typeErr.Field) > 0 {
+		appErr.Fields = []FieldError{{Field: typeErr.Field, Message: "Invalid type, expected " + jsonType(typeErr.Type.Kind().String())}}
+	}
+	return appErr
+}
+
+// jsonType names a Go kind the way JSON does
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "map", kind == "struct":
+		return "object"
+	default:
+		return kind
+	}
+}
+
+// From turns any error into an Error. Echo errors keep their status and message, other errors are internal.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		code, ok := statusCodes[httpErr.Code]
+		if !ok {
+			code = CodeInternal
+			if httpErr.Code < http.StatusInternalServerError {
+				code = CodeBadRequest
+			}
+		}
+
+		message, ok := httpErr.Message.(string)
+		if !ok || httpErr.Code >= http.StatusInternalServerError {
+			message = http.StatusText(httpErr.Code)
+		}
+		return &Error{Status: httpErr.Code, Code: code, Message: message, Err: err}
+	}
+
+	return Internal("Internal server error", err)
+}
@@ -0,0 +1,95 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+)
+
+// serve responds to a request with the error returned by handler
+func serve(t *testing.T, handler echo.HandlerFunc, body string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+
+	e := echo.New()
+	e.HTTPErrorHandler = Handler
+	e.Use(echomiddleware.RequestID())
+	e.POST("/", handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %s: %v", rec.Body, err)
+	}
+	if len(response.RequestID) == 0 || response.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+		t.Errorf("expected the request ID %q, got %q", rec.Header().Get(echo.HeaderXRequestID), response.RequestID)
+	}
+	return rec, response
+}
+
+func TestHandler(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		err     error
+		status  int
+		code    Code
+		message string
+	}{
+		{"application error", NotFound("Session not found"), http.StatusNotFound, CodeNotFound, "Session not found"},
+		{"specific code", New(http.StatusBadRequest, CodeSessionFull, "Session is full"), http.StatusBadRequest, CodeSessionFull, "Session is full"},
+		{"wrapped application error", Wrap(Forbidden("Admin access required"), "Failed"), http.StatusForbidden, CodeForbidden, "Admin access required"},
+		{"internal error hides the cause", Internal("Failed to fetch sessions", errors.New("connection refused")), http.StatusInternalServerError, CodeInternal, "Failed to fetch sessions"},
+		{"wrapped error", Wrap(errors.New("connection refused"), "Failed to fetch sessions"), http.StatusInternalServerError, CodeInternal, "Failed to fetch sessions"},
+		{"echo error", echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt"), http.StatusUnauthorized, CodeUnauthorized, "invalid or expired jwt"},
+		{"echo server error", echo.NewHTTPError(http.StatusServiceUnavailable, "database is down"), http.StatusServiceUnavailable, CodeUnavailable, "Service Unavailable"},
+		{"other error", errors.New("connection refused"), http.StatusInternalServerError, CodeInternal, "Internal server error"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec, response := serve(t, func(c echo.Context) error { return test.err }, "")
+			if rec.Code != test.status || response.Code != test.code || response.Error != test.message {
+				t.Errorf("expected %d %s %q, got %d %s %q", test.status, test.code, test.message, rec.Code, response.Code, response.Error)
+			}
+		})
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	bind := func(c echo.Context) error {
+		var request struct {
+			Slot int `json:"slot"`
+		}
+		if err := c.Bind(&request); err != nil {
+			return Bind(err)
+		}
+		return c.NoContent(http.StatusOK)
+	}
+
+	rec, response := serve(t, bind, `{"slot": "two"}`)
+	if rec.Code != http.StatusBadRequest || response.Code != CodeMalformedRequest {
+		t.Fatalf("expected 400 %s, got %d %s", CodeMalformedRequest, rec.Code, response.Code)
+	}
+	if len(response.Details) != 1 || response.Details[0].Field != "slot" || response.Details[0].Message != "Invalid type, expected number" {
+		t.Errorf("expected the slot to be reported, got %+v", response.Details)
+	}
+
+	rec, response = serve(t, bind, `{"slot":`)
+	if rec.Code != http.StatusBadRequest || response.Error != "Invalid request body" || len(response.Details) != 0 {
+		t.Errorf("expected a malformed body, got %d %+v", rec.Code, response)
+	}
+}
+
+func TestInvalidField(t *testing.T) {
+	_, response := serve(t, func(c echo.Context) error { return Invalid("group_id", "Invalid group ID") }, "")
+	if response.Code != CodeValidation || len(response.Details) != 1 || response.Details[0] != (FieldError{Field: "group_id", Message: "Invalid group ID"}) {
+		t.Errorf("expected a validation error of the group ID, got %+v", response)
+	}
+}
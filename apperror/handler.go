@@ -0,0 +1,49 @@
+package apperror
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Response is the body of every error response
+type Response struct {
+	Error     string       `json:"error"`
+	Code      Code         `json:"code"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// Handler is the HTTPErrorHandler of Echo, responding to the errors returned by handlers and middleware
+func Handler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	appErr := From(err)
+	if appErr.Status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(appErr.Status)
+	} else {
+		err = c.JSON(appErr.Status, Response{
+			Error:     appErr.Message,
+			Code:      appErr.Code,
+			Details:   appErr.Fields,
+			RequestID: requestID(c),
+		})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// requestID is the ID given to the request by the RequestID middleware, or by the client
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); len(id) > 0 {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
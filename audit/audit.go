@@ -0,0 +1,93 @@
+// Package audit describes the changes made by a request, so they can be written to the audit log once the request succeeded.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/labstack/echo/v4"
+)
+
+// contextKey is the echo context key of the entry of a request
+const contextKey = "audit_entry"
+
+// Types of the audited resources
+const (
+	ResourceSession      = "session"
+	ResourceGroup        = "group"
+	ResourceAnnouncement = "announcement"
+	ResourceCourt        = "court"
+	ResourceUser         = "user"
+	ResourceRole         = "role"
+	ResourceAPIKey       = "api-key"
+)
+
+// Entry describes the change made by a request
+type Entry struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Changes      map[string]models.AuditChange
+}
+
+// Record describes the change made by the request. before and after are snapshots of the resource, usually its response DTO,
+// nil when the resource was created or deleted. Only the fields that differ are kept.
+func Record(c echo.Context, action string, resourceType string, resourceID string, before interface{}, after interface{}) {
+	entry := &Entry{Action: action, ResourceType: resourceType, ResourceID: resourceID}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		c.Logger().Errorf("audit %s of %s %s: %v", action, resourceType, resourceID, err)
+	}
+	entry.Changes = changes
+
+	c.Set(contextKey, entry)
+}
+
+// FromContext returns the entry recorded by the request, if any
+func FromContext(c echo.Context) (*Entry, bool) {
+	entry, ok := c.Get(contextKey).(*Entry)
+	return entry, ok
+}
+
+// Diff compares the JSON fields of two snapshots and returns the fields that differ
+func Diff(before interface{}, after interface{}) (map[string]models.AuditChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.AuditChange)
+	for name, value := range beforeFields {
+		if !bytes.Equal(value, afterFields[name]) {
+			changes[name] = models.AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = models.AuditChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func jsonFields(snapshot interface{}) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if snapshot == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+const (
+	// APIKeyPrefix marks personal API keys, so they can be told apart from JWTs and found by secret scanners
+	APIKeyPrefix = "bmk_"
+
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+)
+
+// GenerateAPIKey returns a random API key, the prefix shown to tell keys apart and the hash stored in place of the key
+func GenerateAPIKey() (key string, prefix string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyDisplayLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes an API key for lookup, API keys are never stored in plain text
+func HashAPIKey(key string) string {
+	return hashToken(key)
+}
+
+// IsAPIKey checks if a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
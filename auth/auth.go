@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"time"
 
 	"github.com/alanrb/badminton/backend/models"
@@ -18,33 +22,115 @@ func (c *Context) AuthUser() *models.AuthUser {
 	return c.user
 }
 
+// SetAuthUser sets the authenticated user, which is also kept in the underlying echo context for the request log
 func (c *Context) SetAuthUser(u *models.AuthUser) {
 	c.user = u
+	c.Context.Set(AuthUserKey, u)
 }
 
 type JwtAccessPayload struct {
 	jwt.RegisteredClaims
-	Role   string `json:"role,omitempty"`
-	Source string `json:"source,omitempty"`
+	Role   string       `json:"role,omitempty"`
+	Source string       `json:"source,omitempty"`
+	Act    *ActorClaims `json:"act,omitempty"` // Set when an admin impersonates the subject
+
+	PermissionVersion int `json:"pv,omitempty"` // Permission version of the subject when the token was issued
+}
+
+// ActorClaims identify who acts on behalf of the subject of a token, as in RFC 8693
+type ActorClaims struct {
+	Subject string `json:"sub"`
 }
 
 const (
 	UserSourceCognito = "cognito"
 	UserSourceInit    = "badminton"
+	UserSourceAPIKey  = "api_key"
+
+	AccessTokenTTL   = 15 * time.Minute
+	RefreshTokenTTL  = 30 * 24 * time.Hour
+	LoginCodeTTL     = time.Minute
+	ImpersonationTTL = 30 * time.Minute
+
+	// AuthUserKey is the echo context key of the authenticated user
+	AuthUserKey = "auth_user"
+	// IdentityKey is the echo context key of the identity asserted by the token of an identity provider, e.g. Cognito
+	IdentityKey = "identity"
 )
 
 func GenerateJWTToken(user models.User, jwtSecret interface{}) (string, error) {
+	return GenerateJWTTokenWithID(user, jwtSecret, uuid.NewString())
+}
+
+// GenerateJWTTokenWithID issues an access token with the given jti, so it can be tracked for revocation.
+// The roles of the user must be loaded, the token carries the primary one.
+func GenerateJWTTokenWithID(user models.User, jwtSecret interface{}, jti string) (string, error) {
 	claims := JwtAccessPayload{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        uuid.NewString(),
+			ID:        jti,
 			Issuer:    UserSourceInit,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			Subject:   user.ID,
 		},
-		Role:   user.Role,
-		Source: UserSourceInit,
+		Role:              user.PrimaryRole(),
+		Source:            UserSourceInit,
+		PermissionVersion: user.PermissionVersion,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
 }
+
+// GenerateImpersonationToken issues a short-lived access token acting as the user on behalf of an admin.
+// The admin is kept in the act claim, so every request made with the token can be traced back to them.
+func GenerateImpersonationToken(user models.User, adminID string, jwtSecret interface{}, jti string, expiresAt time.Time) (string, error) {
+	claims := JwtAccessPayload{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    UserSourceInit,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Subject:   user.ID,
+		},
+		Role:              user.PrimaryRole(),
+		Source:            UserSourceInit,
+		Act:               &ActorClaims{Subject: adminID},
+		PermissionVersion: user.PermissionVersion,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+// GenerateRefreshToken returns a random refresh token and the hash stored in place of it
+func GenerateRefreshToken() (string, string, error) {
+	return generateToken()
+}
+
+// HashRefreshToken hashes a refresh token for lookup, refresh tokens are never stored in plain text
+func HashRefreshToken(token string) string {
+	return hashToken(token)
+}
+
+// GenerateLoginCode returns a random login code and the hash stored in place of it
+func GenerateLoginCode() (string, string, error) {
+	return generateToken()
+}
+
+// HashLoginCode hashes a login code for lookup, login codes are never stored in plain text
+func HashLoginCode(code string) string {
+	return hashToken(code)
+}
+
+func generateToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
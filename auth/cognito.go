@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	CognitoTokenUseID     = "id"
+	CognitoTokenUseAccess = "access"
+)
+
+var ErrInvalidCognitoToken = errors.New("invalid cognito token")
+
+// CognitoVerifier verifies tokens issued by an AWS Cognito user pool against the pool's JWKS
+type CognitoVerifier struct {
+	issuer    string
+	clientIDs []string
+	jwks      *JWKS
+}
+
+// NewCognitoVerifier creates a verifier for the user pool issuer, accepting tokens issued to the given app clients
+func NewCognitoVerifier(issuer string, clientIDs []string) *CognitoVerifier {
+	issuer = strings.TrimSuffix(issuer, "/")
+	return &CognitoVerifier{
+		issuer:    issuer,
+		clientIDs: clientIDs,
+		jwks:      NewJWKS(issuer + "/.well-known/jwks.json"),
+	}
+}
+
+// Verify checks the signature, issuer, expiry, token use and audience of a token and returns its claims.
+// ID tokens carry the app client in aud, access tokens in client_id.
+func (v *CognitoVerifier) Verify(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.jwks.Keyfunc(ctx),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidCognitoToken, err)
+	}
+
+	tokenUse, _ := claims["token_use"].(string)
+	switch tokenUse {
+	case CognitoTokenUseID:
+		audience, err := claims.GetAudience()
+		if err != nil || !slices.ContainsFunc(audience, v.acceptsClient) {
+			return nil, errors.Join(ErrInvalidCognitoToken, errors.New("invalid audience"))
+		}
+	case CognitoTokenUseAccess:
+		clientID, _ := claims["client_id"].(string)
+		if !v.acceptsClient(clientID) {
+			return nil, errors.Join(ErrInvalidCognitoToken, errors.New("invalid client_id"))
+		}
+	default:
+		return nil, errors.Join(ErrInvalidCognitoToken, errors.New("invalid token_use"))
+	}
+
+	if sub, _ := claims["sub"].(string); len(sub) == 0 {
+		return nil, errors.Join(ErrInvalidCognitoToken, errors.New("missing subject"))
+	}
+
+	return claims, nil
+}
+
+func (v *CognitoVerifier) acceptsClient(clientID string) bool {
+	return len(clientID) > 0 && slices.Contains(v.clientIDs, clientID)
+}
+
+// CognitoAuthUser maps verified Cognito claims to the authenticated user.
+// The first Cognito group is used as the role, users without groups are players.
+func CognitoAuthUser(claims jwt.MapClaims) *models.AuthUser {
+	role := models.UserRolePlayer
+	if groups, ok := claims["cognito:groups"].([]interface{}); ok && len(groups) > 0 {
+		if group, ok := groups[0].(string); ok && len(group) > 0 {
+			role = group
+		}
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &models.AuthUser{
+		ID:     sub,
+		Role:   role,
+		Source: UserSourceCognito,
+	}
+}
+
+// CognitoIdentity is the identity asserted by verified Cognito claims. Only ID tokens carry the email.
+func CognitoIdentity(claims jwt.MapClaims) *Identity {
+	identity := claimsIdentity(claims)
+	identity.Provider = UserSourceCognito
+	return identity
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "test-client"
+
+// testIssuer stands in for a Cognito user pool, serving its JWKS from a local server
+type testIssuer struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	kid     string
+	fetches atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	issuer := &testIssuer{key: key, kid: "test-kid"}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		issuer.fetches.Add(1)
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": issuer.kid,
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (i *testIssuer) claims(tokenUse string) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":       "a6d2a7d4-3b0e-4a57-9b9b-3d1f0e6f1c11",
+		"iss":       i.server.URL,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"iat":       time.Now().Unix(),
+		"token_use": tokenUse,
+	}
+	if tokenUse == CognitoTokenUseID {
+		claims["aud"] = testClientID
+	} else {
+		claims["client_id"] = testClientID
+	}
+	return claims
+}
+
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = i.kid
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestCognitoVerifierAcceptsValidTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier := NewCognitoVerifier(issuer.server.URL, []string{testClientID})
+
+	for _, tokenUse := range []string{CognitoTokenUseID, CognitoTokenUseAccess} {
+		t.Run(tokenUse, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), issuer.sign(t, issuer.claims(tokenUse)))
+			if err != nil {
+				t.Fatalf("expected token to be valid, got %v", err)
+			}
+			if claims["sub"] != "a6d2a7d4-3b0e-4a57-9b9b-3d1f0e6f1c11" {
+				t.Errorf("unexpected subject %v", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestCognitoVerifierRejectsInvalidTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier := NewCognitoVerifier(issuer.server.URL, []string{testClientID})
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"expired", func() string {
+			claims := issuer.claims(CognitoTokenUseID)
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			return issuer.sign(t, claims)
+		}},
+		{"missing expiry", func() string {
+			claims := issuer.claims(CognitoTokenUseID)
+			delete(claims, "exp")
+			return issuer.sign(t, claims)
+		}},
+		{"wrong issuer", func() string {
+			claims := issuer.claims(CognitoTokenUseID)
+			claims["iss"] = "https://cognito-idp.example.com/other-pool"
+			return issuer.sign(t, claims)
+		}},
+		{"wrong audience", func() string {
+			claims := issuer.claims(CognitoTokenUseID)
+			claims["aud"] = "other-client"
+			return issuer.sign(t, claims)
+		}},
+		{"wrong client_id", func() string {
+			claims := issuer.claims(CognitoTokenUseAccess)
+			claims["client_id"] = "other-client"
+			return issuer.sign(t, claims)
+		}},
+		{"access token without client_id", func() string {
+			claims := issuer.claims(CognitoTokenUseAccess)
+			delete(claims, "client_id")
+			claims["aud"] = testClientID
+			return issuer.sign(t, claims)
+		}},
+		{"wrong token_use", func() string {
+			claims := issuer.claims(CognitoTokenUseID)
+			claims["token_use"] = "refresh"
+			return issuer.sign(t, claims)
+		}},
+		{"missing subject", func() string {
+			claims := issuer.claims(CognitoTokenUseID)
+			delete(claims, "sub")
+			return issuer.sign(t, claims)
+		}},
+		{"signed by another key", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims(CognitoTokenUseID))
+			token.Header["kid"] = issuer.kid
+			signed, _ := token.SignedString(otherKey)
+			return signed
+		}},
+		{"unknown kid", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims(CognitoTokenUseID))
+			token.Header["kid"] = "other-kid"
+			signed, _ := token.SignedString(issuer.key)
+			return signed
+		}},
+		{"symmetric algorithm", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.claims(CognitoTokenUseID))
+			token.Header["kid"] = issuer.kid
+			signed, _ := token.SignedString([]byte("secret"))
+			return signed
+		}},
+		{"unsigned", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, issuer.claims(CognitoTokenUseID))
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}},
+		{"malformed", func() string {
+			return "not-a-token"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tt.token())
+			if !errors.Is(err, ErrInvalidCognitoToken) {
+				t.Fatalf("expected ErrInvalidCognitoToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJWKSCachesKeys(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier := NewCognitoVerifier(issuer.server.URL, []string{testClientID})
+
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(context.Background(), issuer.sign(t, issuer.claims(CognitoTokenUseID))); err != nil {
+			t.Fatalf("expected token to be valid, got %v", err)
+		}
+	}
+
+	// Unknown keys within the refresh interval are not fetched again
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims(CognitoTokenUseID))
+	token.Header["kid"] = "rotated-kid"
+	signed, _ := token.SignedString(issuer.key)
+	if _, err := verifier.Verify(context.Background(), signed); err == nil {
+		t.Fatal("expected unknown key to be rejected")
+	}
+
+	if fetches := issuer.fetches.Load(); fetches != 1 {
+		t.Errorf("expected JWKS to be fetched once, got %d", fetches)
+	}
+}
+
+func TestJWKSThrottlesFailedFetches(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	jwks := NewJWKS(server.URL)
+	if _, err := jwks.Key(context.Background(), "test-kid"); err == nil {
+		t.Fatal("expected the failed fetch to be reported")
+	}
+
+	// The issuer is not fetched again within the refresh interval while it is down
+	for i := 0; i < 3; i++ {
+		if _, err := jwks.Key(context.Background(), "test-kid"); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("expected the unknown key error, got %v", err)
+		}
+	}
+	if fetches := fetches.Load(); fetches != 1 {
+		t.Errorf("expected JWKS to be fetched once, got %d", fetches)
+	}
+}
+
+func TestCognitoAuthUser(t *testing.T) {
+	user := CognitoAuthUser(jwt.MapClaims{"sub": "user-1"})
+	if user.ID != "user-1" || user.Role != models.UserRolePlayer || user.Source != UserSourceCognito {
+		t.Errorf("unexpected user without groups: %+v", user)
+	}
+
+	user = CognitoAuthUser(jwt.MapClaims{"sub": "user-1", "cognito:groups": []interface{}{models.UserRoleAdmin}})
+	if user.Role != models.UserRoleAdmin {
+		t.Errorf("expected admin role from cognito groups, got %s", user.Role)
+	}
+
+	user = CognitoAuthUser(jwt.MapClaims{"sub": "user-1", "cognito:groups": "not-a-list"})
+	if user.Role != models.UserRolePlayer {
+		t.Errorf("expected player role for malformed groups, got %s", user.Role)
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+)
+
+const (
+	OAuthStateCookie = "oauth_state"
+	OAuthStateTTL    = 10 * time.Minute
+
+	// oauthStateAudience tells state tokens apart from the other tokens issued by the server
+	oauthStateAudience = "oauth_state"
+)
+
+var ErrInvalidOAuthState = errors.New("invalid oauth state")
+
+// OAuthState is kept in a signed cookie between the login redirect and the provider callback,
+// so the login flow works across Lambda instances without server-side storage
+type OAuthState struct {
+	jwt.RegisteredClaims
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+	ReturnTo string `json:"return_to,omitempty"`
+}
+
+// NewOAuthState creates a random state and PKCE verifier for a login attempt with a provider
+func NewOAuthState(provider string, returnTo string) (*OAuthState, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &OAuthState{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    UserSourceInit,
+			Audience:  jwt.ClaimStrings{oauthStateAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(OAuthStateTTL)),
+		},
+		Provider: provider,
+		State:    base64.RawURLEncoding.EncodeToString(b),
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: SafeReturnPath(returnTo),
+	}, nil
+}
+
+// SetOAuthStateCookie signs the state and stores it in a short-lived cookie
+func SetOAuthStateCookie(c echo.Context, state *OAuthState, jwtSecret interface{}) error {
+	key, err := oauthStateKey(jwtSecret)
+	if err != nil {
+		return err
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, state).SignedString(key)
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     OAuthStateCookie,
+		Value:    signed,
+		Path:     "/auth",
+		MaxAge:   int(OAuthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// VerifyOAuthState reads the state cookie, checks its signature and expiry and that it matches
+// the state returned by the provider, and that the login was started with the same provider.
+// The cookie is cleared so a state can only be used once.
+func VerifyOAuthState(c echo.Context, provider string, jwtSecret interface{}) (*OAuthState, error) {
+	cookie, err := c.Cookie(OAuthStateCookie)
+	if err != nil {
+		return nil, ErrInvalidOAuthState
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     OAuthStateCookie,
+		Path:     "/auth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	key, err := oauthStateKey(jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &OAuthState{}
+	_, err = jwt.ParseWithClaims(cookie.Value, state, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(UserSourceInit),
+		jwt.WithAudience(oauthStateAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, ErrInvalidOAuthState
+	}
+
+	returned := c.QueryParam("state")
+	if len(returned) == 0 || subtle.ConstantTimeCompare([]byte(returned), []byte(state.State)) != 1 {
+		return nil, ErrInvalidOAuthState
+	}
+
+	if state.Provider != provider {
+		return nil, ErrInvalidOAuthState
+	}
+
+	return state, nil
+}
+
+// oauthStateKey derives the key state tokens are signed with from the JWT secret, so a state token and an access
+// token can never be used in place of each other
+func oauthStateKey(jwtSecret interface{}) ([]byte, error) {
+	secret, ok := jwtSecret.([]byte)
+	if !ok {
+		return nil, errors.New("the oauth state needs a []byte secret")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("oauth-state"))
+	return mac.Sum(nil), nil
+}
+
+// SafeReturnPath only accepts paths relative to the frontend, so the login cannot be used as an open redirect
+func SafeReturnPath(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.Contains(returnTo, "\\") {
+		return ""
+	}
+
+	u, err := url.Parse(returnTo)
+	if err != nil || u.IsAbs() || len(u.Host) > 0 {
+		return ""
+	}
+	return returnTo
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var testStateSecret = []byte("test-secret")
+
+// stateCookie starts a login with a provider and returns the state and the cookie it was stored in
+func stateCookie(t *testing.T, provider string, returnTo string) (*OAuthState, *http.Cookie) {
+	t.Helper()
+
+	state, err := NewOAuthState(provider, returnTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/auth/"+provider+"/login", nil), rec)
+	if err := SetOAuthStateCookie(c, state, testStateSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == OAuthStateCookie {
+			return state, cookie
+		}
+	}
+	t.Fatal("expected the state cookie to be set")
+	return nil, nil
+}
+
+// verifyState verifies the state of a callback with the cookie, which is not sent when nil
+func verifyState(cookie *http.Cookie, provider string, returned string) (*OAuthState, error) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/"+provider+"/callback?state="+returned, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return VerifyOAuthState(echo.New().NewContext(req, httptest.NewRecorder()), provider, testStateSecret)
+}
+
+// tampered changes a claim of a signed token without signing it again
+func tampered(t *testing.T, token string, claim string, value interface{}) string {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	claims[claim] = value
+	if payload, err = json.Marshal(claims); err != nil {
+		t.Fatal(err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	return strings.Join(parts, ".")
+}
+
+func TestSafeReturnPath(t *testing.T) {
+	tests := []struct {
+		returnTo string
+		expected string
+	}{
+		{"/sessions/42", "/sessions/42"},
+		{"/groups?page=2#members", "/groups?page=2#members"},
+		{"", ""},
+		{"sessions/42", ""},
+		{"https://evil.example.com/login", ""},
+		{"//evil.example.com/login", ""},
+		{"/\\evil.example.com", ""},
+		{"javascript:alert(1)", ""},
+		{"/%zz", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.returnTo, func(t *testing.T) {
+			if got := SafeReturnPath(tt.returnTo); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestOAuthStateRoundTrip(t *testing.T) {
+	state, cookie := stateCookie(t, "google", "/sessions/42")
+	if !cookie.HttpOnly || cookie.Path != "/auth" || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("expected an HttpOnly lax cookie for /auth, got %+v", cookie)
+	}
+
+	verified, err := verifyState(cookie, "google", state.State)
+	if err != nil {
+		t.Fatalf("expected the state to be valid, got %v", err)
+	}
+	if verified.Verifier != state.Verifier || verified.ReturnTo != "/sessions/42" {
+		t.Errorf("expected the PKCE verifier and return path of the login, got %+v", verified)
+	}
+
+	state, cookie = stateCookie(t, "google", "https://evil.example.com")
+	if verified, err := verifyState(cookie, "google", state.State); err != nil || len(verified.ReturnTo) > 0 {
+		t.Errorf("expected unsafe return paths to be dropped, got %+v, %v", verified, err)
+	}
+}
+
+func TestOAuthStateRejectsInvalidCallbacks(t *testing.T) {
+	state, cookie := stateCookie(t, "google", "")
+
+	signed := func(claims jwt.Claims, key interface{}) *http.Cookie {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Cookie{Name: OAuthStateCookie, Value: token}
+	}
+	expired := *state
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	stateKey, err := oauthStateKey(testStateSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := GenerateJWTToken(models.User{BaseModel: models.BaseModel{ID: "user-1"}}, testStateSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cookie   *http.Cookie
+		provider string
+		returned string
+	}{
+		{"missing cookie", nil, "google", state.State},
+		{"missing state", cookie, "google", ""},
+		{"other state", cookie, "google", "other-state"},
+		{"other provider", cookie, "microsoft", state.State},
+		{"expired", signed(&expired, stateKey), "google", state.State},
+		{"other verifier", &http.Cookie{Name: OAuthStateCookie, Value: tampered(t, cookie.Value, "verifier", "attacker-verifier")}, "google", state.State},
+		{"other return path", &http.Cookie{Name: OAuthStateCookie, Value: tampered(t, cookie.Value, "return_to", "/admin")}, "google", state.State},
+		{"signed with the JWT secret", signed(state, testStateSecret), "google", state.State},
+		{"access token", &http.Cookie{Name: OAuthStateCookie, Value: accessToken}, "google", state.State},
+		{"malformed", &http.Cookie{Name: OAuthStateCookie, Value: "not-a-token"}, "google", state.State},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifyState(tt.cookie, tt.provider, tt.returned); !errors.Is(err, ErrInvalidOAuthState) {
+				t.Fatalf("expected ErrInvalidOAuthState, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const GoogleIssuer = "https://accounts.google.com"
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// OIDCConfig configures an OpenID Connect provider
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCProvider logs users in with any OpenID Connect provider, e.g. Google, Microsoft or Keycloak.
+// The provider metadata is discovered from the issuer on first use.
+type OIDCProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	oauth2      *oauth2.Config
+	userInfoURL string
+	jwks        *JWKS
+}
+
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state string, verifier string) (string, error) {
+	cfg, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return cfg.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, verifier string) (*Identity, error) {
+	cfg, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || len(rawIDToken) == 0 {
+		return nil, errors.Join(ErrInvalidIDToken, errors.New("missing id_token"))
+	}
+
+	claims, err := p.verifyIDToken(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := claimsIdentity(claims)
+	identity.Provider = p.config.Name
+
+	// Some providers only return the profile from the userinfo endpoint
+	if len(identity.Email) == 0 && len(p.userInfoURL) > 0 {
+		if err := p.fetchUserInfo(ctx, cfg, token, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	return identity, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience and expiry of an ID token
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, p.jwks.Keyfunc(ctx),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidIDToken, err)
+	}
+
+	if sub, _ := claims["sub"].(string); len(sub) == 0 {
+		return nil, errors.Join(ErrInvalidIDToken, errors.New("missing subject"))
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) fetchUserInfo(ctx context.Context, cfg *oauth2.Config, token *oauth2.Token, identity *Identity) error {
+	resp, err := cfg.Client(ctx, token).Get(p.userInfoURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch user info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch user info: status %d", resp.StatusCode)
+	}
+
+	claims := jwt.MapClaims{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return fmt.Errorf("failed to decode user info: %w", err)
+	}
+
+	// The userinfo response must describe the user of the ID token
+	info := claimsIdentity(claims)
+	if info.Subject != identity.Subject {
+		return errors.New("user info subject does not match the id token")
+	}
+
+	identity.Email = info.Email
+	identity.EmailVerified = info.EmailVerified
+	if len(identity.Name) == 0 {
+		identity.Name = info.Name
+	}
+	if len(identity.Picture) == 0 {
+		identity.Picture = info.Picture
+	}
+	return nil
+}
+
+// discover fetches the provider metadata from the issuer's discovery document.
+// Failures are not cached, so a provider that was briefly unavailable is retried on the next login.
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover %s: status %d", p.config.Name, resp.StatusCode)
+	}
+
+	var metadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document of %s: %w", p.config.Name, err)
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("issuer of %s does not match: %s", p.config.Name, metadata.Issuer)
+	}
+
+	p.userInfoURL = metadata.UserInfoEndpoint
+	p.jwks = NewJWKS(metadata.JWKSURI)
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  metadata.AuthorizationEndpoint,
+			TokenURL: metadata.TokenEndpoint,
+		},
+	}
+	return p.oauth2, nil
+}
+
+// claimsIdentity reads the standard OpenID Connect claims
+func claimsIdentity(claims jwt.MapClaims) *Identity {
+	identity := &Identity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.Picture, _ = claims["picture"].(string)
+
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	return identity
+}
+
+// IdentityProvidersFromEnv configures the identity providers listed in OIDC_PROVIDERS. Each provider NAME reads
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET, and optionally OIDC_<NAME>_SCOPES and
+// OIDC_<NAME>_REDIRECT_URL, which defaults to AUTH_BASE_URL/auth/<name>/callback.
+// GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET still configure Google when it is not listed.
+func IdentityProvidersFromEnv() (map[string]IdentityProvider, error) {
+	providers := make(map[string]IdentityProvider)
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) == 0 {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := OIDCConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if len(config.Issuer) == 0 || len(config.ClientID) == 0 {
+			return nil, fmt.Errorf("identity provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		if len(config.RedirectURL) == 0 {
+			config.RedirectURL = strings.TrimSuffix(os.Getenv("AUTH_BASE_URL"), "/") + "/auth/" + name + "/callback"
+		}
+		providers[name] = NewOIDCProvider(config)
+	}
+
+	if _, ok := providers["google"]; !ok && len(os.Getenv("GOOGLE_CLIENT_ID")) > 0 {
+		providers["google"] = NewOIDCProvider(OIDCConfig{
+			Name:         "google",
+			Issuer:       GoogleIssuer,
+			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("AUTH_REDIRECT_URL"),
+		})
+	}
+
+	return providers, nil
+}
+
+// ProviderNames lists the configured providers in a stable order
+func ProviderNames(providers map[string]IdentityProvider) []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testSubject     = "oidc-subject-1"
+	testCode        = "test-code"
+	testAccessToken = "test-access-token"
+)
+
+// testOIDCIssuer stands in for an OpenID Connect provider, serving its discovery document, token and userinfo
+// endpoints from a local server and its keys from a testIssuer
+type testOIDCIssuer struct {
+	*testIssuer
+	server *httptest.Server
+
+	discoveries   atomic.Int32
+	failDiscovery atomic.Bool
+	issuer        string                 // Issuer of the discovery document, the server URL when empty
+	idToken       string                 // ID token returned for testCode, omitted when empty
+	userInfo      map[string]interface{} // Userinfo response
+	verifier      string                 // code_verifier of the last token request
+}
+
+func newTestOIDCIssuer(t *testing.T) *testOIDCIssuer {
+	t.Helper()
+
+	issuer := &testOIDCIssuer{testIssuer: newTestIssuer(t)}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			issuer.discoveries.Add(1)
+			if issuer.failDiscovery.Load() {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			name := issuer.issuer
+			if len(name) == 0 {
+				name = issuer.server.URL
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 name,
+				"authorization_endpoint": issuer.server.URL + "/authorize",
+				"token_endpoint":         issuer.server.URL + "/token",
+				"userinfo_endpoint":      issuer.server.URL + "/userinfo",
+				"jwks_uri":               issuer.testIssuer.server.URL + "/.well-known/jwks.json",
+			})
+		case "/token":
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != testCode {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			issuer.verifier = r.PostForm.Get("code_verifier")
+
+			token := map[string]interface{}{
+				"access_token": testAccessToken,
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			}
+			if len(issuer.idToken) > 0 {
+				token["id_token"] = issuer.idToken
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(token)
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(issuer.userInfo)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (i *testOIDCIssuer) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "test",
+		Issuer:       i.server.URL + "/",
+		ClientID:     testClientID,
+		ClientSecret: "test-secret",
+		RedirectURL:  "https://api.example.com/auth/test/callback",
+	})
+}
+
+func (i *testOIDCIssuer) idTokenClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":            testSubject,
+		"iss":            i.server.URL,
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"email":          "player@example.com",
+		"email_verified": true,
+		"name":           "Player One",
+	}
+}
+
+func TestOIDCProviderDiscoversEndpoints(t *testing.T) {
+	issuer := newTestOIDCIssuer(t)
+	provider := issuer.provider()
+	verifier := oauth2.GenerateVerifier()
+
+	for i := 0; i < 2; i++ {
+		authURL, err := provider.AuthCodeURL(context.Background(), "test-state", verifier)
+		if err != nil {
+			t.Fatalf("expected the auth URL, got %v", err)
+		}
+
+		parsed, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatalf("invalid auth URL %s: %v", authURL, err)
+		}
+		if parsed.Scheme+"://"+parsed.Host+parsed.Path != issuer.server.URL+"/authorize" {
+			t.Errorf("expected the discovered authorization endpoint, got %s", authURL)
+		}
+
+		query := parsed.Query()
+		expected := map[string]string{
+			"client_id":             testClientID,
+			"redirect_uri":          "https://api.example.com/auth/test/callback",
+			"response_type":         "code",
+			"scope":                 "openid email profile",
+			"state":                 "test-state",
+			"code_challenge":        oauth2.S256ChallengeFromVerifier(verifier),
+			"code_challenge_method": "S256",
+		}
+		for name, value := range expected {
+			if query.Get(name) != value {
+				t.Errorf("expected %s %q, got %q", name, value, query.Get(name))
+			}
+		}
+	}
+
+	if discoveries := issuer.discoveries.Load(); discoveries != 1 {
+		t.Errorf("expected the provider to be discovered once, got %d", discoveries)
+	}
+}
+
+func TestOIDCProviderRetriesFailedDiscovery(t *testing.T) {
+	issuer := newTestOIDCIssuer(t)
+	provider := issuer.provider()
+
+	issuer.failDiscovery.Store(true)
+	if _, err := provider.AuthCodeURL(context.Background(), "test-state", oauth2.GenerateVerifier()); err == nil {
+		t.Fatal("expected the failed discovery to be reported")
+	}
+
+	// The failure is not cached, the next login discovers the provider again
+	issuer.failDiscovery.Store(false)
+	if _, err := provider.AuthCodeURL(context.Background(), "test-state", oauth2.GenerateVerifier()); err != nil {
+		t.Fatalf("expected the provider to be discovered, got %v", err)
+	}
+	if discoveries := issuer.discoveries.Load(); discoveries != 2 {
+		t.Errorf("expected the provider to be discovered twice, got %d", discoveries)
+	}
+}
+
+func TestOIDCProviderRejectsAnotherIssuer(t *testing.T) {
+	issuer := newTestOIDCIssuer(t)
+	issuer.issuer = "https://issuer.example.com"
+
+	if _, err := issuer.provider().AuthCodeURL(context.Background(), "test-state", oauth2.GenerateVerifier()); err == nil {
+		t.Fatal("expected a discovery document of another issuer to be rejected")
+	}
+}
+
+func TestOIDCProviderExchangesCodes(t *testing.T) {
+	issuer := newTestOIDCIssuer(t)
+	issuer.idToken = issuer.sign(t, issuer.idTokenClaims())
+	provider := issuer.provider()
+	verifier := oauth2.GenerateVerifier()
+
+	identity, err := provider.Exchange(context.Background(), testCode, verifier)
+	if err != nil {
+		t.Fatalf("expected the code to be exchanged, got %v", err)
+	}
+	expected := Identity{
+		Provider:      "test",
+		Subject:       testSubject,
+		Email:         "player@example.com",
+		EmailVerified: true,
+		Name:          "Player One",
+	}
+	if *identity != expected {
+		t.Errorf("expected %+v, got %+v", expected, *identity)
+	}
+	if issuer.verifier != verifier {
+		t.Errorf("expected the PKCE verifier to be sent, got %q", issuer.verifier)
+	}
+
+	if _, err := provider.Exchange(context.Background(), "other-code", verifier); err == nil {
+		t.Error("expected a rejected code to fail the exchange")
+	}
+}
+
+func TestOIDCProviderRejectsInvalidIDTokens(t *testing.T) {
+	issuer := newTestOIDCIssuer(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		idToken func() string
+	}{
+		{"missing id_token", func() string {
+			return ""
+		}},
+		{"expired", func() string {
+			claims := issuer.idTokenClaims()
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			return issuer.sign(t, claims)
+		}},
+		{"missing expiry", func() string {
+			claims := issuer.idTokenClaims()
+			delete(claims, "exp")
+			return issuer.sign(t, claims)
+		}},
+		{"wrong issuer", func() string {
+			claims := issuer.idTokenClaims()
+			claims["iss"] = "https://issuer.example.com"
+			return issuer.sign(t, claims)
+		}},
+		{"wrong audience", func() string {
+			claims := issuer.idTokenClaims()
+			claims["aud"] = "other-client"
+			return issuer.sign(t, claims)
+		}},
+		{"missing subject", func() string {
+			claims := issuer.idTokenClaims()
+			delete(claims, "sub")
+			return issuer.sign(t, claims)
+		}},
+		{"signed by another key", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.idTokenClaims())
+			token.Header["kid"] = issuer.kid
+			signed, _ := token.SignedString(otherKey)
+			return signed
+		}},
+		{"symmetric algorithm", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.idTokenClaims())
+			token.Header["kid"] = issuer.kid
+			signed, _ := token.SignedString([]byte("test-secret"))
+			return signed
+		}},
+		{"unsigned", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, issuer.idTokenClaims())
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer.idToken = tt.idToken()
+			_, err := issuer.provider().Exchange(context.Background(), testCode, oauth2.GenerateVerifier())
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderFetchesUserInfo(t *testing.T) {
+	issuer := newTestOIDCIssuer(t)
+	claims := issuer.idTokenClaims()
+	delete(claims, "email")
+	delete(claims, "email_verified")
+	delete(claims, "name")
+	issuer.idToken = issuer.sign(t, claims)
+
+	// email_verified as a string, as some providers send it
+	issuer.userInfo = map[string]interface{}{
+		"sub":            testSubject,
+		"email":          "player@example.com",
+		"email_verified": "true",
+		"name":           "Player One",
+		"picture":        "https://example.com/player.png",
+	}
+
+	identity, err := issuer.provider().Exchange(context.Background(), testCode, oauth2.GenerateVerifier())
+	if err != nil {
+		t.Fatalf("expected the code to be exchanged, got %v", err)
+	}
+	if identity.Email != "player@example.com" || !identity.EmailVerified {
+		t.Errorf("expected the verified email of the user info, got %+v", identity)
+	}
+	if identity.Name != "Player One" || identity.Picture != "https://example.com/player.png" {
+		t.Errorf("expected the profile of the user info, got %+v", identity)
+	}
+
+	// The user info of another user is never merged into the identity
+	issuer.userInfo["sub"] = "oidc-subject-2"
+	if _, err := issuer.provider().Exchange(context.Background(), testCode, oauth2.GenerateVerifier()); err == nil {
+		t.Error("expected the user info of another subject to be rejected")
+	}
+}
@@ -0,0 +1,23 @@
+package auth
+
+import "context"
+
+// Identity is the identity of a user as asserted by an identity provider
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// IdentityProvider is an external provider users can log in with
+type IdentityProvider interface {
+	// Name identifies the provider in login URLs and linked identities, e.g. "google"
+	Name() string
+	// AuthCodeURL returns the URL of the provider's login page
+	AuthCodeURL(ctx context.Context, state string, verifier string) (string, error)
+	// Exchange trades the authorization code returned to the callback for the verified identity of the user
+	Exchange(ctx context.Context, code string, verifier string) (*Identity, error)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// courtColumns are the columns of the CSV file of courts, name and address are required
+var courtColumns = []string{"name", "address", "google_map_url", "estimate_price_per_hour", "contact", "image"}
+
+// importCourts creates the courts listed in a CSV file with a header row. Courts with the same name and address as
+// an existing court are skipped, so a file can be imported again. Nothing is imported when a row is invalid.
+func importCourts(db *gorm.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected the path of a CSV file")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	courts, err := readCourts(file)
+	if err != nil {
+		return err
+	}
+
+	var created, skipped int
+	if err := database.RunInTransaction(db, func(tx *gorm.DB) error {
+		for _, court := range courts {
+			var count int64
+			if err := tx.Model(&models.BadmintonCourt{}).
+				Where("name = ? AND address = ?", court.Name, court.Address).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				skipped++
+				continue
+			}
+
+			if err := tx.Create(court).Error; err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d courts, skipped %d existing ones", created, skipped)
+	return nil
+}
+
+// readCourts parses and validates the courts of a CSV file
+func readCourts(r io.Reader) ([]*models.BadmintonCourt, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for name := range columns {
+		if !slices.Contains(courtColumns, name) {
+			return nil, fmt.Errorf("unknown column %s, expected %s", name, strings.Join(courtColumns, ", "))
+		}
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("the name column is required")
+	}
+	if _, ok := columns["address"]; !ok {
+		return nil, errors.New("the address column is required")
+	}
+
+	var courts []*models.BadmintonCourt
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		court := &models.BadmintonCourt{
+			Name:         value("name"),
+			Address:      value("address"),
+			GoogleMapURL: value("google_map_url"),
+			Contact:      value("contact"),
+			Image:        value("image"),
+		}
+		if len(court.Name) == 0 || len(court.Address) == 0 {
+			return nil, fmt.Errorf("line %d: name and address are required", line)
+		}
+		if len(court.GoogleMapURL) > 0 {
+			if _, err := url.ParseRequestURI(court.GoogleMapURL); err != nil {
+				return nil, fmt.Errorf("line %d: invalid Google Map URL", line)
+			}
+		}
+		if price := value("estimate_price_per_hour"); len(price) > 0 {
+			court.EstimatePricePerHour, err = decimal.NewFromString(price)
+			if err != nil || court.EstimatePricePerHour.IsNegative() {
+				return nil, fmt.Errorf("line %d: invalid price %s", line, price)
+			}
+		}
+
+		courts = append(courts, court)
+	}
+	return courts, nil
+}
@@ -0,0 +1,130 @@
+// Command admin runs administrative tasks, such as migrations and creating the first admin, against the database
+// configured by the DB_* environment variables. Run it without arguments to list the commands.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/jobs"
+	"github.com/alanrb/badminton/backend/rbac"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+const usage = `usage: admin <command> [arguments]
+
+commands:
+  migrate up|down [n]|status   apply, revert or list the migrations
+  seed                         seed the default roles and permissions
+  create-admin -email -name    create an admin, or make an existing user one
+  promote -email -role         give a role to an existing user
+  list-users [-role]           list the users and their roles
+  import-courts <file.csv>     import badminton courts from a CSV file
+  jobs [name...]               run the maintenance jobs, all of them by default`
+
+func main() {
+	log.SetFlags(0)
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found or error loading .env file")
+	}
+
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	command, args := os.Args[1], os.Args[2:]
+
+	database.Init(os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_SSL_MODE"), os.Getenv("DEBUG_MODE") == "true")
+
+	var err error
+	switch command {
+	case "migrate":
+		err = migrate(database.DB, args)
+	case "seed":
+		rbac.SeedRolesAndPermissions(database.DB)
+		log.Println("Seeded the default roles and permissions")
+	case "create-admin":
+		err = createAdmin(database.DB, args)
+	case "promote":
+		err = promote(database.DB, args)
+	case "list-users":
+		err = listUsers(database.DB, args)
+	case "import-courts":
+		err = importCourts(database.DB, args)
+	case "jobs":
+		err = runJobs(database.DB, args)
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
+}
+
+// migrate applies, reverts or lists the migrations
+func migrate(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected up, down [n] or status")
+	}
+
+	switch args[0] {
+	case "up":
+		return database.Migrate(db)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations to revert: %s", args[1])
+			}
+			steps = n
+		}
+		return database.Rollback(db, steps)
+
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%s\t%s\n", state.Version, state.Name, appliedAt)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("expected up, down [n] or status, got %s", args[0])
+	}
+}
+
+// runJobs runs the named maintenance jobs, or all of them
+func runJobs(db *gorm.DB, names []string) error {
+	toRun := jobs.All
+	if len(names) > 0 {
+		toRun = make([]jobs.Job, 0, len(names))
+		for _, name := range names {
+			job, err := jobs.Find(name)
+			if err != nil {
+				return err
+			}
+			toRun = append(toRun, job)
+		}
+	}
+
+	for _, job := range toRun {
+		count, err := job.Run(db)
+		if err != nil {
+			return fmt.Errorf("job %s failed: %w", job.Name, err)
+		}
+		log.Printf("%s: %d rows", job.Name, count)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/rbac"
+	"gorm.io/gorm"
+)
+
+// createAdmin creates an admin, or gives the admin role to the user with the email. The user is linked to their
+// identity provider account the first time they log in with a verified email.
+func createAdmin(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the admin")
+	name := flags.String("name", "", "name of the admin, the email by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	*email = strings.TrimSpace(*email)
+	if len(*email) == 0 {
+		return errors.New("-email is required")
+	}
+	if len(*name) == 0 {
+		*name = *email
+	}
+
+	return database.RunInTransaction(db, func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.Where("email = ?", *email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user = models.User{Email: *email, Name: *name}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := rbac.AssignRoleToUser(tx, user.ID, models.UserRolePlayer); err != nil {
+				return err
+			}
+			log.Printf("Created user %s <%s>", user.ID, user.Email)
+		} else if err != nil {
+			return err
+		}
+
+		return assignRole(tx, &user, models.UserRoleAdmin)
+	})
+}
+
+// promote gives a role to an existing user
+func promote(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("promote", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	role := flags.String("role", models.UserRoleAdmin, "role to give")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*email) == 0 {
+		return errors.New("-email is required")
+	}
+
+	return database.RunInTransaction(db, func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("email = ?", strings.TrimSpace(*email)).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("no user with email %s", *email)
+			}
+			return err
+		}
+
+		return assignRole(tx, &user, *role)
+	})
+}
+
+// assignRole gives a role to a user and refuses the access tokens issued with their previous roles
+func assignRole(tx *gorm.DB, user *models.User, roleName string) error {
+	if err := rbac.AssignRoleToUser(tx, user.ID, roleName); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("no role named %s, run the migrations or seed first", roleName)
+		}
+		return err
+	}
+
+	if err := rbac.BumpPermissionVersion(tx, user.ID); err != nil {
+		return err
+	}
+
+	log.Printf("User %s <%s> has the role %s", user.ID, user.Email, roleName)
+	return nil
+}
+
+// listUsers prints the users and their roles, optionally only those holding a role
+func listUsers(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("list-users", flag.ContinueOnError)
+	role := flags.String("role", "", "only list the users holding this role")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := db.Preload("Roles").Order("email")
+	if len(*role) > 0 {
+		query = query.Where("id IN (?)", db.Model(&models.UserRole{}).
+			Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.name = ?", *role))
+	}
+
+	var users []*models.User
+	if err := query.Find(&users).Error; err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tNAME\tROLES")
+	for _, user := range users {
+		roles := make([]string, 0, len(user.Roles))
+		for _, role := range user.Roles {
+			roles = append(roles, role.Name)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", user.ID, user.Email, user.Name, strings.Join(roles, ","))
+	}
+	return w.Flush()
+}
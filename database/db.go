@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/alanrb/badminton/backend/models"
-	"github.com/alanrb/badminton/backend/rbac"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -15,6 +14,7 @@ type TransactionHandler func(tx *gorm.DB) error
 
 var DB *gorm.DB
 
+// Init connects to the database. The schema is not changed, run the migrations with Migrate or the admin command.
 func Init(host, port, user, password, db_name, ssl_mode string, debug bool) {
 	dsn := "host=" + host +
 		" port=" + port +
@@ -27,7 +27,14 @@ func Init(host, port, user, password, db_name, ssl_mode string, debug bool) {
 		fmt.Printf("connect to: %v\n", dsn)
 	}
 	var err error
+	DB, err = Open(dsn, debug)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to connect to database: %v", err))
+	}
+}
 
+// Open connects to the database with a DSN
+func Open(dsn string, debug bool) (*gorm.DB, error) {
 	var lg logger.Interface
 	if debug {
 		lg = logger.Default.LogMode(logger.LogLevel(4))
@@ -35,30 +42,19 @@ func Init(host, port, user, password, db_name, ssl_mode string, debug bool) {
 		lg = logger.Discard
 	}
 
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger:                                   lg,
 		DisableForeignKeyConstraintWhenMigrating: true,
 	})
-
 	if err != nil {
-		panic(fmt.Sprintf("Failed to connect to database: %v", err))
-	}
-	if err := DB.AutoMigrate(
-		&models.User{},
-		&models.Session{},
-		&models.SessionAttendee{},
-		&models.BadmintonCourt{},
-		&models.Group{},
-		&models.GroupMember{},
-		&models.GroupSession{},
-		&models.Role{},
-		&models.Permission{},
-		&models.UserRole{},
-	); err != nil {
-		panic(fmt.Sprintf("Failed to migrate database: %v", err))
+		return nil, err
 	}
 
-	rbac.SeedRolesAndPermissions(DB)
+	// Group members carry a group-scoped role
+	if err := db.SetupJoinTable(&models.Group{}, "Members", &models.GroupMember{}); err != nil {
+		return nil, fmt.Errorf("setup join table: %w", err)
+	}
+	return db, nil
 }
 
 // RunInTransaction runs the provided handler function within a database transaction
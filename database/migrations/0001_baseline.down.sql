@@ -0,0 +1,6 @@
+-- The baseline is never rolled back, reverting it would drop every table and all data with it
+DO $$
+BEGIN
+    RAISE EXCEPTION 'the baseline migration cannot be rolled back';
+END
+$$;
@@ -0,0 +1,396 @@
+-- Baseline: the schema the application created with AutoMigrate before versioned migrations.
+-- Every statement is idempotent so databases created by AutoMigrate adopt it without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    google_id text,
+    email text NOT NULL,
+    name text NOT NULL,
+    avatar_url text,
+    permission_version bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_users_google_id UNIQUE (google_id),
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id text,
+    role_id text,
+    PRIMARY KEY (user_id,role_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id text NOT NULL,
+    provider varchar(50) NOT NULL,
+    subject text NOT NULL,
+    email text,
+    last_login_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities (provider,subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text NOT NULL,
+    owner_id text NOT NULL,
+    image_url text,
+    remark text,
+    visibility varchar(20) DEFAULT 'private',
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS badminton_courts (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text NOT NULL,
+    address text NOT NULL,
+    image text,
+    google_map_url text,
+    estimate_price_per_hour text,
+    contact text,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    description text NOT NULL,
+    max_members bigint NOT NULL,
+    date_time timestamptz,
+    created_by text NOT NULL,
+    status varchar(20) DEFAULT 'open',
+    badminton_court_id text,
+    group_id text,
+    cost numeric(12,2) NOT NULL DEFAULT '0',
+    cost_split varchar(20) DEFAULT 'pool',
+    created_by_name text,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS session_attendees (
+    session_id text,
+    user_id text,
+    slot bigint,
+    status text,
+    remark text,
+    PRIMARY KEY (session_id,user_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_sessions (
+    group_id text,
+    session_id text,
+    PRIMARY KEY (group_id,session_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id text,
+    user_id text,
+    role varchar(20) DEFAULT 'member',
+    PRIMARY KEY (group_id,user_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_join_requests (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    group_id text NOT NULL,
+    user_id text NOT NULL,
+    status varchar(20) DEFAULT 'pending',
+    message text,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_group_join_requests_user_id ON group_join_requests (user_id);
+CREATE INDEX IF NOT EXISTS idx_group_join_requests_group_id ON group_join_requests (group_id);
+
+CREATE TABLE IF NOT EXISTS group_announcements (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    group_id text NOT NULL,
+    author_id text NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_group_announcements_group_id ON group_announcements (group_id);
+
+CREATE TABLE IF NOT EXISTS group_announcement_mentions (
+    group_announcement_id text,
+    user_id text,
+    PRIMARY KEY (group_announcement_id,user_id)
+);
+
+CREATE TABLE IF NOT EXISTS session_comments (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    session_id text NOT NULL,
+    author_id text NOT NULL,
+    content text NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_session_comments_session_id ON session_comments (session_id);
+
+CREATE TABLE IF NOT EXISTS session_comment_mentions (
+    session_comment_id text,
+    user_id text,
+    PRIMARY KEY (session_comment_id,user_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_wallets (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    group_id text NOT NULL,
+    balance numeric(12,2) NOT NULL DEFAULT '0',
+    low_balance_threshold numeric(12,2) NOT NULL DEFAULT '0',
+    member_low_balance_threshold numeric(12,2) NOT NULL DEFAULT '0',
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_wallets_group_id ON group_wallets (group_id);
+
+CREATE TABLE IF NOT EXISTS group_wallet_balances (
+    group_id text,
+    user_id text,
+    balance numeric(12,2) NOT NULL DEFAULT '0',
+    updated_at timestamptz,
+    PRIMARY KEY (group_id,user_id)
+);
+
+CREATE TABLE IF NOT EXISTS wallet_transactions (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    group_id text NOT NULL,
+    user_id text,
+    session_id text,
+    type varchar(20) NOT NULL,
+    amount numeric(12,2) NOT NULL,
+    pool_balance numeric(12,2) NOT NULL,
+    member_balance numeric(12,2),
+    note text,
+    created_by text NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_session_id ON wallet_transactions (session_id);
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_user_id ON wallet_transactions (user_id);
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_group_id ON wallet_transactions (group_id);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text NOT NULL,
+    description text,
+    protected boolean NOT NULL DEFAULT false,
+    priority bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_roles_name UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_permissions_name UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id text,
+    permission_id text,
+    PRIMARY KEY (role_id,permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS seeded_role_permissions (
+    role_id text,
+    permission_id text,
+    created_at timestamptz,
+    PRIMARY KEY (role_id,permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id text NOT NULL,
+    family_id text NOT NULL,
+    token_hash text NOT NULL,
+    access_jti text,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    revoked_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_access_jti ON refresh_tokens (access_jti);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti text,
+    user_id text,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (jti)
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_user_id ON revoked_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id text NOT NULL,
+    name text NOT NULL,
+    prefix varchar(20) NOT NULL,
+    key_hash text NOT NULL,
+    scopes text NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    created_by text NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    admin_id text NOT NULL,
+    user_id text NOT NULL,
+    reason text NOT NULL,
+    token_jti text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    ended_at timestamptz,
+    ip_address text,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_impersonation_sessions_token_jti ON impersonation_sessions (token_jti);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_user_id ON impersonation_sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_admin_id ON impersonation_sessions (admin_id);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id text,
+    created_at timestamptz,
+    actor_id text NOT NULL,
+    impersonated_by text,
+    api_key_id text,
+    action text NOT NULL,
+    resource_type text,
+    resource_id text,
+    changes jsonb,
+    method text,
+    path text,
+    status bigint,
+    request_id text,
+    ip_address text,
+    user_agent text,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_resource ON audit_logs (resource_type,resource_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs (action);
+
+-- Tables created by AutoMigrate before these columns existed only get them here
+ALTER TABLE users ADD COLUMN IF NOT EXISTS permission_version bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ALTER COLUMN google_id DROP NOT NULL;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS visibility varchar(20) DEFAULT 'private';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS cost numeric(12,2) NOT NULL DEFAULT '0';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS cost_split varchar(20) DEFAULT 'pool';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS created_by_name text;
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS role varchar(20) DEFAULT 'member';
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS description text;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS protected boolean NOT NULL DEFAULT false;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS priority bigint NOT NULL DEFAULT 0;
+
+-- Owners of groups are group owners
+UPDATE group_members SET role = 'owner' FROM groups
+WHERE groups.id = group_members.group_id AND groups.owner_id = group_members.user_id AND group_members.role <> 'owner';
+
+-- Google logins recorded in users.google_id become Google identities. Cognito users stored their email there instead
+-- and are linked under their Cognito subject, which is also their user ID.
+INSERT INTO user_identities (id, user_id, provider, subject, email, created_at, updated_at)
+SELECT gen_random_uuid()::text, id, CASE WHEN google_id = email THEN 'cognito' ELSE 'google' END,
+    CASE WHEN google_id = email THEN id ELSE google_id END, email, now(), now()
+FROM users WHERE google_id IS NOT NULL AND deleted_at IS NULL
+ON CONFLICT (provider, subject) DO NOTHING;
+
+-- The legacy users.role column is replaced by user_roles. Users are given the role of their legacy role, and users
+-- without roles become players. The default roles are created for it when missing, they are completed by the seeding
+-- after the migrations. A legacy role that is not a role stops the migration, for an operator to create the role or
+-- change the role of the user before the column is dropped.
+DO $$
+DECLARE
+    unknown record;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'role') THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO roles (id, name, created_at, updated_at)
+    SELECT gen_random_uuid()::text, name, now(), now() FROM unnest(ARRAY['admin', 'group_owner', 'player']) AS name
+    ON CONFLICT (name) DO NOTHING;
+
+    FOR unknown IN EXECUTE $sql$
+        SELECT users.id, users.role FROM users WHERE users.role IS NOT NULL AND users.role <> '' AND NOT EXISTS (
+            SELECT 1 FROM roles WHERE roles.name = users.role AND roles.deleted_at IS NULL)
+    $sql$ LOOP
+        RAISE EXCEPTION 'User % has the legacy role %, which is not a role. Create the role or change the role of the user, then migrate again', unknown.id, unknown.role;
+    END LOOP;
+
+    EXECUTE $sql$
+        INSERT INTO user_roles (user_id, role_id)
+        SELECT users.id, roles.id FROM users JOIN roles ON roles.name = users.role AND roles.deleted_at IS NULL
+        ON CONFLICT DO NOTHING
+    $sql$;
+
+    INSERT INTO user_roles (user_id, role_id)
+    SELECT users.id, roles.id FROM users JOIN roles ON roles.name = 'player'
+    WHERE NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id)
+    ON CONFLICT DO NOTHING;
+
+    ALTER TABLE users DROP COLUMN role;
+END
+$$;
+
+-- The audit log is append-only
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+CREATE TRIGGER audit_logs_append_only BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
@@ -0,0 +1,17 @@
+-- Drops the versions of the records
+
+ALTER TABLE users DROP COLUMN IF EXISTS version;
+ALTER TABLE user_identities DROP COLUMN IF EXISTS version;
+ALTER TABLE groups DROP COLUMN IF EXISTS version;
+ALTER TABLE badminton_courts DROP COLUMN IF EXISTS version;
+ALTER TABLE sessions DROP COLUMN IF EXISTS version;
+ALTER TABLE group_join_requests DROP COLUMN IF EXISTS version;
+ALTER TABLE group_announcements DROP COLUMN IF EXISTS version;
+ALTER TABLE session_comments DROP COLUMN IF EXISTS version;
+ALTER TABLE group_wallets DROP COLUMN IF EXISTS version;
+ALTER TABLE wallet_transactions DROP COLUMN IF EXISTS version;
+ALTER TABLE roles DROP COLUMN IF EXISTS version;
+ALTER TABLE permissions DROP COLUMN IF EXISTS version;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS version;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS version;
+ALTER TABLE impersonation_sessions DROP COLUMN IF EXISTS version;
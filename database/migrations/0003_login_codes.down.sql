@@ -0,0 +1,3 @@
+-- Drops the login codes, logins in progress have to start over
+
+DROP TABLE IF EXISTS login_codes;
@@ -0,0 +1,10 @@
+-- Single-use codes the frontend exchanges for the tokens of a login
+
+CREATE TABLE IF NOT EXISTS login_codes (
+    code_hash text,
+    user_id text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (code_hash)
+);
+CREATE INDEX IF NOT EXISTS idx_login_codes_expires_at ON login_codes (expires_at);
@@ -0,0 +1,4 @@
+-- Drops the pending keys, which were never issued so no script uses them
+
+DELETE FROM api_keys WHERE key_hash IS NULL;
+ALTER TABLE api_keys ALTER COLUMN key_hash SET NOT NULL;
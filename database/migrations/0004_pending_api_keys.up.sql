@@ -0,0 +1,3 @@
+-- Keys an admin creates for another user have no hash until their user issues the key itself
+
+ALTER TABLE api_keys ALTER COLUMN key_hash DROP NOT NULL;
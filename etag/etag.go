@@ -0,0 +1,49 @@
+// Package etag tags the representations of resources with their version, so clients can make conditional requests:
+// If-Match to only change a resource that was not changed since they fetched it, and If-None-Match to skip
+// fetching a resource they already hold.
+package etag
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfMatch     = "If-Match"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// Format is the strong ETag of a version, e.g. "3"
+func Format(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Match tells whether an If-Match header holds the version, comparing ETags strongly as RFC 9110 requires:
+// weak ETags never match
+func Match(header string, version int64) bool {
+	return matches(header, version, false)
+}
+
+// NoneMatch tells whether an If-None-Match header misses the version, comparing ETags weakly as RFC 9110 requires
+func NoneMatch(header string, version int64) bool {
+	return !matches(header, version, true)
+}
+
+// matches tells whether the list of ETags of a header holds the version, * holds every version
+func matches(header string, version int64, weak bool) bool {
+	tag := Format(version)
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if value == "*" {
+			return true
+		}
+		if weak {
+			value = strings.TrimPrefix(value, "W/")
+		}
+		if value == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package etag
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		match  bool
+	}{
+		{`"3"`, true},
+		{`"2"`, false},
+		{`*`, true},
+		{`"1", "3"`, true},
+		{`"1","2"`, false},
+		{`W/"3"`, false},
+		{`3`, false},
+		{``, false},
+	} {
+		if match := Match(test.header, 3); match != test.match {
+			t.Errorf("If-Match %s: expected %v, got %v", test.header, test.match, match)
+		}
+	}
+}
+
+func TestNoneMatch(t *testing.T) {
+	for _, test := range []struct {
+		header    string
+		noneMatch bool
+	}{
+		{`"3"`, false},
+		{`W/"3"`, false},
+		{`"2", W/"3"`, false},
+		{`*`, false},
+		{`"2"`, true},
+		{``, true},
+	} {
+		if noneMatch := NoneMatch(test.header, 3); noneMatch != test.noneMatch {
+			t.Errorf("If-None-Match %s: expected %v, got %v", test.header, test.noneMatch, noneMatch)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var errInvalidMention = errors.New("mentioned users must be members")
+
+// ListGroupAnnouncements lists the announcements of a group, newest first
+func ListGroupAnnouncements(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	cc := c.(*auth.Context)
+	userID := cc.AuthUser().ID
+
+	// Only group members can read the group feed
+	canView, err := authorizeGroupID(c, groupID, userID, policy.View)
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound("Group not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canView {
+		return apperror.Forbidden("You are not a member of this group")
+	}
+
+	// Get pagination parameters using the utility
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.GroupAnnouncement{}).Where("group_id = ?", groupID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total announcements", err)
+	}
+
+	var announcements []*models.GroupAnnouncement
+	if err := query.
+		Preload("Author").
+		Preload("Mentions").
+		Order("created_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&announcements).Error; err != nil {
+		return apperror.Internal("Failed to fetch announcements", err)
+	}
+
+	// Convert announcements to DTOs
+	var announcementResponses = make([]*dto.AnnouncementResponse, 0, len(announcements))
+	for _, announcement := range announcements {
+		announcementResponses = append(announcementResponses, dto.ToAnnouncementResponse(announcement))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      announcementResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
+
+// CreateGroupAnnouncement posts an announcement to the group feed
+func CreateGroupAnnouncement(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	var request dto.AnnouncementRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return apperror.NotFound("Group not found")
+	}
+
+	// Only group organizers can post announcements
+	cc := c.(*auth.Context)
+	userID := cc.AuthUser().ID
+	canPost, err := authorizeGroup(c, &group, userID, policy.PostAnnouncement)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canPost {
+		return apperror.Forbidden("Only group organizers can post announcements")
+	}
+
+	mentions, err := findGroupMembers(database.DB, groupID, request.Mentions)
+	if err != nil {
+		if errors.Is(err, errInvalidMention) {
+			return apperror.BadRequest("Mentioned users must be members of the group")
+		}
+		return apperror.Internal("Failed to fetch mentioned users", err)
+	}
+
+	announcement := models.GroupAnnouncement{
+		GroupID:  groupID,
+		AuthorID: userID,
+		Title:    request.Title,
+		Content:  request.Content,
+		Mentions: mentions,
+	}
+	if err := database.DB.Omit("Mentions.*").Create(&announcement).Error; err != nil {
+		return apperror.Internal("Failed to post announcement", err)
+	}
+
+	if err := database.DB.Preload("Author").First(&announcement, "id = ?", announcement.ID).Error; err != nil {
+		return apperror.Internal("Failed to fetch announcement", err)
+	}
+
+	audit.Record(c, "announcement.create", audit.ResourceAnnouncement, announcement.ID, nil, announcementSnapshot(&announcement))
+	return c.JSON(http.StatusCreated, dto.ToAnnouncementResponse(&announcement))
+}
+
+// UpdateGroupAnnouncement edits an announcement, only its author can do so
+func UpdateGroupAnnouncement(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	announcementID, err := GetParamID(c, "announcement_id")
+	if err != nil {
+		return apperror.BadRequest("Invalid announcement ID")
+	}
+
+	var request dto.AnnouncementRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	var announcement models.GroupAnnouncement
+	if err := database.DB.Where("id = ? AND group_id = ?", announcementID, groupID).First(&announcement).Error; err != nil {
+		return apperror.NotFound("Announcement not found")
+	}
+
+	cc := c.(*auth.Context)
+	canUpdate, err := authorizeAnnouncement(c, &announcement, cc.AuthUser().ID, policy.Update)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canUpdate {
+		return apperror.Forbidden("You are not the author of this announcement")
+	}
+
+	mentions, err := findGroupMembers(database.DB, groupID, request.Mentions)
+	if err != nil {
+		if errors.Is(err, errInvalidMention) {
+			return apperror.BadRequest("Mentioned users must be members of the group")
+		}
+		return apperror.Internal("Failed to fetch mentioned users", err)
+	}
+
+	before := announcementSnapshot(&announcement)
+	announcement.Title = request.Title
+	announcement.Content = request.Content
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		if err := tx.Omit("Mentions").Save(&announcement).Error; err != nil {
+			return err
+		}
+		return tx.Model(&announcement).Association("Mentions").Replace(mentions)
+	}); err != nil {
+		return apperror.Internal("Failed to update announcement", err)
+	}
+
+	if err := database.DB.Preload("Author").Preload("Mentions").First(&announcement, "id = ?", announcement.ID).Error; err != nil {
+		return apperror.Internal("Failed to fetch announcement", err)
+	}
+
+	audit.Record(c, "announcement.update", audit.ResourceAnnouncement, announcement.ID, before, announcementSnapshot(&announcement))
+	return c.JSON(http.StatusOK, dto.ToAnnouncementResponse(&announcement))
+}
+
+// DeleteGroupAnnouncement deletes an announcement, allowed for its author, group organizers and admins
+func DeleteGroupAnnouncement(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	announcementID, err := GetParamID(c, "announcement_id")
+	if err != nil {
+		return apperror.BadRequest("Invalid announcement ID")
+	}
+
+	var announcement models.GroupAnnouncement
+	if err := database.DB.Where("id = ? AND group_id = ?", announcementID, groupID).First(&announcement).Error; err != nil {
+		return apperror.NotFound("Announcement not found")
+	}
+
+	cc := c.(*auth.Context)
+	canDelete, err := authorizeAnnouncement(c, &announcement, cc.AuthUser().ID, policy.Delete)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canDelete {
+		return apperror.Forbidden("You do not have permission to delete this announcement")
+	}
+
+	if err := database.DB.Delete(&announcement).Error; err != nil {
+		return apperror.Internal("Failed to delete announcement", err)
+	}
+
+	audit.Record(c, "announcement.delete", audit.ResourceAnnouncement, announcement.ID, announcementSnapshot(&announcement), nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Announcement deleted"})
+}
+
+// announcementSnapshot describes an announcement for the audit log
+func announcementSnapshot(announcement *models.GroupAnnouncement) map[string]string {
+	return map[string]string{
+		"group_id": announcement.GroupID,
+		"title":    announcement.Title,
+		"content":  announcement.Content,
+	}
+}
+
+// findGroupMembers fetches the mentioned users, all of whom must be members of the group
+func findGroupMembers(db *gorm.DB, groupID string, userIDs []string) ([]*models.User, error) {
+	ids, err := uniqueIDs(userIDs)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var users []*models.User
+	if err := db.
+		Joins("JOIN group_members ON group_members.user_id = users.id").
+		Where("group_members.group_id = ? AND users.id IN ?", groupID, ids).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	if len(users) != len(ids) {
+		return nil, errInvalidMention
+	}
+	return users, nil
+}
+
+// uniqueIDs validates and de-duplicates user IDs
+func uniqueIDs(userIDs []string) ([]string, error) {
+	seen := make(map[string]bool, len(userIDs))
+	ids := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if err := uuid.Validate(id); err != nil {
+			return nil, errInvalidMention
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
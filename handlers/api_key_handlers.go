@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// apiKeyUsageInterval limits how often the last use of an API key is written
+const apiKeyUsageInterval = time.Minute
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ListAPIKeys lists the API keys of the current user
+func ListAPIKeys(c echo.Context) error {
+	cc := c.(*auth.Context)
+	return listAPIKeys(c, cc.AuthUser().ID)
+}
+
+// ListAllAPIKeys lists the API keys of every user, or of one user with ?user_id=
+func ListAllAPIKeys(c echo.Context) error {
+	return listAPIKeys(c, c.QueryParam("user_id"))
+}
+
+// CreateAPIKey creates an API key for the current user
+func CreateAPIKey(c echo.Context) error {
+	cc := c.(*auth.Context)
+	return createAPIKey(c, cc.AuthUser().ID, cc.AuthUser().ID)
+}
+
+// CreateUserAPIKey creates a pending API key for another user. The key itself is only generated when its user
+// issues it, so admins can never act as the user with it.
+func CreateUserAPIKey(c echo.Context) error {
+	userID, err := GetParamID(c, "user_id")
+	if err != nil {
+		return apperror.NotFound("User not found")
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return apperror.NotFound("User not found")
+	}
+
+	cc := c.(*auth.Context)
+	return createAPIKey(c, user.ID, cc.AuthUser().ID)
+}
+
+// IssueAPIKey generates the key of a pending API key an admin created for the current user, it is returned once
+func IssueAPIKey(c echo.Context) error {
+	keyID, err := GetParamID(c, "key_id")
+	if err != nil {
+		return apperror.NotFound("API key not found")
+	}
+
+	cc := c.(*auth.Context)
+
+	var apiKey models.APIKey
+	if err := database.DB.First(&apiKey, "id = ? AND user_id = ?", keyID, cc.AuthUser().ID).Error; err != nil {
+		return apperror.NotFound("API key not found")
+	}
+	if !apiKey.IsPending() {
+		return apperror.Conflict("API key was already issued")
+	}
+	if !apiKey.IsActive() {
+		return apperror.Conflict("API key is revoked or expired")
+	}
+
+	before := dto.ToAPIKeyResponse(&apiKey)
+	key, err := generateAPIKey(&apiKey)
+	if err != nil {
+		return apperror.Internal("Failed to issue API key", err)
+	}
+
+	// Only the first of concurrent requests issues the key
+	result := database.DB.Model(&apiKey).Where("key_hash IS NULL").
+		Updates(map[string]interface{}{"prefix": apiKey.Prefix, "key_hash": apiKey.KeyHash})
+	if result.Error != nil {
+		return apperror.Internal("Failed to issue API key", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperror.Conflict("API key was already issued")
+	}
+
+	audit.Record(c, "api_key.issue", audit.ResourceAPIKey, apiKey.ID, before, dto.ToAPIKeyResponse(&apiKey))
+	return c.JSON(http.StatusOK, dto.CreatedAPIKeyResponse{
+		APIKeyResponse: dto.ToAPIKeyResponse(&apiKey),
+		Key:            key,
+	})
+}
+
+// RevokeAPIKey revokes an API key of the current user, admins can revoke any key
+func RevokeAPIKey(c echo.Context) error {
+	keyID, err := GetParamID(c, "key_id")
+	if err != nil {
+		return apperror.NotFound("API key not found")
+	}
+
+	cc := c.(*auth.Context)
+	userID := cc.AuthUser().ID
+
+	var key models.APIKey
+	if err := database.DB.First(&key, "id = ?", keyID).Error; err != nil {
+		return apperror.NotFound("API key not found")
+	}
+
+	if !allowed(c, userID, policy.Delete, &policy.APIKey{UserID: key.UserID}) {
+		return apperror.NotFound("API key not found")
+	}
+
+	if key.RevokedAt == nil {
+		before := dto.ToAPIKeyResponse(&key)
+		now := time.Now()
+		if err := database.DB.Model(&key).Update("revoked_at", &now).Error; err != nil {
+			return apperror.Internal("Failed to revoke API key", err)
+		}
+		audit.Record(c, "api_key.revoke", audit.ResourceAPIKey, key.ID, before, dto.ToAPIKeyResponse(&key))
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "API key revoked"})
+}
+
+// AuthenticateAPIKey finds the user of an active API key and records its use
+func AuthenticateAPIKey(db *gorm.DB, key string) (*models.AuthUser, error) {
+	var apiKey models.APIKey
+	if err := db.Preload("User.Roles").First(&apiKey, "key_hash = ?", auth.HashAPIKey(key)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if !apiKey.IsActive() || apiKey.User == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyUsageInterval {
+		if err := db.Model(&apiKey).UpdateColumn("last_used_at", &now).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.AuthUser{
+		ID:       apiKey.UserID,
+		Role:     apiKey.User.PrimaryRole(),
+		Source:   auth.UserSourceAPIKey,
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+func listAPIKeys(c echo.Context, userID string) error {
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.APIKey{})
+	if len(userID) > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total API keys", err)
+	}
+
+	var keys []*models.APIKey
+	if err := query.
+		Order("created_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&keys).Error; err != nil {
+		return apperror.Internal("Failed to fetch API keys", err)
+	}
+
+	// Convert API keys to DTOs
+	var keyResponses = make([]dto.APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		keyResponses = append(keyResponses, dto.ToAPIKeyResponse(key))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      keyResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
+
+// createAPIKey creates an API key for a user. Scopes only narrow what the key can do,
+// routes guarded by a permission still check that the user holds it.
+// Keys created for another user are pending until the user issues them.
+func createAPIKey(c echo.Context, userID string, createdBy string) error {
+	var request dto.NewAPIKeyRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+	request.Name = strings.TrimSpace(request.Name)
+
+	scopes := slices.Clone(request.Scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	apiKey := models.APIKey{
+		UserID:    userID,
+		Name:      request.Name,
+		Scopes:    scopes,
+		ExpiresAt: request.ExpiresAt,
+		CreatedBy: createdBy,
+	}
+
+	// The key itself is only ever shown to its user
+	var key string
+	if createdBy == userID {
+		var err error
+		if key, err = generateAPIKey(&apiKey); err != nil {
+			return apperror.Internal("Failed to create API key", err)
+		}
+	}
+
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		return apperror.Internal("Failed to create API key", err)
+	}
+
+	audit.Record(c, "api_key.create", audit.ResourceAPIKey, apiKey.ID, nil, dto.ToAPIKeyResponse(&apiKey))
+	if apiKey.IsPending() {
+		return c.JSON(http.StatusCreated, dto.ToAPIKeyResponse(&apiKey))
+	}
+	return c.JSON(http.StatusCreated, dto.CreatedAPIKeyResponse{
+		APIKeyResponse: dto.ToAPIKeyResponse(&apiKey),
+		Key:            key,
+	})
+}
+
+// generateAPIKey generates the key itself and sets its prefix and hash on the API key
+func generateAPIKey(apiKey *models.APIKey) (string, error) {
+	key, prefix, keyHash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+	apiKey.Prefix = prefix
+	apiKey.KeyHash = &keyHash
+	return key, nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/labstack/echo/v4"
+)
+
+// ListAuditLogs lists the audit log, newest first. It is filtered with ?actor_id=, ?action=, ?resource_type=,
+// ?resource_id= and the RFC 3339 time range ?from= and ?to=.
+func ListAuditLogs(c echo.Context) error {
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.AuditLog{})
+	if actorID := c.QueryParam("actor_id"); len(actorID) > 0 {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.QueryParam("action"); len(action) > 0 {
+		query = query.Where("action = ?", action)
+	}
+	if resourceType := c.QueryParam("resource_type"); len(resourceType) > 0 {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if resourceID := c.QueryParam("resource_id"); len(resourceID) > 0 {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+	if from := c.QueryParam("from"); len(from) > 0 {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return apperror.BadRequest("Invalid from time")
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.QueryParam("to"); len(to) > 0 {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return apperror.BadRequest("Invalid to time")
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total audit logs", err)
+	}
+
+	var logs []*models.AuditLog
+	if err := query.
+		Order("created_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&logs).Error; err != nil {
+		return apperror.Internal("Failed to fetch audit logs", err)
+	}
+
+	// Convert audit logs to DTOs
+	var logResponses = make([]dto.AuditLogResponse, 0, len(logs))
+	for _, log := range logs {
+		logResponses = append(logResponses, dto.ToAuditLogResponse(log))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      logResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
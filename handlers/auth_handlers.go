@@ -1,133 +1,248 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
+	"github.com/alanrb/badminton/backend/apperror"
 	"github.com/alanrb/badminton/backend/auth"
 	"github.com/alanrb/badminton/backend/database"
 	"github.com/alanrb/badminton/backend/models"
 	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/rbac"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/oauth2"
 	"gorm.io/gorm"
 )
 
-func HandleGoogleLogin(c echo.Context, cfg *oauth2.Config) error {
-	url := cfg.AuthCodeURL("state")
-	if err := c.Redirect(http.StatusTemporaryRedirect, url); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to redirect to Google login: %v", err)})
+// Error codes passed to the frontend login page when the login fails
+const (
+	LoginErrorUnknownProvider  = "unknown_provider"
+	LoginErrorAccessDenied     = "access_denied"
+	LoginErrorInvalidState     = "invalid_state"
+	LoginErrorExchange         = "exchange_failed"
+	LoginErrorEmailNotVerified = "email_not_verified"
+	LoginErrorServer           = "server_error"
+)
+
+var errEmailNotVerified = errors.New("email is not verified by the identity provider")
+
+// ListIdentityProviders returns the names of the providers users can log in with
+func ListIdentityProviders(c echo.Context, providers map[string]auth.IdentityProvider) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"providers": auth.ProviderNames(providers)})
+}
+
+func HandleLogin(c echo.Context, jwtSecret interface{}, websiteURL string, providers map[string]auth.IdentityProvider) error {
+	provider, ok := providers[c.Param("provider")]
+	if !ok {
+		return redirectLoginError(c, websiteURL, LoginErrorUnknownProvider)
+	}
+
+	// Random state against CSRF and PKCE verifier, kept in a signed cookie until the callback
+	state, err := auth.NewOAuthState(provider.Name(), c.QueryParam("return_to"))
+	if err != nil {
+		return redirectLoginError(c, websiteURL, LoginErrorServer)
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request().Context(), state.State, state.Verifier)
+	if err != nil {
+		c.Logger().Errorf("login with %s: %v", provider.Name(), err)
+		return redirectLoginError(c, websiteURL, LoginErrorServer)
+	}
+
+	if err := auth.SetOAuthStateCookie(c, state, jwtSecret); err != nil {
+		return redirectLoginError(c, websiteURL, LoginErrorServer)
 	}
-	return nil
+
+	return c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
-func HandleGoogleCallback(c echo.Context, jwtSecret interface{}, websiteURL string, cfg *oauth2.Config) error {
-	code := c.QueryParam("code")
+func HandleCallback(c echo.Context, jwtSecret interface{}, websiteURL string, providers map[string]auth.IdentityProvider) error {
+	provider, ok := providers[c.Param("provider")]
+	if !ok {
+		return redirectLoginError(c, websiteURL, LoginErrorUnknownProvider)
+	}
+
+	// The user declined or the provider reported an error
+	if len(c.QueryParam("error")) > 0 {
+		return redirectLoginError(c, websiteURL, LoginErrorAccessDenied)
+	}
 
-	token, err := cfg.Exchange(c.Request().Context(), code)
+	state, err := auth.VerifyOAuthState(c, provider.Name(), jwtSecret)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to exchange token"})
+		return redirectLoginError(c, websiteURL, LoginErrorInvalidState)
 	}
 
-	// Fetch user info from Google
-	client := cfg.Client(c.Request().Context(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	identity, err := provider.Exchange(c.Request().Context(), c.QueryParam("code"), state.Verifier)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user info"})
+		c.Logger().Errorf("login with %s: %v", provider.Name(), err)
+		return redirectLoginError(c, websiteURL, LoginErrorExchange)
+	}
+
+	var code string
+	err = database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		user, err := linkIdentity(tx, identity)
+		if err != nil {
+			return err
+		}
+
+		// The tokens are issued when the frontend exchanges the code, so they never appear in a URL
+		var codeHash string
+		code, codeHash, err = auth.GenerateLoginCode()
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.LoginCode{CodeHash: codeHash, UserID: user.ID, ExpiresAt: time.Now().Add(auth.LoginCodeTTL)}).Error
+	})
+	if errors.Is(err, errEmailNotVerified) {
+		return redirectLoginError(c, websiteURL, LoginErrorEmailNotVerified)
+	}
+	if err != nil {
+		return redirectLoginError(c, websiteURL, LoginErrorServer)
+	}
+
+	// Redirect to the frontend with the login code
+	query := url.Values{}
+	query.Set("code", code)
+	if len(state.ReturnTo) > 0 {
+		query.Set("return_to", state.ReturnTo)
 	}
-	defer resp.Body.Close()
+	return c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%v/login?%s", websiteURL, query.Encode()))
+}
+
+// linkIdentity finds the user of a provider identity. On the first login with a provider the identity is linked
+// to the user with the same email, or a new user is created. Either requires the provider to have verified the email,
+// otherwise anyone could take over an account by registering its email at another provider.
+func linkIdentity(tx *gorm.DB, identity *auth.Identity) (*models.User, error) {
+	now := time.Now()
+
+	var link models.UserIdentity
+	err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+	if err == nil {
+		var user models.User
+		if err := tx.Where("id = ?", link.UserID).First(&user).Error; err != nil {
+			return nil, err
+		}
 
-	var userInfo struct {
-		Email string `json:"email"`
-		Name  string `json:"name"`
-		ID    string `json:"id"`
+		// Cognito access tokens carry no email, the last one reported is kept
+		updates := map[string]interface{}{"last_login_at": now}
+		if len(identity.Email) > 0 {
+			updates["email"] = identity.Email
+		}
+		if err := tx.Model(&link).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to decode user info"})
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if len(identity.Email) == 0 || !identity.EmailVerified {
+		return nil, errEmailNotVerified
 	}
 
-	// Check if the user already exists in the database
 	var user models.User
-	if err := database.DB.Where("google_id = ?", userInfo.ID).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// If the user doesn't exist, create a new user
-			user = models.User{
-				GoogleID: userInfo.ID,
-				Email:    userInfo.Email,
-				Name:     userInfo.Name,
-				Role:     models.UserRolePlayer, // Default role
-			}
-			database.DB.Create(&user)
-		} else {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+	if err := tx.Where("email = ?", identity.Email).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		// If the user doesn't exist, create a new user
+		name := identity.Name
+		if len(name) == 0 {
+			name = identity.Email
+		}
+		user = models.User{
+			Email:     identity.Email,
+			Name:      name,
+			AvatarURL: identity.Picture,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		if err := rbac.AssignRoleToUser(tx, user.ID, models.UserRolePlayer); err != nil {
+			return nil, err
 		}
 	}
 
-	// Generate a JWT token for the user
-	jwtToken, err := auth.GenerateJWTToken(user, jwtSecret)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate JWT token"})
+	link = models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	}
+	if err := tx.Create(&link).Error; err != nil {
+		return nil, err
 	}
 
-	// Redirect to the frontend with the JWT token
-	frontendURL := fmt.Sprintf("%v/login?token=%s", websiteURL, jwtToken)
-	return c.Redirect(http.StatusTemporaryRedirect, frontendURL)
+	return &user, nil
 }
 
-func HandleCognitoUser(c echo.Context) error {
-	cc := c.(*auth.Context)
-	var userInfo struct {
-		ID      string `json:"id"`
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+// LinkedUserID returns the ID of the user a provider identity is linked to, empty when it is not linked yet
+func LinkedUserID(db *gorm.DB, identity *auth.Identity) (string, error) {
+	var link models.UserIdentity
+	err := db.Select("user_id").Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
 	}
-	if err := c.Bind(&userInfo); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	return link.UserID, err
+}
+
+// redirectLoginError sends the browser back to the frontend login page with an error code
+func redirectLoginError(c echo.Context, websiteURL string, code string) error {
+	query := url.Values{}
+	query.Set("error", code)
+	return c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%v/login?%s", websiteURL, query.Encode()))
+}
+
+// HandleCognitoUser links the Cognito identity of the caller like the identities of the other providers, to the
+// user with the email verified by Cognito or to a new user, and updates their profile. Only the subject and email
+// of the token are trusted, the request only carries the profile.
+func HandleCognitoUser(c echo.Context) error {
+	var userInfo dto.CognitoUserRequest
+	if err := bind(c, &userInfo); err != nil {
+		return err
 	}
 
-	if cc.AuthUser().ID != userInfo.ID {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to fetch user."})
+	verified, ok := c.Get(auth.IdentityKey).(*auth.Identity)
+	if !ok || verified.Subject != userInfo.ID {
+		return apperror.BadRequest("Failed to fetch user.")
 	}
 
-	// Check if the user already exists in the database
+	identity := *verified
+	identity.Name = userInfo.Name
+	identity.Picture = userInfo.Picture
+
 	var user *models.User
-	if err := database.DB.Where("email = ?", userInfo.Email).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// If the user doesn't exist, create a new user
-			user = &models.User{
-				BaseModel: models.BaseModel{
-					ID: userInfo.ID,
-				},
-				GoogleID:  userInfo.Email,
-				Email:     userInfo.Email,
-				Name:      userInfo.Name,
-				AvatarURL: userInfo.Picture,
-				Role:      cc.AuthUser().Role,
-			}
-
-			if err := database.DB.Create(&user).Error; err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to init user: %v", err)})
-			}
-		} else {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+	err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		var err error
+		if user, err = linkIdentity(tx, &identity); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Updates(map[string]interface{}{"name": userInfo.Name, "avatar_url": userInfo.Picture}).Error; err != nil {
+			return err
 		}
+		return tx.Model(user).Association("Roles").Find(&user.Roles)
+	})
+	if errors.Is(err, errEmailNotVerified) {
+		return apperror.Forbidden("Email is not verified by Cognito")
 	}
-
-	if err := database.DB.Model(&user).Updates(map[string]interface{}{"id": userInfo.ID, "name": userInfo.Name, "avatar_url": userInfo.Picture}).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user"})
+	if err != nil {
+		return apperror.Internal("Failed to init user", err)
 	}
 
 	permissions, err := GetPermissions(database.DB, user.ID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch permissions"})
+		return apperror.Internal("Failed to fetch permissions", err)
 	}
 
 	roles, err := GetRoles(database.DB, user.ID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch roles"})
+		return apperror.Internal("Failed to fetch roles", err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
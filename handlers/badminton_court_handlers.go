@@ -1,52 +1,62 @@
 package handlers
 
 import (
-	"errors"
 	"net/http"
-	"net/url"
 
-	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/auth"
 	"github.com/alanrb/badminton/backend/models"
 	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/service"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/shopspring/decimal"
 )
 
+// CourtHandler serves the badminton court endpoints
+type CourtHandler struct {
+	courts *service.CourtService
+}
+
+func NewCourtHandler(courts *service.CourtService) *CourtHandler {
+	return &CourtHandler{courts: courts}
+}
+
 // CreateBadmintonCourt creates a new badminton court
-func CreateBadmintonCourt(c echo.Context) error {
-	var court models.BadmintonCourt
-	if err := c.Bind(&court); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+func (h *CourtHandler) CreateBadmintonCourt(c echo.Context) error {
+	var request dto.BadmintonCourtRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
 
-	if len(court.GoogleMapURL) > 0 {
-		// Validate Google Map URL
-		if !validateURL(court.GoogleMapURL) {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid Google Map URL"})
-		}
+	court := models.BadmintonCourt{
+		Name:                 request.Name,
+		Address:              request.Address,
+		GoogleMapURL:         request.GoogleMapURL,
+		EstimatePricePerHour: request.EstimatePricePerHour,
+		Contact:              request.Contact,
 	}
 
-	// Validate EstimatePricePerHour
-	if court.EstimatePricePerHour.IsNegative() {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid price"})
+	cc := c.(*auth.Context)
+	if err := h.courts.Create(c.Request().Context(), cc.AuthUser().ID, &court); err != nil {
+		return apperror.Wrap(err, "Failed to create badminton court")
 	}
 
-	database.DB.Create(&court)
+	audit.Record(c, "court.create", audit.ResourceCourt, court.ID, nil, dto.ToBadmintonCourtResponse(court))
 	return c.JSON(http.StatusOK, dto.ToBadmintonCourtResponse(court))
 }
 
 // GetBadmintonCourt fetch all badminton courts
-func GetBadmintonCourts(c echo.Context) error {
-	var courts []models.BadmintonCourt
-	if err := database.DB.Find(&courts).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch badminton courts"})
+func (h *CourtHandler) GetBadmintonCourts(c echo.Context) error {
+	courts, err := h.courts.List(c.Request().Context())
+	if err != nil {
+		return apperror.Internal("Failed to fetch badminton courts", err)
 	}
 
 	// Convert courts to DTOs
 	var courtResponses []dto.BadmintonCourtResponse
 	for _, court := range courts {
-		courtResponses = append(courtResponses, dto.ToBadmintonCourtResponse(court))
+		courtResponses = append(courtResponses, dto.ToBadmintonCourtResponse(*court))
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -55,92 +65,117 @@ func GetBadmintonCourts(c echo.Context) error {
 }
 
 // GetBadmintonCourt retrieves a badminton court by ID
-func GetBadmintonCourt(c echo.Context) error {
+func (h *CourtHandler) GetBadmintonCourt(c echo.Context) error {
 	courtID, err := getCourtID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid court ID"})
+		return apperror.BadRequest("Invalid court ID")
 	}
 
-	var court models.BadmintonCourt
-	if err := database.DB.First(&court, "id = ?", courtID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Court not found"})
+	court, err := h.courts.Get(c.Request().Context(), courtID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch badminton court")
+	}
+	if notModified(c, court.Version) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
-	return c.JSON(http.StatusOK, dto.ToBadmintonCourtResponse(court))
+	return c.JSON(http.StatusOK, dto.ToBadmintonCourtResponse(*court))
 }
 
-// UpdateBadmintonCourt updates a badminton court
-func UpdateBadmintonCourt(c echo.Context) error {
-	var updateData struct {
-		Name                 string          `json:"name"`
-		Address              string          `json:"address"`
-		GoogleMapURL         string          `json:"google_map_url"`
-		EstimatePricePerHour decimal.Decimal `json:"estimate_price_per_hour"`
-		Contact              string          `json:"contact"`
+// UpdateBadmintonCourt updates a badminton court, an empty Google Map URL keeps the current one
+func (h *CourtHandler) UpdateBadmintonCourt(c echo.Context) error {
+	var updateData dto.BadmintonCourtRequest
+	if err := bind(c, &updateData); err != nil {
+		return err
 	}
-	if err := c.Bind(&updateData); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+
+	courtID, err := getCourtID(c)
+	if err != nil {
+		return apperror.BadRequest("Invalid court ID")
+	}
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+
+	changes := courtChanges(updateData)
+	if len(updateData.GoogleMapURL) == 0 {
+		changes.GoogleMapURL = nil
 	}
+	return h.update(c, courtID, precondition, changes)
+}
 
+// PatchBadmintonCourt applies a JSON Merge Patch to a badminton court, the fields missing from the patch are kept
+func (h *CourtHandler) PatchBadmintonCourt(c echo.Context) error {
 	courtID, err := getCourtID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid court ID"})
+		return err
+	}
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	var court models.BadmintonCourt
-	if err := database.DB.First(&court, "id = ?", courtID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Court not found"})
+	court, err := h.courts.Get(c.Request().Context(), courtID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch badminton court")
 	}
 
-	if len(updateData.GoogleMapURL) > 0 {
-		// Validate Google Map URL
-		if !validateURL(updateData.GoogleMapURL) {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid Google Map URL"})
-		}
-		court.GoogleMapURL = updateData.GoogleMapURL
+	var request dto.BadmintonCourtRequest
+	if err := patch(c, dto.ToBadmintonCourtRequest(court), &request); err != nil {
+		return err
 	}
+	return h.update(c, courtID, precondition, courtChanges(request))
+}
 
-	// Validate EstimatePricePerHour
-	if updateData.EstimatePricePerHour.IsNegative() {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid price"})
+func (h *CourtHandler) update(c echo.Context, courtID string, precondition service.Precondition, changes service.CourtChanges) error {
+	cc := c.(*auth.Context)
+	court, before, err := h.courts.Update(c.Request().Context(), cc.AuthUser().ID, courtID, precondition, changes)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to update badminton court")
 	}
 
-	// Update fields
-	court.Name = updateData.Name
-	court.Address = updateData.Address
-	court.EstimatePricePerHour = updateData.EstimatePricePerHour
-	court.Contact = updateData.Contact
+	audit.Record(c, "court.update", audit.ResourceCourt, court.ID, dto.ToBadmintonCourtResponse(before), dto.ToBadmintonCourtResponse(*court))
+	tag(c, court.Version)
+	return c.JSON(http.StatusOK, dto.ToBadmintonCourtResponse(*court))
+}
 
-	database.DB.Save(&court)
-	return c.JSON(http.StatusOK, dto.ToBadmintonCourtResponse(court))
+// courtChanges changes every field of a court to the ones of the request
+func courtChanges(request dto.BadmintonCourtRequest) service.CourtChanges {
+	return service.CourtChanges{
+		Name:                 request.Name,
+		Address:              request.Address,
+		GoogleMapURL:         &request.GoogleMapURL,
+		EstimatePricePerHour: request.EstimatePricePerHour,
+		Contact:              request.Contact,
+	}
 }
 
 // DeleteBadmintonCourt deletes a badminton court
-func DeleteBadmintonCourt(c echo.Context) error {
-	courtID, err := uuid.Parse(c.Param("id"))
+func (h *CourtHandler) DeleteBadmintonCourt(c echo.Context) error {
+	courtID, err := getCourtID(c)
+	if err != nil {
+		return apperror.BadRequest("Invalid court ID")
+	}
+	precondition, err := ifMatch(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid court ID"})
+		return err
 	}
 
-	var court models.BadmintonCourt
-	if err := database.DB.First(&court, "id = ?", courtID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Court not found"})
+	cc := c.(*auth.Context)
+	court, err := h.courts.Delete(c.Request().Context(), cc.AuthUser().ID, courtID, precondition)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to delete badminton court")
 	}
 
-	database.DB.Delete(&court)
+	audit.Record(c, "court.delete", audit.ResourceCourt, court.ID, dto.ToBadmintonCourtResponse(*court), nil)
 	return c.JSON(http.StatusOK, map[string]string{"message": "Court deleted"})
 }
 
-// ValidateURL checks if a string is a valid URL
-func validateURL(urlString string) bool {
-	_, err := url.ParseRequestURI(urlString)
-	return err == nil
-}
-
 func getCourtID(c echo.Context) (string, error) {
 	courtID := c.Param("id")
 	if err := uuid.Validate(courtID); err != nil {
-		return "", errors.New("invalid court ID")
+		return "", apperror.Invalid("id", "Invalid court ID")
 	}
 	return courtID, nil
 }
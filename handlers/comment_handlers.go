@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ListSessionComments lists the comment thread of a session, oldest first
+func ListSessionComments(c echo.Context) error {
+	session, err := getViewableSession(c)
+	if session == nil {
+		return err
+	}
+
+	// Get pagination parameters using the utility
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.SessionComment{}).Where("session_id = ?", session.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total comments", err)
+	}
+
+	var comments []*models.SessionComment
+	if err := query.
+		Preload("Author").
+		Preload("Mentions").
+		Order("created_at").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&comments).Error; err != nil {
+		return apperror.Internal("Failed to fetch comments", err)
+	}
+
+	// Convert comments to DTOs
+	var commentResponses = make([]*dto.CommentResponse, 0, len(comments))
+	for _, comment := range comments {
+		commentResponses = append(commentResponses, dto.ToCommentResponse(comment))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      commentResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
+
+// CreateSessionComment adds a comment to the thread of a session
+func CreateSessionComment(c echo.Context) error {
+	var request dto.CommentRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	session, err := getViewableSession(c)
+	if session == nil {
+		return err
+	}
+
+	mentions, err := findSessionMembers(database.DB, session, request.Mentions)
+	if err != nil {
+		if errors.Is(err, errInvalidMention) {
+			return apperror.BadRequest("Mentioned users must be members of the session")
+		}
+		return apperror.Internal("Failed to fetch mentioned users", err)
+	}
+
+	cc := c.(*auth.Context)
+	comment := models.SessionComment{
+		SessionID: session.ID,
+		AuthorID:  cc.AuthUser().ID,
+		Content:   request.Content,
+		Mentions:  mentions,
+	}
+	if err := database.DB.Omit("Mentions.*").Create(&comment).Error; err != nil {
+		return apperror.Internal("Failed to post comment", err)
+	}
+
+	if err := database.DB.Preload("Author").First(&comment, "id = ?", comment.ID).Error; err != nil {
+		return apperror.Internal("Failed to fetch comment", err)
+	}
+
+	return c.JSON(http.StatusCreated, dto.ToCommentResponse(&comment))
+}
+
+// UpdateSessionComment edits a comment, only its author can do so
+func UpdateSessionComment(c echo.Context) error {
+	var request dto.CommentRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	session, err := getViewableSession(c)
+	if session == nil {
+		return err
+	}
+
+	comment, err := getSessionComment(c, session.ID)
+	if comment == nil {
+		return err
+	}
+
+	cc := c.(*auth.Context)
+	canUpdate, err := authorizeComment(c, comment, session, cc.AuthUser().ID, policy.Update)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canUpdate {
+		return apperror.Forbidden("You are not the author of this comment")
+	}
+
+	mentions, err := findSessionMembers(database.DB, session, request.Mentions)
+	if err != nil {
+		if errors.Is(err, errInvalidMention) {
+			return apperror.BadRequest("Mentioned users must be members of the session")
+		}
+		return apperror.Internal("Failed to fetch mentioned users", err)
+	}
+
+	comment.Content = request.Content
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		if err := tx.Omit("Mentions").Save(comment).Error; err != nil {
+			return err
+		}
+		return tx.Model(comment).Association("Mentions").Replace(mentions)
+	}); err != nil {
+		return apperror.Internal("Failed to update comment", err)
+	}
+
+	if err := database.DB.Preload("Author").Preload("Mentions").First(comment, "id = ?", comment.ID).Error; err != nil {
+		return apperror.Internal("Failed to fetch comment", err)
+	}
+
+	return c.JSON(http.StatusOK, dto.ToCommentResponse(comment))
+}
+
+// DeleteSessionComment deletes a comment, allowed for its author, the session organizers and admins
+func DeleteSessionComment(c echo.Context) error {
+	session, err := getViewableSession(c)
+	if session == nil {
+		return err
+	}
+
+	comment, err := getSessionComment(c, session.ID)
+	if comment == nil {
+		return err
+	}
+
+	cc := c.(*auth.Context)
+	canDelete, err := authorizeComment(c, comment, session, cc.AuthUser().ID, policy.Delete)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canDelete {
+		return apperror.Forbidden("You do not have permission to delete this comment")
+	}
+
+	if err := database.DB.Delete(comment).Error; err != nil {
+		return apperror.Internal("Failed to delete comment", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Comment deleted"})
+}
+
+// getViewableSession fetches the session from the URL and checks the user can see it, following the
+// access rules of GetSessionDetails. On failure it writes the error response and returns a nil session.
+func getViewableSession(c echo.Context) (*models.Session, error) {
+	sessionID, err := getSessionID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.Session
+	if err := database.DB.First(&session, "id = ?", sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.NotFound("Session not found")
+		}
+		return nil, apperror.Internal("Failed to fetch session details", err)
+	}
+
+	cc := c.(*auth.Context)
+	canView, err := authorizeSession(c, &session, cc.AuthUser().ID, policy.View)
+	if err != nil {
+		return nil, apperror.Internal("Failed to check group membership", err)
+	}
+	if !canView {
+		return nil, apperror.Forbidden("You must be a member of the group to view this session")
+	}
+
+	return &session, nil
+}
+
+// getSessionComment fetches the comment from the URL. On failure it writes the error response and returns a nil comment.
+func getSessionComment(c echo.Context, sessionID string) (*models.SessionComment, error) {
+	commentID, err := GetParamID(c, "comment_id")
+	if err != nil {
+		return nil, apperror.BadRequest("Invalid comment ID")
+	}
+
+	var comment models.SessionComment
+	if err := database.DB.Where("id = ? AND session_id = ?", commentID, sessionID).First(&comment).Error; err != nil {
+		return nil, apperror.NotFound("Comment not found")
+	}
+
+	return &comment, nil
+}
+
+// findSessionMembers fetches the mentioned users. Group sessions accept group members,
+// other sessions accept the creator and attendees of the session.
+func findSessionMembers(db *gorm.DB, session *models.Session, userIDs []string) ([]*models.User, error) {
+	if session.GroupID != nil {
+		return findGroupMembers(db, *session.GroupID, userIDs)
+	}
+
+	ids, err := uniqueIDs(userIDs)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var users []*models.User
+	if err := db.
+		Where("users.id IN ?", ids).
+		Where("users.id = ? OR users.id IN (?)", session.CreatedBy,
+			db.Model(&models.SessionAttendee{}).Select("user_id").Where("session_id = ?", session.ID)).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	if len(users) != len(ids) {
+		return nil, errInvalidMention
+	}
+	return users, nil
+}
@@ -1,96 +1,60 @@
 package handlers
 
 import (
-	"errors"
 	"net/http"
-	"regexp"
 
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
 	"github.com/alanrb/badminton/backend/auth"
 	"github.com/alanrb/badminton/backend/database"
 	"github.com/alanrb/badminton/backend/models"
 	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/service"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
-func CreateGroup(c echo.Context) error {
+// GroupHandler serves the group and group member endpoints
+type GroupHandler struct {
+	groups *service.GroupService
+}
+
+func NewGroupHandler(groups *service.GroupService) *GroupHandler {
+	return &GroupHandler{groups: groups}
+}
+
+func (h *GroupHandler) CreateGroup(c echo.Context) error {
 	var request dto.NewGroupRequest
-	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	if err := bind(c, &request); err != nil {
+		return err
 	}
 
 	cc := c.(*auth.Context)
 
-	if len(request.Name) == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid name"})
-	}
-
-	group := models.Group{
-		OwnerID:  cc.AuthUser().ID,
-		Name:     request.Name,
-		ImageUrl: request.ImageUrl,
-		Remark:   request.Remark,
+	// Groups are private unless stated otherwise
+	if len(request.Visibility) == 0 {
+		request.Visibility = models.GroupVisibilityPrivate
 	}
 
-	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
-
-		// Save the group to the database
-		if err := tx.Create(&group).Error; err != nil {
-			return err
-		}
-
-		// Add the player to the group
-		groupMember := models.GroupMember{
-			GroupID: group.ID,
-			UserID:  group.OwnerID,
-		}
-
-		if err := tx.Create(&groupMember).Error; err != nil {
-			return err
-		}
-		return nil
-	}); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create group"})
+	group, err := h.groups.Create(c.Request().Context(), cc.AuthUser().ID, request)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to create group")
 	}
 
+	audit.Record(c, "group.create", audit.ResourceGroup, group.ID, nil, dto.ToGroupResponse(group))
 	return c.JSON(http.StatusCreated, group)
 }
 
-func ListGroups(c echo.Context) error {
+func (h *GroupHandler) ListGroups(c echo.Context) error {
 	cc := c.(*auth.Context)
-	var userID = cc.AuthUser().ID
 
 	// Get pagination parameters using the utility
 	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
 
-	// Check if the user is an admin
-	var isAdmin = IsAdmin(database.DB, userID)
-	var groups []*models.Group
-	var total int64
-
-	if isAdmin {
-		// If the user is an admin, fetch all groups with pagination
-		if err := database.DB.Model(&models.Group{}).Count(&total).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch total groups"})
-		}
-		if err := database.DB.Offset(pagination.Offset).Limit(pagination.PageSize).Preload("Members").Find(&groups).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch groups"})
-		}
-	} else {
-		// If the user is not an admin, fetch groups where the user is a member or the owner with pagination
-		if err := database.DB.Model(&models.Group{}).
-			Joins("LEFT JOIN group_members ON groups.id = group_members.group_id").
-			Where("groups.owner_id = ? OR group_members.user_id = ?", userID, userID).
-			Count(&total).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch total groups"})
-		}
-		if err := database.DB.Model(&models.Group{}).
-			Joins("LEFT JOIN group_members ON groups.id = group_members.group_id").
-			Where("groups.owner_id = ? OR group_members.user_id = ?", userID, userID).
-			Offset(pagination.Offset).Limit(pagination.PageSize).Preload("Members").Find(&groups).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch groups"})
-		}
+	groups, total, err := h.groups.List(c.Request().Context(), cc.AuthUser().ID, pagination.Offset, pagination.PageSize)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch groups")
 	}
 
 	// Convert users to DTOs
@@ -107,123 +71,205 @@ func ListGroups(c echo.Context) error {
 	})
 }
 
-func AddPlayerToGroup(c echo.Context) error {
+func (h *GroupHandler) AddPlayerToGroup(c echo.Context) error {
 	groupID, err := getGroupID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
 
-	var request struct {
-		UserEmail string `json:"user_email"`
+	var request dto.AddGroupPlayerRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
-	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+
+	cc := c.(*auth.Context)
+	member, err := h.groups.AddMember(c.Request().Context(), cc.AuthUser().ID, groupID, request.UserEmail)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to add player to group")
 	}
 
-	if len(request.UserEmail) == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Email is invalid"})
+	audit.Record(c, "group.add_member", audit.ResourceGroup, groupID, nil, memberSnapshot(member.UserID, member.Role))
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Player added to group"})
+}
+
+func (h *GroupHandler) DeleteGroup(c echo.Context) error {
+	// Get the group ID from the URL
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	if !isValidEmail(request.UserEmail) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Email is invalid"})
+	cc := c.(*auth.Context)
+	group, err := h.groups.Delete(c.Request().Context(), cc.AuthUser().ID, groupID, precondition)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to delete group")
 	}
 
-	// Check if the user making the request is the group owner
-	var group *models.Group
-	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+	audit.Record(c, "group.delete", audit.ResourceGroup, group.ID, dto.ToGroupResponse(group), nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Group deleted successfully"})
+}
+
+func (h *GroupHandler) GetGroupDetails(c echo.Context) error {
+	// Get the group ID from the URL
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
 	}
 
 	cc := c.(*auth.Context)
-	if group.OwnerID != cc.AuthUser().ID {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the group owner can add players"})
+	group, err := h.groups.Get(c.Request().Context(), cc.AuthUser().ID, groupID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch group")
+	}
+
+	// Membership changes leave the version of the group as it is, so the ETag only guards changes to the group
+	tag(c, group.Version)
+	return c.JSON(http.StatusOK, dto.ToGroupResponse(group))
+}
+
+func (h *GroupHandler) UpdateGroup(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	// Find the user by email
-	var user *models.User
-	if err := database.DB.Where("email = ?", request.UserEmail).First(&user).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	var request dto.UpdateGroupRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
+	return h.update(c, groupID, precondition, request)
+}
 
-	// Check if the user is already a member of the group
-	isMember, err := IsGroupMember(database.DB, groupID, user.ID)
+// PatchGroup applies a JSON Merge Patch to a group, the fields missing from the patch are kept
+func (h *GroupHandler) PatchGroup(c echo.Context) error {
+	groupID, err := getGroupID(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check group membership"})
+		return err
 	}
-	if isMember {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User is already a member of the group"})
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	// Add the player to the group
-	groupMember := models.GroupMember{
-		GroupID: groupID,
-		UserID:  user.ID,
+	cc := c.(*auth.Context)
+	group, err := h.groups.Get(c.Request().Context(), cc.AuthUser().ID, groupID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch group")
 	}
 
-	if err := database.DB.Create(&groupMember).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add player to group"})
+	var request dto.UpdateGroupRequest
+	if err := patch(c, dto.ToUpdateGroupRequest(group), &request); err != nil {
+		return err
 	}
+	return h.update(c, groupID, precondition, request)
+}
 
-	return c.JSON(http.StatusOK, map[string]string{"message": "Player added to group"})
+func (h *GroupHandler) update(c echo.Context, groupID string, precondition service.Precondition, request dto.UpdateGroupRequest) error {
+	cc := c.(*auth.Context)
+	group, before, err := h.groups.Update(c.Request().Context(), cc.AuthUser().ID, groupID, precondition, request)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to update group")
+	}
+
+	audit.Record(c, "group.update", audit.ResourceGroup, group.ID, dto.ToGroupResponse(&before), dto.ToGroupResponse(group))
+	tag(c, group.Version)
+	return c.JSON(http.StatusOK, dto.ToGroupResponse(group))
 }
 
-func DeleteGroup(c echo.Context) error {
-	// Get the group ID from the URL
+func (h *GroupHandler) RemoveGroupMember(c echo.Context) error {
 	groupID, err := getGroupID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
 
-	// Check if the user has permission to delete the group
-	cc := c.(*auth.Context)
-	userID := cc.AuthUser().ID
-	isAdmin := IsAdmin(database.DB, userID)
+	memberID, err := GetParamID(c, "user_id")
+	if err != nil {
+		return apperror.BadRequest("Invalid user ID")
+	}
 
-	var group models.Group
-	if err := database.DB.Where("id = ?", groupID).First(&group).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+	cc := c.(*auth.Context)
+	if err := h.groups.RemoveMember(c.Request().Context(), cc.AuthUser().ID, groupID, memberID); err != nil {
+		return apperror.Wrap(err, "Failed to remove member")
 	}
 
-	// Only the group owner or admin can delete the group
-	if group.OwnerID != userID && !isAdmin {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "You do not have permission to delete this group"})
+	audit.Record(c, "group.remove_member", audit.ResourceGroup, groupID, map[string]string{"user_id": memberID}, nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Member removed from group"})
+}
+
+func (h *GroupHandler) LeaveGroup(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
 	}
 
-	// Delete the group
-	if err := database.DB.Delete(&group).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete group"})
+	cc := c.(*auth.Context)
+	userID := cc.AuthUser().ID
+	if err := h.groups.Leave(c.Request().Context(), userID, groupID); err != nil {
+		return apperror.Wrap(err, "Failed to leave group")
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"message": "Group deleted successfully"})
+	audit.Record(c, "group.leave", audit.ResourceGroup, groupID, map[string]string{"user_id": userID}, nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Left group"})
 }
 
-func GetGroupDetails(c echo.Context) error {
-	// Get the group ID from the URL
+func (h *GroupHandler) TransferGroupOwnership(c echo.Context) error {
 	groupID, err := getGroupID(c)
 	if err != nil {
 		return err
 	}
 
+	var request dto.TransferGroupOwnershipRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
 	cc := c.(*auth.Context)
-	isAdmin := IsAdmin(database.DB, cc.AuthUser().ID)
+	group, before, err := h.groups.TransferOwnership(c.Request().Context(), cc.AuthUser().ID, groupID, request.UserID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to transfer ownership")
+	}
+
+	audit.Record(c, "group.transfer_ownership", audit.ResourceGroup, group.ID, dto.ToGroupResponse(&before), dto.ToGroupResponse(group))
+	return c.JSON(http.StatusOK, dto.ToGroupResponse(group))
+}
 
-	// Check if the user is a member of the group
-	isMember, err := IsGroupMember(database.DB, groupID, cc.AuthUser().ID)
+func (h *GroupHandler) UpdateGroupMemberRole(c echo.Context) error {
+	groupID, err := getGroupID(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check group membership"})
+		return err
 	}
 
-	if !isMember && !isAdmin {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "You are not a member of this group"})
+	memberID, err := GetParamID(c, "user_id")
+	if err != nil {
+		return apperror.BadRequest("Invalid user ID")
 	}
 
-	// Fetch the group from the database
-	var group *models.Group
-	if err := database.DB.Preload("Members").First(&group, "id = ?", groupID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+	// Ownership changes hands through TransferGroupOwnership
+	var request dto.UpdateGroupMemberRoleRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusOK, dto.ToGroupResponse(group))
+	cc := c.(*auth.Context)
+	previousRole, err := h.groups.UpdateMemberRole(c.Request().Context(), cc.AuthUser().ID, groupID, memberID, request.Role)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to update member role")
+	}
+
+	audit.Record(c, "group.member_role", audit.ResourceGroup, groupID, memberSnapshot(memberID, previousRole), memberSnapshot(memberID, request.Role))
+	return c.JSON(http.StatusOK, map[string]string{"message": "Member role updated"})
 }
 
 // IsGroupMember checks if a user is a member of a group
@@ -238,17 +284,15 @@ func IsGroupMember(db *gorm.DB, groupID string, userID string) (bool, error) {
 	return count > 0, nil
 }
 
+// memberSnapshot describes a group member for the audit log
+func memberSnapshot(userID string, role string) map[string]string {
+	return map[string]string{"user_id": userID, "group_role": role}
+}
+
 func getGroupID(c echo.Context) (string, error) {
 	groupID := c.Param("group_id")
 	if err := uuid.Validate(groupID); err != nil {
-		return "", errors.New("invalid group ID")
+		return "", apperror.Invalid("group_id", "Invalid group ID")
 	}
 	return groupID, nil
 }
-
-func isValidEmail(email string) bool {
-	// Regular expression for basic email validation
-	// This is a simple regex and may not cover all edge cases
-	emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
-	return regexp.MustCompile(emailRegex).MatchString(email)
-}
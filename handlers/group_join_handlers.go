@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListGroupDirectory lists discoverable and open groups, optionally filtered by name
+func ListGroupDirectory(c echo.Context) error {
+	// Get pagination parameters using the utility
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.Group{}).
+		Where("groups.visibility IN ?", []string{models.GroupVisibilityDiscoverable, models.GroupVisibilityOpen})
+
+	if search := c.QueryParam("q"); len(search) > 0 {
+		query = query.Where("groups.name ILIKE ?", "%"+search+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total groups", err)
+	}
+
+	var groups []struct {
+		models.Group
+		MemberCount int64
+	}
+	if err := query.
+		Select("groups.*, (SELECT COUNT(*) FROM group_members WHERE group_members.group_id = groups.id) AS member_count").
+		Order("groups.name").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&groups).Error; err != nil {
+		return apperror.Internal("Failed to fetch groups", err)
+	}
+
+	// Convert groups to DTOs
+	var groupResponses = make([]*dto.GroupDirectoryResponse, 0, len(groups))
+	for _, group := range groups {
+		groupResponses = append(groupResponses, &dto.GroupDirectoryResponse{
+			ID:          group.ID,
+			Name:        group.Name,
+			ImageUrl:    group.ImageUrl,
+			Remark:      group.Remark,
+			Visibility:  group.Visibility,
+			MemberCount: group.MemberCount,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      groupResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
+
+// JoinGroup joins an open group instantly or requests to join a discoverable group
+func JoinGroup(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	var request dto.JoinGroupRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	cc := c.(*auth.Context)
+	userID := cc.AuthUser().ID
+
+	// Private groups are not visible to non-members
+	var group *models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil || !group.IsListed() {
+		return apperror.NotFound("Group not found")
+	}
+
+	// Check if the user is already a member of the group
+	isMember, err := IsGroupMember(database.DB, groupID, userID)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if isMember {
+		return apperror.BadRequest("You are already a member of the group")
+	}
+
+	// Open groups allow joining without approval
+	if group.Visibility == models.GroupVisibilityOpen {
+		groupMember := models.GroupMember{
+			GroupID: groupID,
+			UserID:  userID,
+			Role:    models.GroupRoleMember,
+		}
+		if err := database.DB.Create(&groupMember).Error; err != nil {
+			return apperror.Internal("Failed to join group", err)
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Joined group"})
+	}
+
+	// Only one pending request per user and group
+	var pending int64
+	if err := database.DB.Model(&models.GroupJoinRequest{}).
+		Where("group_id = ? AND user_id = ? AND status = ?", groupID, userID, models.ApprovalStatusPending).
+		Count(&pending).Error; err != nil {
+		return apperror.Internal("Failed to check join requests", err)
+	}
+	if pending > 0 {
+		return apperror.BadRequest("You already have a pending request for this group")
+	}
+
+	joinRequest := models.GroupJoinRequest{
+		GroupID: groupID,
+		UserID:  userID,
+		Status:  models.ApprovalStatusPending,
+		Message: request.Message,
+	}
+	if err := database.DB.Create(&joinRequest).Error; err != nil {
+		return apperror.Internal("Failed to request to join group", err)
+	}
+
+	return c.JSON(http.StatusCreated, dto.ToGroupJoinRequestResponse(&joinRequest))
+}
+
+// CancelJoinRequest withdraws the current user's pending request to join a group
+func CancelJoinRequest(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	cc := c.(*auth.Context)
+
+	result := database.DB.
+		Where("group_id = ? AND user_id = ? AND status = ?", groupID, cc.AuthUser().ID, models.ApprovalStatusPending).
+		Delete(&models.GroupJoinRequest{})
+	if result.Error != nil {
+		return apperror.Internal("Failed to cancel join request", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("Join request not found")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Join request canceled"})
+}
+
+// ListGroupJoinRequests lists the join requests of a group for its owner
+func ListGroupJoinRequests(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	var group *models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return apperror.NotFound("Group not found")
+	}
+
+	cc := c.(*auth.Context)
+	canReview, err := authorizeGroup(c, group, cc.AuthUser().ID, policy.ReviewJoinRequests)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canReview {
+		return apperror.Forbidden("Only group organizers can view join requests")
+	}
+
+	status := models.ApprovalStatus(c.QueryParam("status"))
+	switch status {
+	case "":
+		status = models.ApprovalStatusPending
+	case models.ApprovalStatusPending, models.ApprovalStatusApproved, models.ApprovalStatusRejected:
+	default:
+		return apperror.Invalid("status", "Invalid status")
+	}
+
+	// Get pagination parameters using the utility
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.GroupJoinRequest{}).Where("group_id = ? AND status = ?", groupID, status)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total join requests", err)
+	}
+
+	var requests []*models.GroupJoinRequest
+	if err := query.
+		Preload("User").
+		Order("created_at").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&requests).Error; err != nil {
+		return apperror.Internal("Failed to fetch join requests", err)
+	}
+
+	// Convert join requests to DTOs
+	var requestResponses = make([]*dto.GroupJoinRequestResponse, 0, len(requests))
+	for _, request := range requests {
+		requestResponses = append(requestResponses, dto.ToGroupJoinRequestResponse(request))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      requestResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
+
+// ReviewGroupJoinRequest approves or rejects a pending join request
+func ReviewGroupJoinRequest(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	requestID, err := GetParamID(c, "request_id")
+	if err != nil {
+		return apperror.BadRequest("Invalid join request ID")
+	}
+
+	var request dto.ReviewJoinRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+	status := models.ApprovalStatus(request.Status)
+
+	var group *models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return apperror.NotFound("Group not found")
+	}
+
+	cc := c.(*auth.Context)
+	canReview, err := authorizeGroup(c, group, cc.AuthUser().ID, policy.ReviewJoinRequests)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canReview {
+		return apperror.Forbidden("Only group organizers can review join requests")
+	}
+
+	var joinRequest models.GroupJoinRequest
+	errNotPending := errors.New("join request is not pending")
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		// Locked so concurrent reviews of the request wait for each other and only the first one applies
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND group_id = ?", requestID, groupID).First(&joinRequest).Error; err != nil {
+			return err
+		}
+
+		if joinRequest.Status != models.ApprovalStatusPending {
+			return errNotPending
+		}
+
+		joinRequest.Status = status
+		if err := tx.Save(&joinRequest).Error; err != nil {
+			return err
+		}
+
+		if status == models.ApprovalStatusApproved {
+			// The user may have been added by the owner in the meantime
+			groupMember := models.GroupMember{
+				GroupID: groupID,
+				UserID:  joinRequest.UserID,
+				Role:    models.GroupRoleMember,
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&groupMember).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return apperror.NotFound("Join request not found")
+		case errors.Is(err, errNotPending):
+			return apperror.BadRequest("Join request has already been reviewed")
+		default:
+			return apperror.Internal("Failed to review join request", err)
+		}
+	}
+
+	audit.Record(c, "group.review_join_request", audit.ResourceGroup, groupID,
+		map[string]string{"join_request_id": joinRequest.ID, "user_id": joinRequest.UserID, "status": string(models.ApprovalStatusPending)},
+		map[string]string{"join_request_id": joinRequest.ID, "user_id": joinRequest.UserID, "status": string(joinRequest.Status)})
+	return c.JSON(http.StatusOK, dto.ToGroupJoinRequestResponse(&joinRequest))
+}
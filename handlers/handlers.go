@@ -1,8 +1,14 @@
 package handlers
 
 import (
-	"errors"
+	"encoding/json"
+	"io"
+	"mime"
 
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/etag"
+	"github.com/alanrb/badminton/backend/mergepatch"
+	"github.com/alanrb/badminton/backend/service"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
@@ -10,7 +16,67 @@ import (
 func GetParamID(c echo.Context, param string) (string, error) {
 	id := c.Param(param)
 	if err := uuid.Validate(id); err != nil {
-		return "", errors.New("invalid ID")
+		return "", apperror.Invalid(param, "Invalid ID")
 	}
 	return id, nil
 }
+
+// bind binds the request and checks it against its rules, see the validate package
+func bind(c echo.Context, request interface{}) error {
+	if err := c.Bind(request); err != nil {
+		return apperror.Bind(err)
+	}
+	return c.Validate(request)
+}
+
+// patch applies the JSON Merge Patch of the request body to the current state of a resource, decoding the patched
+// resource into request and checking it against its rules. Fields missing from the patch keep their current value.
+func patch(c echo.Context, current interface{}, request interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != mergepatch.MIMEMergePatch && mediaType != echo.MIMEApplicationJSON {
+		return apperror.Bind(echo.ErrUnsupportedMediaType)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return apperror.Bind(err)
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return apperror.Internal("Failed to apply patch", err)
+	}
+	patched, err := mergepatch.Apply(doc, body)
+	if err != nil {
+		return apperror.Bind(err)
+	}
+	if err := json.Unmarshal(patched, request); err != nil {
+		return apperror.Bind(err)
+	}
+	return c.Validate(request)
+}
+
+// ifMatch takes the precondition of a change from the If-Match header. Changes must carry it, so they never
+// overwrite a resource changed since it was fetched.
+func ifMatch(c echo.Context) (service.Precondition, error) {
+	header := c.Request().Header.Get(etag.HeaderIfMatch)
+	if len(header) == 0 {
+		return nil, apperror.PreconditionRequired("If-Match header is required")
+	}
+	return func(version int64) bool {
+		return etag.Match(header, version)
+	}, nil
+}
+
+// tag sets the ETag of the responded resource to its version
+func tag(c echo.Context, version int64) {
+	c.Response().Header().Set(etag.HeaderETag, etag.Format(version))
+}
+
+// notModified tags the responded resource and tells whether the client already holds its version, as the
+// If-None-Match header names it
+func notModified(c echo.Context, version int64) bool {
+	tag(c, version)
+	header := c.Request().Header.Get(etag.HeaderIfNoneMatch)
+	return len(header) > 0 && !etag.NoneMatch(header, version)
+}
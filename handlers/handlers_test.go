@@ -0,0 +1,597 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/etag"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/repository/memory"
+	"github.com/alanrb/badminton/backend/service"
+	"github.com/alanrb/badminton/backend/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+// call runs a handler as the user through the router, with the path parameters given as name and value pairs
+func call(t *testing.T, handler echo.HandlerFunc, user *models.User, method string, body string, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	return callWith(t, handler, user, method, body, nil, params...)
+}
+
+// callWith runs a handler like call, sending the headers along
+func callWith(t *testing.T, handler echo.HandlerFunc, user *models.User, method string, body string, header http.Header, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	route, target := "/", "/"
+	for i := 0; i+1 < len(params); i += 2 {
+		route += ":" + params[i] + "/"
+		target += params[i+1] + "/"
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.Handler
+	e.Validator = validate.Validator{}
+	e.Add(method, route, func(c echo.Context) error {
+		cc := &auth.Context{Context: c}
+		cc.SetAuthUser(&models.AuthUser{ID: user.ID})
+		return handler(cc)
+	})
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// matching is the If-Match header of a change made to a version
+func matching(version int64) http.Header {
+	return http.Header{etag.HeaderIfMatch: {etag.Format(version)}}
+}
+
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, message string) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("expected %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+	var body apperror.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != message {
+		t.Errorf("expected error %q, got %q", message, body.Error)
+	}
+}
+
+// groupFixture creates a group of the owner with members
+func groupFixture(t *testing.T, store *memory.Store, owner *models.User, members ...*models.User) *models.Group {
+	t.Helper()
+
+	ctx := context.Background()
+	group := &models.Group{Name: "Thursday club", OwnerID: owner.ID, Visibility: models.GroupVisibilityPrivate}
+	if err := store.Groups().Create(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Groups().AddMember(ctx, &models.GroupMember{GroupID: group.ID, UserID: owner.ID, Role: models.GroupRoleOwner}); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range members {
+		if err := store.Groups().AddMember(ctx, &models.GroupMember{GroupID: group.ID, UserID: member.ID, Role: models.GroupRoleMember}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return group
+}
+
+// sessionFixture creates an open session of a group taking place tomorrow
+func sessionFixture(t *testing.T, store *memory.Store, group *models.Group, maxMembers int) *models.Session {
+	t.Helper()
+
+	dateTime := time.Now().Add(24 * time.Hour)
+	session := &models.Session{
+		CreatedBy:  group.OwnerID,
+		GroupID:    &group.ID,
+		Status:     models.SessionStatusOpen,
+		MaxMembers: maxMembers,
+		DateTime:   &dateTime,
+	}
+	if err := store.Sessions().Create(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestAttendSessionEnforcesCapacityAndMembership(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	member := store.AddUser(&models.User{Name: "Member", Email: "member@example.com"}, models.UserRolePlayer)
+	late := store.AddUser(&models.User{Name: "Late", Email: "late@example.com"}, models.UserRolePlayer)
+	outsider := store.AddUser(&models.User{Name: "Outsider", Email: "outsider@example.com"}, models.UserRolePlayer)
+	group := groupFixture(t, store, owner, member, late)
+	session := sessionFixture(t, store, group, 3)
+
+	h := NewSessionHandler(service.NewSessionService(store))
+
+	expectError(t, call(t, h.AttendSession, outsider, http.MethodPost, `{"slot": 1}`, "session_id", session.ID),
+		http.StatusForbidden, "Only group members can attend this session")
+
+	if rec := call(t, h.AttendSession, member, http.MethodPost, `{"slot": 2}`, "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	expectError(t, call(t, h.AttendSession, member, http.MethodPost, `{"slot": 1}`, "session_id", session.ID),
+		http.StatusBadRequest, "User is already attending this session")
+	expectError(t, call(t, h.AttendSession, late, http.MethodPost, `{"slot": 2}`, "session_id", session.ID),
+		http.StatusBadRequest, "Session is full: max members is 3")
+
+	if rec := call(t, h.AttendSession, late, http.MethodPost, `{"slot": 1}`, "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	slots, err := store.Sessions().ApprovedSlots(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slots != 3 {
+		t.Errorf("expected 3 approved slots, got %d", slots)
+	}
+}
+
+// The memory store runs Atomic calls one at a time, so this only checks the capacity rules of racing attendees. The row
+// lock keeping them apart in Postgres is covered by TestConcurrentJoinsRespectCapacity in the integration tests.
+func TestRacingAttendeesFillTheSessionExactly(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	players := make([]*models.User, 20)
+	for i := range players {
+		players[i] = store.AddUser(&models.User{Name: fmt.Sprintf("Player %d", i), Email: fmt.Sprintf("player%d@example.com", i)}, models.UserRolePlayer)
+	}
+	session := sessionFixture(t, store, groupFixture(t, store, owner, players...), 5)
+
+	h := NewSessionHandler(service.NewSessionService(store))
+
+	codes := make([]int, len(players))
+	var wg sync.WaitGroup
+	for i, player := range players {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = call(t, h.AttendSession, player, http.MethodPost, `{"slot": 1}`, "session_id", session.ID).Code
+		}()
+	}
+	wg.Wait()
+
+	joined := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			joined++
+		}
+	}
+	slots, err := store.Sessions().ApprovedSlots(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joined != 5 || slots != 5 {
+		t.Errorf("expected 5 players to join taking 5 slots, got %d taking %d", joined, slots)
+	}
+}
+
+func TestSessionRequestsAreValidated(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	group := groupFixture(t, store, owner)
+	session := sessionFixture(t, store, group, 4)
+	session.Description = "Doubles night"
+	if err := store.Sessions().Update(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewSessionHandler(service.NewSessionService(store))
+
+	tomorrow, _ := json.Marshal(time.Now().Add(24 * time.Hour))
+	yesterday, _ := json.Marshal(time.Now().Add(-24 * time.Hour))
+	expectError(t, call(t, h.CreateSession, owner, http.MethodPost, `{"max_members": 4, "date_time": `+string(yesterday)+`}`),
+		http.StatusBadRequest, "Invalid DateTime")
+	expectError(t, call(t, h.CreateSession, owner, http.MethodPost, `{"max_members": 0, "date_time": `+string(tomorrow)+`}`),
+		http.StatusBadRequest, "Invalid max members")
+	expectError(t, call(t, h.AttendSession, owner, http.MethodPost, `{"slot": 0}`, "session_id", session.ID),
+		http.StatusBadRequest, "Invalid Slot")
+
+	// Fields missing from an update are left as they are
+	if rec := callWith(t, h.UpdateSession, owner, http.MethodPut, `{"max_members": 6}`, matching(session.Version), "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	updated, err := store.Sessions().FindByID(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.MaxMembers != 6 || updated.Description != "Doubles night" {
+		t.Errorf("expected 6 members and the description kept, got %d %q", updated.MaxMembers, updated.Description)
+	}
+}
+
+func TestGetSessionsHidesOtherGroups(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	outsider := store.AddUser(&models.User{Name: "Outsider", Email: "outsider@example.com"}, models.UserRolePlayer)
+	admin := store.AddUser(&models.User{Name: "Admin", Email: "admin@example.com"}, models.UserRoleAdmin)
+	sessionFixture(t, store, groupFixture(t, store, owner), 4)
+
+	h := NewSessionHandler(service.NewSessionService(store))
+
+	for _, test := range []struct {
+		user  *models.User
+		total int
+	}{
+		{owner, 1},
+		{outsider, 0},
+		{admin, 1},
+	} {
+		rec := call(t, h.GetSessions, test.user, http.MethodGet, "")
+		var body struct {
+			Total int `json:"total"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Total != test.total {
+			t.Errorf("%s: expected %d sessions, got %d", test.user.Name, test.total, body.Total)
+		}
+	}
+}
+
+func TestUpdateAttendeeStatusRespectsCapacity(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	member := store.AddUser(&models.User{Name: "Member", Email: "member@example.com"}, models.UserRolePlayer)
+	waiting := store.AddUser(&models.User{Name: "Waiting", Email: "waiting@example.com"}, models.UserRolePlayer)
+	group := groupFixture(t, store, owner, member, waiting)
+	session := sessionFixture(t, store, group, 2)
+
+	ctx := context.Background()
+	for _, attendee := range []*models.SessionAttendee{
+		{SessionID: session.ID, UserID: member.ID, Slot: 2, Status: models.ApprovalStatusApproved},
+		{SessionID: session.ID, UserID: waiting.ID, Slot: 1, Status: models.ApprovalStatusPending},
+	} {
+		if err := store.Sessions().AddAttendee(ctx, attendee); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewSessionHandler(service.NewSessionService(store))
+
+	expectError(t, call(t, h.UpdateAttendeeStatus, member, http.MethodPut, `{"status": "approved"}`, "session_id", session.ID, "user_id", waiting.ID),
+		http.StatusForbidden, "Only session organizers can approve attendees")
+	expectError(t, call(t, h.UpdateAttendeeStatus, owner, http.MethodPut, `{"status": "approved"}`, "session_id", session.ID, "user_id", waiting.ID),
+		http.StatusBadRequest, "Session is full: max members is 2")
+
+	attendee, err := store.Sessions().FindAttendee(ctx, session.ID, waiting.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attendee.Status != models.ApprovalStatusPending {
+		t.Errorf("expected the attendee to stay pending, got %s", attendee.Status)
+	}
+}
+
+func TestLeaveGroupReleasesUpcomingSlots(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	member := store.AddUser(&models.User{Name: "Member", Email: "member@example.com"}, models.UserRolePlayer)
+	group := groupFixture(t, store, owner, member)
+	session := sessionFixture(t, store, group, 4)
+
+	ctx := context.Background()
+	if err := store.Sessions().AddAttendee(ctx, &models.SessionAttendee{SessionID: session.ID, UserID: member.ID, Slot: 2, Status: models.ApprovalStatusApproved}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewGroupHandler(service.NewGroupService(store))
+
+	expectError(t, call(t, h.LeaveGroup, owner, http.MethodPost, "", "group_id", group.ID),
+		http.StatusBadRequest, "The group owner cannot leave, transfer ownership first")
+
+	if rec := call(t, h.LeaveGroup, member, http.MethodPost, "", "group_id", group.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if role, _ := store.Groups().MemberRole(ctx, group.ID, member.ID); len(role) > 0 {
+		t.Errorf("expected the member to have left, still %s", role)
+	}
+	if slots, _ := store.Sessions().ApprovedSlots(ctx, session.ID); slots != 0 {
+		t.Errorf("expected the slots to be released, %d still taken", slots)
+	}
+
+	expectError(t, call(t, h.LeaveGroup, member, http.MethodPost, "", "group_id", group.ID),
+		http.StatusNotFound, "You are not a member of the group")
+}
+
+func TestTransferGroupOwnership(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	member := store.AddUser(&models.User{Name: "Member", Email: "member@example.com"}, models.UserRolePlayer)
+	outsider := store.AddUser(&models.User{Name: "Outsider", Email: "outsider@example.com"}, models.UserRolePlayer)
+	group := groupFixture(t, store, owner, member)
+
+	h := NewGroupHandler(service.NewGroupService(store))
+
+	expectError(t, call(t, h.TransferGroupOwnership, member, http.MethodPut, `{"user_id": "`+member.ID+`"}`, "group_id", group.ID),
+		http.StatusForbidden, "Only the group owner can transfer ownership")
+	expectError(t, call(t, h.TransferGroupOwnership, owner, http.MethodPut, `{"user_id": "`+outsider.ID+`"}`, "group_id", group.ID),
+		http.StatusBadRequest, "The new owner must be a member of the group")
+
+	if rec := call(t, h.TransferGroupOwnership, owner, http.MethodPut, `{"user_id": "`+member.ID+`"}`, "group_id", group.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx := context.Background()
+	updated, err := store.Groups().FindByID(ctx, group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.OwnerID != member.ID {
+		t.Errorf("expected %s to own the group, got %s", member.ID, updated.OwnerID)
+	}
+	for user, expected := range map[*models.User]string{owner: models.GroupRoleCoOrganizer, member: models.GroupRoleOwner} {
+		if role, _ := store.Groups().MemberRole(ctx, group.ID, user.ID); role != expected {
+			t.Errorf("%s: expected role %s, got %s", user.Name, expected, role)
+		}
+	}
+}
+
+func TestCourtsAreManagedByAdmins(t *testing.T) {
+	store := memory.NewStore()
+	player := store.AddUser(&models.User{Name: "Player", Email: "player@example.com"}, models.UserRolePlayer)
+	admin := store.AddUser(&models.User{Name: "Admin", Email: "admin@example.com"}, models.UserRoleAdmin)
+
+	h := NewCourtHandler(service.NewCourtService(store))
+	body := `{"name": "Hall A", "address": "1 Court Road", "estimate_price_per_hour": "12.5"}`
+
+	expectError(t, call(t, h.CreateBadmintonCourt, player, http.MethodPost, body),
+		http.StatusForbidden, "Only admins can manage courts")
+
+	rec := call(t, h.CreateBadmintonCourt, admin, http.MethodPost, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var court struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &court); err != nil {
+		t.Fatal(err)
+	}
+
+	expectError(t, callWith(t, h.DeleteBadmintonCourt, player, http.MethodDelete, "", matching(1), "id", court.ID),
+		http.StatusForbidden, "Only admins can manage courts")
+	if rec := callWith(t, h.DeleteBadmintonCourt, admin, http.MethodDelete, "", matching(1), "id", court.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	expectError(t, call(t, h.GetBadmintonCourt, player, http.MethodGet, "", "id", court.ID),
+		http.StatusNotFound, "Court not found")
+}
+
+func TestPatchOnlyChangesSuppliedFields(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	admin := store.AddUser(&models.User{Name: "Admin", Email: "admin@example.com"}, models.UserRoleAdmin)
+
+	court := &models.BadmintonCourt{Name: "Hall A", Address: "1 Court Road", GoogleMapURL: "https://maps.google.com/?q=hall+a"}
+	if err := store.Courts().Create(context.Background(), court); err != nil {
+		t.Fatal(err)
+	}
+
+	courts := NewCourtHandler(service.NewCourtService(store))
+	rec := callWith(t, courts.PatchBadmintonCourt, admin, http.MethodPatch, `{"estimate_price_per_hour": "15", "google_map_url": null}`, matching(court.Version), "id", court.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	patched, err := store.Courts().FindByID(context.Background(), court.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Name != "Hall A" || patched.Address != "1 Court Road" || patched.GoogleMapURL != "" || patched.EstimatePricePerHour.String() != "15" {
+		t.Errorf("expected the price set and the map URL removed, got %+v", patched)
+	}
+	expectError(t, callWith(t, courts.PatchBadmintonCourt, admin, http.MethodPatch, `{"name": null}`, matching(patched.Version), "id", court.ID),
+		http.StatusBadRequest, "Invalid name")
+
+	session := sessionFixture(t, store, groupFixture(t, store, owner), 4)
+	sessions := NewSessionHandler(service.NewSessionService(store))
+	if rec := callWith(t, sessions.PatchSession, owner, http.MethodPatch, `{"description": "Doubles night"}`, matching(session.Version), "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	expectError(t, callWith(t, sessions.PatchSession, owner, http.MethodPatch, `{"max_members": 0}`, matching(session.Version+1), "session_id", session.ID),
+		http.StatusBadRequest, "Invalid max members")
+
+	updated, err := store.Sessions().FindByID(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Description != "Doubles night" || updated.MaxMembers != 4 {
+		t.Errorf("expected only the description to change, got %q %d", updated.Description, updated.MaxMembers)
+	}
+
+	// Sessions that took place are still costed, only moving them must be to an upcoming time
+	yesterday := time.Now().Add(-24 * time.Hour)
+	updated.DateTime = &yesterday
+	if err := store.Sessions().Update(context.Background(), updated); err != nil {
+		t.Fatal(err)
+	}
+	if rec := callWith(t, sessions.PatchSession, owner, http.MethodPatch, `{"cost": "120"}`, matching(updated.Version), "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	earlier, _ := json.Marshal(yesterday.Add(-time.Hour))
+	expectError(t, callWith(t, sessions.PatchSession, owner, http.MethodPatch, `{"date_time": `+string(earlier)+`}`, matching(updated.Version+1), "session_id", session.ID),
+		http.StatusBadRequest, "Invalid DateTime")
+}
+
+func TestSessionChangesRequireTheFetchedVersion(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	member := store.AddUser(&models.User{Name: "Member", Email: "member@example.com"}, models.UserRolePlayer)
+	session := sessionFixture(t, store, groupFixture(t, store, owner, member), 4)
+
+	h := NewSessionHandler(service.NewSessionService(store))
+
+	fetched := call(t, h.GetSessionDetails, owner, http.MethodGet, "", "session_id", session.ID)
+	if fetched.Code != http.StatusOK || fetched.Header().Get(etag.HeaderETag) != etag.Format(session.Version) {
+		t.Fatalf("expected 200 tagged %s, got %d tagged %s", etag.Format(session.Version), fetched.Code, fetched.Header().Get(etag.HeaderETag))
+	}
+	unchanged := http.Header{etag.HeaderIfNoneMatch: {fetched.Header().Get(etag.HeaderETag)}}
+	if rec := callWith(t, h.GetSessionDetails, owner, http.MethodGet, "", unchanged, "session_id", session.ID); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 304, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Attending changes the session
+	if rec := call(t, h.AttendSession, member, http.MethodPost, `{"slot": 1}`, "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := callWith(t, h.GetSessionDetails, owner, http.MethodGet, "", unchanged, "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	expectError(t, call(t, h.UpdateSession, owner, http.MethodPut, `{"max_members": 6}`, "session_id", session.ID),
+		http.StatusPreconditionRequired, "If-Match header is required")
+	expectError(t, callWith(t, h.UpdateSession, owner, http.MethodPut, `{"max_members": 6}`, matching(session.Version), "session_id", session.ID),
+		http.StatusPreconditionFailed, "Session changed since it was fetched")
+	expectError(t, callWith(t, h.DeleteSession, owner, http.MethodDelete, "", matching(session.Version), "session_id", session.ID),
+		http.StatusPreconditionFailed, "Session changed since it was fetched")
+
+	rec := callWith(t, h.UpdateSession, owner, http.MethodPut, `{"max_members": 6}`, matching(session.Version+1), "session_id", session.ID)
+	if rec.Code != http.StatusOK || rec.Header().Get(etag.HeaderETag) != etag.Format(session.Version+2) {
+		t.Fatalf("expected 200 tagged %s, got %d tagged %s", etag.Format(session.Version+2), rec.Code, rec.Header().Get(etag.HeaderETag))
+	}
+	if rec := callWith(t, h.DeleteSession, owner, http.MethodDelete, "", matching(session.Version+2), "session_id", session.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUserRolesAreChangedByAdmins(t *testing.T) {
+	store := memory.NewStore()
+	store.AddRole(&models.Role{Name: models.UserRoleGroupOwner, Priority: 50}, "create_groups", "edit_groups")
+	player := store.AddUser(&models.User{Name: "Player", Email: "player@example.com"}, models.UserRolePlayer)
+	admin := store.AddUser(&models.User{Name: "Admin", Email: "admin@example.com"}, models.UserRoleAdmin)
+
+	h := NewUserHandler(service.NewUserService(store))
+
+	expectError(t, call(t, h.UpdateUser, player, http.MethodPut, `{"roles": ["group_owner"]}`, "user_id", player.ID),
+		http.StatusForbidden, "Only admins can update user roles")
+	expectError(t, call(t, h.UpdateUser, admin, http.MethodPut, `{"roles": ["captain"]}`, "user_id", player.ID),
+		http.StatusBadRequest, "Invalid role: captain")
+
+	// Patching the avatar alone leaves the roles to admins
+	if rec := call(t, h.PatchUser, player, http.MethodPatch, `{"avatar_url": "https://example.com/me.png"}`, "user_id", player.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := call(t, h.UpdateUser, admin, http.MethodPut, `{"roles": ["group_owner", "player"]}`, "user_id", player.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := call(t, h.GetUser, admin, http.MethodGet, "", "user_id", player.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var profile struct {
+		User struct {
+			AvatarURL string `json:"avatar_url"`
+		} `json:"user"`
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.User.AvatarURL != "https://example.com/me.png" || strings.Join(profile.Roles, ",") != "group_owner,player" ||
+		strings.Join(profile.Permissions, ",") != "create_groups,edit_groups" {
+		t.Errorf("expected the avatar and roles to change, got %s", rec.Body.String())
+	}
+
+	// Access tokens carrying the previous roles are refused
+	user, err := store.Users().FindByID(context.Background(), player.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PermissionVersion != player.PermissionVersion+1 {
+		t.Errorf("expected the permission version to move on from %d, got %d", player.PermissionVersion, user.PermissionVersion)
+	}
+
+	expectError(t, call(t, h.GetUser, admin, http.MethodGet, "", "user_id", "8a1c5b53-6c1e-4d8c-9a4e-2f8f6f0b0c11"),
+		http.StatusNotFound, "User not found")
+}
+
+func TestCompletedSessionsArePaidFromTheWallet(t *testing.T) {
+	store := memory.NewStore()
+	owner := store.AddUser(&models.User{Name: "Owner", Email: "owner@example.com"}, models.UserRoleGroupOwner)
+	admin := store.AddUser(&models.User{Name: "Admin", Email: "admin@example.com"}, models.UserRoleAdmin)
+	member := store.AddUser(&models.User{Name: "Member", Email: "member@example.com"}, models.UserRolePlayer)
+	group := groupFixture(t, store, owner, member)
+
+	ctx := context.Background()
+	session := sessionFixture(t, store, group, 4)
+	session.Cost = decimal.NewFromInt(30)
+	session.CostSplit = models.SessionCostSplitAttendees
+	if err := store.Sessions().Update(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	for user, slot := range map[*models.User]int{owner: 1, member: 2} {
+		if err := store.Sessions().AddAttendee(ctx, &models.SessionAttendee{SessionID: session.ID, UserID: user.ID, Slot: slot, Status: models.ApprovalStatusApproved}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session, err := store.Sessions().FindByID(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewSessionHandler(service.NewSessionService(store))
+
+	expectError(t, call(t, h.UpdateSessionStatus, admin, http.MethodPut, `{"status": "completed"}`, "session_id", session.ID),
+		http.StatusPreconditionRequired, "If-Match header is required")
+	expectError(t, callWith(t, h.UpdateSessionStatus, admin, http.MethodPut, `{"status": "open"}`, matching(session.Version), "session_id", session.ID),
+		http.StatusBadRequest, "Session status is already open")
+
+	rec := callWith(t, h.UpdateSessionStatus, admin, http.MethodPut, `{"status": "completed"}`, matching(session.Version), "session_id", session.ID)
+	if rec.Code != http.StatusOK || rec.Header().Get(etag.HeaderETag) != etag.Format(session.Version+1) {
+		t.Fatalf("expected 200 tagged %s, got %d: %s", etag.Format(session.Version+1), rec.Code, rec.Body.String())
+	}
+	expectError(t, callWith(t, h.UpdateSessionStatus, admin, http.MethodPut, `{"status": "open"}`, matching(session.Version), "session_id", session.ID),
+		http.StatusPreconditionFailed, "Session changed since it was fetched")
+
+	// Completing the session again does not charge it twice
+	for version, status := range []string{"open", "completed"} {
+		if rec := callWith(t, h.UpdateSessionStatus, admin, http.MethodPut, `{"status": "`+status+`"}`, matching(session.Version+1+int64(version)), "session_id", session.ID); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	wallet, err := store.Wallets().Lock(ctx, group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wallet.Balance.Equal(decimal.NewFromInt(-30)) {
+		t.Errorf("expected the pool to pay 30, got %s", wallet.Balance)
+	}
+	for user, share := range map[*models.User]int64{owner: -10, member: -20} {
+		balance, err := store.Wallets().AdjustMemberBalance(ctx, group.ID, user.ID, decimal.Zero)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !balance.Equal(decimal.NewFromInt(share)) {
+			t.Errorf("expected %s to be charged %d, got %s", user.Name, -share, balance)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// StartImpersonation issues a short-lived token for an admin to act as another user, e.g. to reproduce a reported problem.
+// Every impersonation is recorded with the reason given by the admin.
+func StartImpersonation(c echo.Context, jwtSecret interface{}) error {
+	userID, err := GetParamID(c, "user_id")
+	if err != nil {
+		return apperror.NotFound("User not found")
+	}
+
+	cc := c.(*auth.Context)
+	adminID := cc.AuthUser().ID
+
+	var request dto.ImpersonationRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+
+	if userID == adminID {
+		return apperror.BadRequest("You cannot impersonate yourself")
+	}
+
+	var user models.User
+	if err := database.DB.Preload("Roles").First(&user, "id = ?", userID).Error; err != nil {
+		return apperror.NotFound("User not found")
+	}
+
+	// Acting as another admin would hand out their privileges
+	if IsAdmin(database.DB, user.ID) {
+		return apperror.Forbidden("Admins cannot be impersonated")
+	}
+
+	impersonation := models.ImpersonationSession{
+		AdminID:   adminID,
+		UserID:    user.ID,
+		Reason:    request.Reason,
+		TokenJTI:  uuid.NewString(),
+		ExpiresAt: time.Now().Add(auth.ImpersonationTTL),
+		IPAddress: c.RealIP(),
+	}
+
+	accessToken, err := auth.GenerateImpersonationToken(user, adminID, jwtSecret, impersonation.TokenJTI, impersonation.ExpiresAt)
+	if err != nil {
+		return apperror.Internal("Failed to start impersonation", err)
+	}
+
+	if err := database.DB.Create(&impersonation).Error; err != nil {
+		return apperror.Internal("Failed to start impersonation", err)
+	}
+
+	c.Logger().Warnf("admin %s started impersonating user %s: %s", adminID, user.ID, impersonation.Reason)
+
+	audit.Record(c, "user.impersonate", audit.ResourceUser, user.ID, nil, map[string]string{
+		"impersonation_id": impersonation.ID,
+		"reason":           impersonation.Reason,
+	})
+
+	impersonation.User = &user
+	return c.JSON(http.StatusCreated, dto.ImpersonationTokenResponse{
+		AccessToken:   accessToken,
+		TokenType:     "Bearer",
+		ExpiresIn:     int(auth.ImpersonationTTL.Seconds()),
+		Impersonation: dto.ToImpersonationResponse(&impersonation),
+	})
+}
+
+// EndImpersonation revokes the impersonation token the request is made with
+func EndImpersonation(c echo.Context) error {
+	cc := c.(*auth.Context)
+	authUser := cc.AuthUser()
+
+	if !authUser.IsImpersonated() {
+		return apperror.BadRequest("Not impersonating a user")
+	}
+
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		var impersonation models.ImpersonationSession
+		if err := tx.First(&impersonation, "token_jti = ?", authUser.TokenID).Error; err != nil {
+			return err
+		}
+
+		if err := revokeAccessToken(tx, authUser.ID, authUser.TokenID, impersonation.ExpiresAt); err != nil {
+			return err
+		}
+
+		return tx.Model(&impersonation).Update("ended_at", time.Now()).Error
+	}); err != nil {
+		return apperror.Internal("Failed to end impersonation", err)
+	}
+
+	audit.Record(c, "user.end_impersonation", audit.ResourceUser, authUser.ID, nil, nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Impersonation ended"})
+}
+
+// ListImpersonations lists the recorded impersonations, filtered with ?admin_id= and ?user_id=
+func ListImpersonations(c echo.Context) error {
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.ImpersonationSession{})
+	if adminID := c.QueryParam("admin_id"); len(adminID) > 0 {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if userID := c.QueryParam("user_id"); len(userID) > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total impersonations", err)
+	}
+
+	var impersonations []*models.ImpersonationSession
+	if err := query.
+		Preload("Admin").
+		Preload("User").
+		Order("created_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&impersonations).Error; err != nil {
+		return apperror.Internal("Failed to fetch impersonations", err)
+	}
+
+	// Convert impersonations to DTOs
+	var impersonationResponses = make([]dto.ImpersonationResponse, 0, len(impersonations))
+	for _, impersonation := range impersonations {
+		impersonationResponses = append(impersonationResponses, dto.ToImpersonationResponse(impersonation))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      impersonationResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
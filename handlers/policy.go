@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/alanrb/badminton/backend/service"
+	"github.com/labstack/echo/v4"
+)
+
+// The handlers not yet moved to the services load what policy decisions depend on through the service package,
+// from the global connection
+
+// policyStore is the store the policy of a request is loaded from
+func policyStore() repository.Store {
+	return repository.NewStore(database.DB)
+}
+
+// allowed decides if a user may perform an action on a resource, see service.Allowed
+func allowed(c echo.Context, userID string, action policy.Action, resource policy.Resource) bool {
+	ok, err := service.Allowed(c.Request().Context(), policyStore(), userID, action, resource)
+	return err == nil && ok
+}
+
+// groupResource loads what policy decisions about a group depend on for a user
+func groupResource(c echo.Context, groupID string, ownerID string, userID string) (*policy.Group, error) {
+	return service.GroupResource(c.Request().Context(), policyStore(), groupID, ownerID, userID)
+}
+
+// authorizeGroup decides if a user may perform an action on a group
+func authorizeGroup(c echo.Context, group *models.Group, userID string, action policy.Action) (bool, error) {
+	resource, err := groupResource(c, group.ID, group.OwnerID, userID)
+	if err != nil {
+		return false, err
+	}
+	return allowed(c, userID, action, resource), nil
+}
+
+// authorizeGroupID decides if a user may perform an action on a group that has not been loaded.
+// It fails with repository.ErrNotFound when the group does not exist.
+func authorizeGroupID(c echo.Context, groupID string, userID string, action policy.Action) (bool, error) {
+	group, err := policyStore().Groups().FindByID(c.Request().Context(), groupID)
+	if err != nil {
+		return false, err
+	}
+	return authorizeGroup(c, group, userID, action)
+}
+
+// authorizeSession decides if a user may perform an action on a session
+func authorizeSession(c echo.Context, session *models.Session, userID string, action policy.Action) (bool, error) {
+	resource, err := service.SessionResource(c.Request().Context(), policyStore(), session, userID)
+	if err != nil {
+		return false, err
+	}
+	return allowed(c, userID, action, resource), nil
+}
+
+// authorizeAnnouncement decides if a user may perform an action on a group announcement
+func authorizeAnnouncement(c echo.Context, announcement *models.GroupAnnouncement, userID string, action policy.Action) (bool, error) {
+	group, err := service.LoadGroupResource(c.Request().Context(), policyStore(), announcement.GroupID, userID)
+	if err != nil {
+		return false, err
+	}
+	return allowed(c, userID, action, &policy.Announcement{AuthorID: announcement.AuthorID, Group: *group}), nil
+}
+
+// authorizeComment decides if a user may perform an action on a comment of a session
+func authorizeComment(c echo.Context, comment *models.SessionComment, session *models.Session, userID string, action policy.Action) (bool, error) {
+	resource, err := service.SessionResource(c.Request().Context(), policyStore(), session, userID)
+	if err != nil {
+		return false, err
+	}
+	return allowed(c, userID, action, &policy.SessionComment{AuthorID: comment.AuthorID, Session: *resource}), nil
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/rbac"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errRoleExists        = errors.New("role already exists")
+	errRoleAssigned      = errors.New("role is assigned to users")
+	errInvalidPermission = errors.New("invalid permission")
+)
+
+// ListRoles lists the roles with their permissions and how many users hold them
+func ListRoles(c echo.Context) error {
+	var roles []*models.Role
+	if err := database.DB.Preload("Permissions").Order("priority DESC, name").Find(&roles).Error; err != nil {
+		return apperror.Internal("Failed to fetch roles", err)
+	}
+
+	userCounts, err := countRoleUsers(database.DB)
+	if err != nil {
+		return apperror.Internal("Failed to count role users", err)
+	}
+
+	// Convert roles to DTOs
+	var roleResponses = make([]dto.RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		roleResponses = append(roleResponses, dto.ToRoleResponse(role, userCounts[role.ID]))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": roleResponses})
+}
+
+func GetRole(c echo.Context) error {
+	role, err := getRole(c)
+	if role == nil {
+		return err
+	}
+
+	var userCount int64
+	if err := database.DB.Model(&models.UserRole{}).Where("role_id = ?", role.ID).Count(&userCount).Error; err != nil {
+		return apperror.Internal("Failed to count role users", err)
+	}
+
+	return c.JSON(http.StatusOK, dto.ToRoleResponse(role, userCount))
+}
+
+// CreateRole creates a custom role with the given permissions
+func CreateRole(c echo.Context) error {
+	var request dto.NewRoleRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+	request.Name = strings.TrimSpace(request.Name)
+
+	permissions, err := findPermissions(database.DB, request.Permissions)
+	if errors.Is(err, errInvalidPermission) {
+		return apperror.BadRequest(fmt.Sprintf("Invalid permissions: %v", request.Permissions))
+	}
+	if err != nil {
+		return apperror.Internal("Failed to fetch permissions", err)
+	}
+
+	role := models.Role{
+		Name:        request.Name,
+		Description: strings.TrimSpace(request.Description),
+		Priority:    request.Priority,
+	}
+	err = database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Unscoped().Model(&models.Role{}).Where("name = ?", role.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errRoleExists
+		}
+
+		if err := tx.Omit("Permissions.*").Create(&role).Error; err != nil {
+			return err
+		}
+
+		if len(permissions) == 0 {
+			return nil
+		}
+		return tx.Model(&role).Association("Permissions").Append(permissions)
+	})
+	if errors.Is(err, errRoleExists) {
+		return apperror.Conflict("Role already exists")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to create role", err)
+	}
+
+	role.Permissions = permissions
+	audit.Record(c, "role.create", audit.ResourceRole, role.ID, nil, dto.ToRoleResponse(&role, 0))
+	return c.JSON(http.StatusCreated, dto.ToRoleResponse(&role, 0))
+}
+
+// UpdateRole renames a custom role or changes the description and priority of any role
+func UpdateRole(c echo.Context) error {
+	role, err := getRole(c)
+	if role == nil {
+		return err
+	}
+
+	var request dto.UpdateRoleRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	before := map[string]interface{}{}
+	updates := map[string]interface{}{}
+	if request.Name != nil && *request.Name != role.Name {
+		name := strings.TrimSpace(*request.Name)
+		if role.Protected {
+			return apperror.Forbidden("Default roles cannot be renamed")
+		}
+
+		var count int64
+		if err := database.DB.Unscoped().Model(&models.Role{}).Where("name = ? AND id <> ?", name, role.ID).Count(&count).Error; err != nil {
+			return apperror.Internal("Failed to update role", err)
+		}
+		if count > 0 {
+			return apperror.Conflict("Role already exists")
+		}
+		before["name"] = role.Name
+		updates["name"] = name
+	}
+	if request.Description != nil {
+		before["description"] = role.Description
+		updates["description"] = strings.TrimSpace(*request.Description)
+	}
+	if request.Priority != nil {
+		before["priority"] = role.Priority
+		updates["priority"] = *request.Priority
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(role).Updates(updates).Error; err != nil {
+			return apperror.Internal("Failed to update role", err)
+		}
+		// Cached grants hold role names ordered by priority
+		rbac.Cache.InvalidateAll()
+		audit.Record(c, "role.update", audit.ResourceRole, role.ID, before, updates)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Role updated successfully"})
+}
+
+// DeleteRole deletes a custom role that no user holds
+func DeleteRole(c echo.Context) error {
+	role, err := getRole(c)
+	if role == nil {
+		return err
+	}
+
+	if role.Protected {
+		return apperror.Forbidden("Default roles cannot be deleted")
+	}
+
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		// Assignments lock the role for share, so none is made between the count and the delete
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(role, "id = ?", role.ID).Error; err != nil {
+			return err
+		}
+
+		var userCount int64
+		if err := tx.Model(&models.UserRole{}).Where("role_id = ?", role.ID).Count(&userCount).Error; err != nil {
+			return err
+		}
+		if userCount > 0 {
+			return errRoleAssigned
+		}
+
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		// Roles are deleted for good so the name can be used again
+		return tx.Unscoped().Delete(role).Error
+	}); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return apperror.NotFound("Role not found")
+		case errors.Is(err, errRoleAssigned):
+			return apperror.Conflict("Role is still assigned to users")
+		default:
+			return apperror.Internal("Failed to delete role", err)
+		}
+	}
+
+	audit.Record(c, "role.delete", audit.ResourceRole, role.ID, dto.ToRoleResponse(role, 0), nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Role deleted successfully"})
+}
+
+// GrantRolePermission grants a permission to a role
+func GrantRolePermission(c echo.Context) error {
+	role, err := getRole(c)
+	if role == nil {
+		return err
+	}
+
+	permissions, err := findPermissions(database.DB, []string{c.Param("permission")})
+	if errors.Is(err, errInvalidPermission) {
+		return apperror.NotFound("Permission not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to fetch permissions", err)
+	}
+
+	if err := database.DB.Model(role).Association("Permissions").Append(permissions); err != nil {
+		return apperror.Internal("Failed to grant permission", err)
+	}
+	rbac.Cache.InvalidateAll()
+
+	audit.Record(c, "role.grant_permission", audit.ResourceRole, role.ID, nil, map[string]string{"permission": permissions[0].Name})
+	return c.JSON(http.StatusOK, map[string]string{"message": "Permission granted"})
+}
+
+// RevokeRolePermission revokes a permission from a role. Admins keep the permission to manage roles,
+// so they cannot lock themselves out.
+func RevokeRolePermission(c echo.Context) error {
+	role, err := getRole(c)
+	if role == nil {
+		return err
+	}
+
+	permissions, err := findPermissions(database.DB, []string{c.Param("permission")})
+	if errors.Is(err, errInvalidPermission) {
+		return apperror.NotFound("Permission not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to fetch permissions", err)
+	}
+
+	if role.Name == models.UserRoleAdmin && permissions[0].Name == string(rbac.PermissionManageRoles) {
+		return apperror.Forbidden("Admins must keep the permission to manage roles")
+	}
+
+	if err := database.DB.Model(role).Association("Permissions").Delete(permissions); err != nil {
+		return apperror.Internal("Failed to revoke permission", err)
+	}
+	rbac.Cache.InvalidateAll()
+
+	audit.Record(c, "role.revoke_permission", audit.ResourceRole, role.ID, map[string]string{"permission": permissions[0].Name}, nil)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Permission revoked"})
+}
+
+// ListRoleUsers lists the users holding a role
+func ListRoleUsers(c echo.Context) error {
+	role, err := getRole(c)
+	if role == nil {
+		return err
+	}
+
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.User{}).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Where("user_roles.role_id = ?", role.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total users", err)
+	}
+
+	var users []*models.User
+	if err := query.
+		Preload("Roles").
+		Order("users.name").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&users).Error; err != nil {
+		return apperror.Internal("Failed to fetch users", err)
+	}
+
+	// Convert users to DTOs
+	var userResponses = make([]dto.UserResponse, 0, len(users))
+	for _, user := range users {
+		userResponses = append(userResponses, dto.ToUserResponse(user))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      userResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
+
+// ListAllPermissions lists the permissions that can be granted to roles
+func ListAllPermissions(c echo.Context) error {
+	var permissions []*models.Permission
+	if err := database.DB.Order("name").Find(&permissions).Error; err != nil {
+		return apperror.Internal("Failed to fetch permissions", err)
+	}
+
+	// Convert permissions to DTOs
+	var permissionResponses = make([]dto.PermissionResponse, 0, len(permissions))
+	for _, permission := range permissions {
+		permissionResponses = append(permissionResponses, dto.ToPermissionResponse(permission))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": permissionResponses})
+}
+
+// getRole finds the role of the request and writes the error response when it does not exist
+func getRole(c echo.Context) (*models.Role, error) {
+	roleID, err := GetParamID(c, "role_id")
+	if err != nil {
+		return nil, apperror.NotFound("Role not found")
+	}
+
+	var role models.Role
+	if err := database.DB.Preload("Permissions").First(&role, "id = ?", roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.NotFound("Role not found")
+		}
+		return nil, apperror.Internal("Failed to fetch role", err)
+	}
+	return &role, nil
+}
+
+// findPermissions loads permissions by name, every name must exist
+func findPermissions(db *gorm.DB, names []string) ([]*models.Permission, error) {
+	permissions := make([]*models.Permission, 0, len(names))
+	if len(names) == 0 {
+		return permissions, nil
+	}
+
+	if err := db.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, fmt.Errorf("%w: %s", errInvalidPermission, name)
+		}
+	}
+	return permissions, nil
+}
+
+// countRoleUsers counts the users holding each role
+func countRoleUsers(db *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		RoleID string
+		Count  int64
+	}
+	if err := db.Model(&models.UserRole{}).Select("role_id, COUNT(*) AS count").Group("role_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RoleID] = row.Count
+	}
+	return counts, nil
+}
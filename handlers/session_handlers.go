@@ -1,222 +1,80 @@
 package handlers
 
 import (
-	"errors"
-	"fmt"
 	"net/http"
-	"time"
 
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
 	"github.com/alanrb/badminton/backend/auth"
 	"github.com/alanrb/badminton/backend/database"
 	"github.com/alanrb/badminton/backend/models"
 	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/service"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"gorm.io/gorm"
 )
 
-func CreateSession(c echo.Context) error {
+// SessionHandler serves the session endpoints
+type SessionHandler struct {
+	sessions *service.SessionService
+}
+
+func NewSessionHandler(sessions *service.SessionService) *SessionHandler {
+	return &SessionHandler{sessions: sessions}
+}
+
+func (h *SessionHandler) CreateSession(c echo.Context) error {
 	var request dto.NewSessionRequest
-	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	if err := bind(c, &request); err != nil {
+		return err
 	}
 
 	cc, ok := c.(*auth.Context)
 	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get authentication context"})
-	}
-
-	isAdmin := IsAdmin(database.DB, cc.AuthUser().ID)
-
-	session := models.Session{
-		CreatedBy:   cc.AuthUser().ID,
-		Description: request.Description,
-		Status:      models.SessionStatusOpen,
-		MaxMembers:  request.MaxMembers,
-	}
-
-	if len(request.BadmintonCourtID) > 0 {
-		// Validate BadmintonCourtID
-		if err := uuid.Validate(request.BadmintonCourtID); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid BadmintonCourtID"})
-		}
-
-		var court models.BadmintonCourt
-		if err := database.DB.First(&court, "id = ?", request.BadmintonCourtID).Error; err != nil {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Badminton Court not found"})
-		}
-
-		session.BadmintonCourtID = &request.BadmintonCourtID
+		return apperror.Internal("Failed to get authentication context", nil)
 	}
 
-	if len(request.GroupID) > 0 {
-		// Safety check
-		if err := uuid.Validate(request.GroupID); err != nil {
-			return errors.New("invalid group ID")
-		}
-
-		// Validate the group ID
-		var group *models.Group
-		if err := database.DB.First(&group, "id = ?", request.GroupID).Error; err != nil {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
-		}
-
-		// Check if the user is a member of the group
-		isMember, err := IsGroupMember(database.DB, group.ID, cc.AuthUser().ID)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check group membership"})
-		}
-
-		if !isMember && !isAdmin {
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Only group members can create sessions for the group"})
-		}
-
-		// Associate the session with the group
-		session.GroupID = &group.ID
-	}
-
-	if request.DateTime == nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid DateTime"})
+	session, err := h.sessions.Create(c.Request().Context(), cc.AuthUser().ID, request)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to create session")
 	}
-	session.DateTime = request.DateTime
 
-	// Generate a new UUID for the session
-	session.ID = uuid.New().String()
-
-	database.DB.Create(&session)
-	return c.JSON(http.StatusOK, dto.ToSessionResponse(&session))
+	audit.Record(c, "session.create", audit.ResourceSession, session.ID, nil, dto.ToSessionResponse(session))
+	return c.JSON(http.StatusOK, dto.ToSessionResponse(session))
 }
-func AttendSession(c echo.Context) error {
+
+func (h *SessionHandler) AttendSession(c echo.Context) error {
 	// Parse session ID from the request
 	sessionID, err := getSessionID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
 
 	// Parse the request body
 	var req dto.AttendSessionRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid request",
-		})
-	}
-
-	if req.Slot == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid Slot",
-		})
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 
 	cc := c.(*auth.Context)
-	userID := cc.AuthUser().ID
-
-	// Start a transaction
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	isAdmin := IsAdmin(tx, userID)
-
-	// Fetch the session from the database
-	var session models.Session
-	if err := tx.First(&session, "id = ?", sessionID).Error; err != nil {
-		tx.Rollback()
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
-	}
-
-	// Validate session status
-	if !session.CanAttend() {
-		tx.Rollback()
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Session is not open for attendance"})
-	}
-
-	// Check if the session is associated with a group
-	if session.GroupID != nil {
-		// Check if the user is a member of the group
-		isMember, err := IsGroupMember(tx, *session.GroupID, userID)
-		if err != nil {
-			tx.Rollback()
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check group membership"})
-		}
-
-		// Only allow group members or admins to attend group sessions
-		if !isMember && !isAdmin {
-			tx.Rollback()
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Only group members can attend this session"})
-		}
-	}
-
-	// Check if the user is already attending the session
-	var existingAttendee models.SessionAttendee
-	if err := tx.Where("session_id = ? AND user_id = ?", sessionID, userID).First(&existingAttendee).Error; err == nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			tx.Rollback()
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "User is already attending this session"})
-		}
-	}
-
-	// Calculate the total slots already occupied
-	var totalSlots int64
-	if err := tx.Model(&models.SessionAttendee{}).
-		Where("session_id = ? AND status = ?", sessionID, models.ApprovalStatusApproved).
-		Select("COALESCE(SUM(slot), 0)").
-		Scan(&totalSlots).Error; err != nil {
-		tx.Rollback()
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Failed to calculate total slots: %v", err)})
-	}
-
-	// Check if adding the new slots exceeds MaxMembers
-	if totalSlots+int64(req.Slot) > int64(session.MaxMembers) {
-		tx.Rollback()
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Session is full: max members is %v", session.MaxMembers)})
-	}
-
-	// Add the attendee to the session
-	attendee := models.SessionAttendee{
-		SessionID: sessionID,
-		UserID:    userID,
-		Status:    models.ApprovalStatusApproved, // Default status
-		Slot:      req.Slot,
-	}
-	if err := tx.Create(&attendee).Error; err != nil {
-		tx.Rollback()
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to attend session"})
-	}
-
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to commit transaction: %v", err)})
+	if err := h.sessions.Attend(c.Request().Context(), cc.AuthUser().ID, sessionID, req.Slot); err != nil {
+		return apperror.Wrap(err, "Failed to attend session")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Successfully attended the session"})
 }
 
-func CancelAttendance(c echo.Context) error {
+func (h *SessionHandler) CancelAttendance(c echo.Context) error {
 	// Parse session ID from the request
 	sessionID := c.Param("session_id")
 
 	if err := uuid.Validate(sessionID); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+		return apperror.BadRequest("Invalid session ID")
 	}
 
 	cc := c.(*auth.Context)
-	userID := cc.AuthUser().ID
-
-	// Delete the attendee from the session
-	result := database.DB.Where("session_id = ? AND user_id = ?", sessionID, userID).Delete(&models.SessionAttendee{})
-	if result.Error != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to cancel attendance",
-		})
-	}
-
-	if result.RowsAffected == 0 {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "Attendance record not found",
-		})
+	if err := h.sessions.CancelAttendance(c.Request().Context(), cc.AuthUser().ID, sessionID); err != nil {
+		return apperror.Wrap(err, "Failed to cancel attendance")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
@@ -224,86 +82,35 @@ func CancelAttendance(c echo.Context) error {
 	})
 }
 
-func GetSessionDetails(c echo.Context) error {
+func (h *SessionHandler) GetSessionDetails(c echo.Context) error {
 	// Parse session ID from the request
 	sessionID, err := getSessionID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
 
-	// Get authenticated user
 	cc := c.(*auth.Context)
-	userID := cc.AuthUser().ID
-	isAdmin := IsAdmin(database.DB, userID)
-
-	// Fetch session with preloaded relationships
-	var session models.Session
-	result := database.DB.
-		Preload("Group").
-		Preload("BadmintonCourt").
-		Preload("Attendees.User").
-		First(&session, "id = ?", sessionID)
-
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch session details"})
-	}
-
-	// Check access permissions for group sessions
-	if session.GroupID != nil && !isAdmin {
-		isMember, err := IsGroupMember(database.DB, *session.GroupID, userID)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check group membership"})
-		}
-		if !isMember {
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "You must be a member of the group to view this session"})
-		}
+	session, err := h.sessions.Get(c.Request().Context(), cc.AuthUser().ID, sessionID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch session details")
+	}
+	if notModified(c, session.Version) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	// Return the session details as JSON
-	return c.JSON(http.StatusOK, dto.ToSessionResponse(&session))
+	return c.JSON(http.StatusOK, dto.ToSessionResponse(session))
 }
 
-func GetSessions(c echo.Context) error {
+func (h *SessionHandler) GetSessions(c echo.Context) error {
 	// Get pagination parameters using the utility
 	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
 
-	var sessions []*models.Session
-	var total int64
-	currentTime := time.Now()
-
 	cc := c.(*auth.Context)
-	userID := cc.AuthUser().ID
-	isAdmin := IsAdmin(database.DB, userID)
-
-	// Build base query
-	baseQuery := database.DB.Table("sessions").
-		Joins("left join users on users.id = sessions.created_by").
-		Where("sessions.date_time > ?", currentTime)
-
-	var filteredQuery *gorm.DB
-	if isAdmin {
-		// Admin can see all sessions
-		filteredQuery = baseQuery
-	} else {
-		// Regular users can only see sessions that are public or from groups they belong to
-		filteredQuery = baseQuery.Where("(sessions.group_id IS NULL) OR (sessions.group_id IS NOT NULL AND sessions.group_id IN (SELECT group_id FROM group_members WHERE user_id = ?))", userID)
-	}
-
-	// Count total sessions for pagination
-	filteredQuery.Count(&total)
-
-	// Get paginated sessions
-	filteredQuery.
-		Select("sessions.*, users.name as created_by_name").
-		Preload("BadmintonCourt").
-		Preload("Attendees.User").
-		Preload("Group").
-		Offset(pagination.Offset).
-		Limit(pagination.PageSize).
-		Find(&sessions)
+	sessions, total, err := h.sessions.List(c.Request().Context(), cc.AuthUser().ID, pagination.Offset, pagination.PageSize)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch sessions")
+	}
 
 	// Convert sessions to DTOs
 	var sessionResponses []dto.SessionResponse
@@ -320,62 +127,57 @@ func GetSessions(c echo.Context) error {
 	})
 }
 
-func UpdateSession(c echo.Context) error {
+func (h *SessionHandler) UpdateSession(c echo.Context) error {
 	sessionID, err := getSessionID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
-
-	var session models.Session
-	if err := database.DB.First(&session, "id = ?", sessionID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	if session.Status != models.SessionStatusOpen {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Session is not open for update"})
+	var request dto.UpdateSessionRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
+	return h.update(c, sessionID, precondition, request)
+}
 
-	cc := c.(*auth.Context)
-	isAdmin := IsAdmin(database.DB, cc.AuthUser().ID)
-	if session.CreatedBy != cc.AuthUser().ID && !isAdmin {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "You are not the creator of this session"})
+// PatchSession applies a JSON Merge Patch to a session, the fields missing from the patch are kept
+func (h *SessionHandler) PatchSession(c echo.Context) error {
+	sessionID, err := getSessionID(c)
+	if err != nil {
+		return err
 	}
-
-	var request dto.UpdateSessionRequest
-	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	if request.DateTime != nil {
-		if request.DateTime.Before(time.Now()) {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid DateTime"})
-		}
-		session.DateTime = request.DateTime
+	cc := c.(*auth.Context)
+	session, err := h.sessions.Get(c.Request().Context(), cc.AuthUser().ID, sessionID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch session")
 	}
 
-	if len(request.BadmintonCourtID) > 0 {
-		// Validate BadmintonCourtID
-		if err := uuid.Validate(request.BadmintonCourtID); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid BadmintonCourtID"})
-		}
-
-		var court models.BadmintonCourt
-		if err := database.DB.First(&court, "id = ?", request.BadmintonCourtID).Error; err != nil {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Badminton Court not found"})
-		}
-
-		session.BadmintonCourtID = &request.BadmintonCourtID
+	request := dto.NewPatchSessionRequest(session)
+	if err := patch(c, dto.ToPatchSessionRequest(session), &request); err != nil {
+		return err
 	}
+	return h.update(c, sessionID, precondition, request.UpdateRequest())
+}
 
-	// Update session details
-	session.Description = request.Description
-	session.MaxMembers = request.MaxMembers
-
-	if err := database.DB.Save(&session).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update session"})
+func (h *SessionHandler) update(c echo.Context, sessionID string, precondition service.Precondition, request dto.UpdateSessionRequest) error {
+	cc := c.(*auth.Context)
+	session, before, err := h.sessions.Update(c.Request().Context(), cc.AuthUser().ID, sessionID, precondition, request)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to update session")
 	}
 
-	return c.JSON(http.StatusOK, dto.ToSessionResponse(&session))
+	audit.Record(c, "session.update", audit.ResourceSession, session.ID, dto.ToSessionResponse(&before), dto.ToSessionResponse(session))
+	tag(c, session.Version)
+	return c.JSON(http.StatusOK, dto.ToSessionResponse(session))
 }
 
 // @Summary Update session status
@@ -388,69 +190,93 @@ func UpdateSession(c echo.Context) error {
 // @Security ApiKeyAuth
 // @Success 200 {object} models.Session
 // @Router /api/sessions/{id}/status [put]
-func UpdateSessionStatus(c echo.Context) error {
+func (h *SessionHandler) UpdateSessionStatus(c echo.Context) error {
 	sessionID, err := getSessionID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
-
-	var session models.Session
-	if err := database.DB.First(&session, "id = ?", sessionID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	var updateData struct {
-		Status string `json:"status"`
-	}
-	if err := c.Bind(&updateData); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	var request dto.UpdateSessionStatusRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
 
-	if updateData.Status == session.Status {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Session status is already " + updateData.Status})
+	cc := c.(*auth.Context)
+	session, before, err := h.sessions.UpdateStatus(c.Request().Context(), cc.AuthUser().ID, sessionID, precondition, request.Status)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to update session status")
 	}
 
-	if updateData.Status != models.SessionStatusOpen && updateData.Status != models.SessionStatusOngoing && updateData.Status != models.SessionStatusCompleted {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session status"})
-	}
+	audit.Record(c, "session.status", audit.ResourceSession, session.ID, dto.ToSessionResponse(&before), dto.ToSessionResponse(session))
+	tag(c, session.Version)
+	return c.JSON(http.StatusOK, dto.ToSessionResponse(session))
+}
 
-	// Validate session status
-	if !models.ValidSessionStatus(updateData.Status) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session status"})
+func (h *SessionHandler) DeleteSession(c echo.Context) error {
+	sessionID, err := getSessionID(c)
+	if err != nil {
+		return err
+	}
+	precondition, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	// Update session status
-	session.Status = updateData.Status
-	database.DB.Save(&session)
+	cc := c.(*auth.Context)
+	session, err := h.sessions.Delete(c.Request().Context(), cc.AuthUser().ID, sessionID, precondition)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to delete session")
+	}
 
-	return c.JSON(http.StatusOK, dto.ToSessionResponse(&session))
+	audit.Record(c, "session.delete", audit.ResourceSession, session.ID, dto.ToSessionResponse(session), nil)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Session deleted"})
 }
 
-func DeleteSession(c echo.Context) error {
+// UpdateAttendeeStatus approves or rejects an attendee of a session
+func (h *SessionHandler) UpdateAttendeeStatus(c echo.Context) error {
 	sessionID, err := getSessionID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
+	}
+
+	attendeeID, err := GetParamID(c, "user_id")
+	if err != nil {
+		return apperror.BadRequest("Invalid user ID")
 	}
 
-	var session models.Session
-	if err := database.DB.First(&session, "id = ?", sessionID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
+	var request dto.UpdateAttendeeStatusRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
 
 	cc := c.(*auth.Context)
-	isAdmin := IsAdmin(database.DB, cc.AuthUser().ID)
-	if session.CreatedBy != cc.AuthUser().ID && !isAdmin {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "You are not the creator of this session"})
+	attendee, before, err := h.sessions.UpdateAttendeeStatus(c.Request().Context(), cc.AuthUser().ID, sessionID, attendeeID, models.ApprovalStatus(request.Status), request.Remark)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to update attendee")
 	}
 
-	database.DB.Where("id = ?", sessionID).Delete(&models.Session{})
-	return c.JSON(http.StatusOK, map[string]string{"message": "Session deleted"})
+	audit.Record(c, "session.attendee_status", audit.ResourceSession, sessionID, attendeeSnapshot(&before), attendeeSnapshot(attendee))
+	return c.JSON(http.StatusOK, map[string]string{"message": "Attendee updated"})
+}
+
+// attendeeSnapshot describes an attendee for the audit log
+func attendeeSnapshot(attendee *models.SessionAttendee) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id": attendee.UserID,
+		"status":  attendee.Status,
+		"slot":    attendee.Slot,
+		"remark":  attendee.Remark,
+	}
 }
 
 func getSessionID(c echo.Context) (string, error) {
 	sessionID := c.Param("session_id")
 	if err := uuid.Validate(sessionID); err != nil {
-		return "", errors.New("invalid session ID")
+		return "", apperror.Invalid("session_id", "Invalid session ID")
 	}
 	return sessionID, nil
 }
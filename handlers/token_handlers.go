@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errInvalidLoginCode    = errors.New("invalid login code")
+)
+
+// ExchangeLoginCode exchanges the single-use code of a login for an access token and a refresh token
+func ExchangeLoginCode(c echo.Context, jwtSecret interface{}) error {
+	var request dto.LoginCodeRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	var tokens *dto.TokenResponse
+	err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		var code models.LoginCode
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&code, "code_hash = ?", auth.HashLoginCode(request.Code)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidLoginCode
+			}
+			return err
+		}
+
+		// Expired codes are left to the purge-login-codes job
+		if time.Now().After(code.ExpiresAt) {
+			return errInvalidLoginCode
+		}
+		if err := tx.Delete(&code).Error; err != nil {
+			return err
+		}
+
+		// The access token carries the primary role
+		var user models.User
+		if err := tx.Preload("Roles").First(&user, "id = ?", code.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidLoginCode
+			}
+			return err
+		}
+
+		var err error
+		tokens, err = issueTokens(tx, user, jwtSecret, "")
+		return err
+	})
+
+	if errors.Is(err, errInvalidLoginCode) {
+		return apperror.Unauthorized("Invalid login code")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to log in", err)
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and a new refresh token.
+// Replaying a refresh token that was already used revokes every token rotated from the same login.
+func RefreshTokens(c echo.Context, jwtSecret interface{}) error {
+	var request dto.RefreshTokenRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	var tokens *dto.TokenResponse
+	var replayed bool
+	err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		var refreshToken models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&refreshToken, "token_hash = ?", auth.HashRefreshToken(request.RefreshToken)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidRefreshToken
+			}
+			return err
+		}
+
+		if refreshToken.UsedAt != nil && refreshToken.RevokedAt == nil {
+			// The token was stolen or replayed, the revocation is committed below
+			replayed = true
+			return errInvalidRefreshToken
+		}
+
+		if !refreshToken.IsActive() {
+			return errInvalidRefreshToken
+		}
+
+		var user models.User
+		if err := tx.Preload("Roles").First(&user, "id = ?", refreshToken.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidRefreshToken
+			}
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&refreshToken).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+
+		var err error
+		tokens, err = issueTokens(tx, user, jwtSecret, refreshToken.FamilyID)
+		return err
+	})
+
+	if replayed {
+		if err := revokeTokenFamily(database.DB, auth.HashRefreshToken(request.RefreshToken)); err != nil {
+			c.Logger().Errorf("failed to revoke refresh token family: %v", err)
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			return apperror.Unauthorized("Invalid refresh token")
+		}
+		return apperror.Internal("Failed to refresh token", err)
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the current access token and the refresh tokens issued with it
+func Logout(c echo.Context) error {
+	cc := c.(*auth.Context)
+	authUser := cc.AuthUser()
+
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		if err := revokeAccessToken(tx, authUser.ID, authUser.TokenID, time.Now().Add(auth.AccessTokenTTL)); err != nil {
+			return err
+		}
+
+		var familyIDs []string
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND access_jti = ?", authUser.ID, authUser.TokenID).
+			Pluck("family_id", &familyIDs).Error; err != nil {
+			return err
+		}
+
+		if len(familyIDs) == 0 {
+			return nil
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id IN ? AND revoked_at IS NULL", familyIDs).
+			Update("revoked_at", time.Now()).Error
+	}); err != nil {
+		return apperror.Internal("Failed to log out", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// LogoutEverywhere revokes every refresh token of the user and every access token that may still be valid
+func LogoutEverywhere(c echo.Context) error {
+	cc := c.(*auth.Context)
+	authUser := cc.AuthUser()
+
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := revokeAccessToken(tx, authUser.ID, authUser.TokenID, now.Add(auth.AccessTokenTTL)); err != nil {
+			return err
+		}
+
+		// Access tokens are only issued along with a refresh token, so the refresh tokens
+		// created within the access token lifetime reference every access token still valid
+		var refreshTokens []*models.RefreshToken
+		if err := tx.Where("user_id = ? AND created_at > ?", authUser.ID, now.Add(-auth.AccessTokenTTL)).
+			Find(&refreshTokens).Error; err != nil {
+			return err
+		}
+		for _, refreshToken := range refreshTokens {
+			if err := revokeAccessToken(tx, authUser.ID, refreshToken.AccessJTI, refreshToken.CreatedAt.Add(auth.AccessTokenTTL)); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", authUser.ID).
+			Update("revoked_at", now).Error
+	}); err != nil {
+		return apperror.Internal("Failed to log out", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out everywhere"})
+}
+
+// IsTokenRevoked checks if an access token has been revoked
+func IsTokenRevoked(db *gorm.DB, jti string) (bool, error) {
+	var count int64
+	if err := db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// issueTokens creates an access token and a refresh token for the user.
+// An empty family ID starts a new family, as on login.
+func issueTokens(tx *gorm.DB, user models.User, jwtSecret interface{}, familyID string) (*dto.TokenResponse, error) {
+	if len(familyID) == 0 {
+		familyID = uuid.NewString()
+	}
+
+	jti := uuid.NewString()
+	accessToken, err := auth.GenerateJWTTokenWithID(user, jwtSecret, jti)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, tokenHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: tokenHash,
+		AccessJTI: jti,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &dto.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeTokenFamily revokes every refresh token rotated from the same login as the given one,
+// along with the access tokens issued with them
+func revokeTokenFamily(db *gorm.DB, tokenHash string) error {
+	return database.RunInTransaction(db, func(tx *gorm.DB) error {
+		var refreshToken models.RefreshToken
+		if err := tx.First(&refreshToken, "token_hash = ?", tokenHash).Error; err != nil {
+			return err
+		}
+
+		var family []*models.RefreshToken
+		if err := tx.Where("family_id = ?", refreshToken.FamilyID).Find(&family).Error; err != nil {
+			return err
+		}
+		for _, token := range family {
+			if err := revokeAccessToken(tx, token.UserID, token.AccessJTI, token.CreatedAt.Add(auth.AccessTokenTTL)); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", refreshToken.FamilyID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// revokeAccessToken records the jti of an access token as revoked until it expires
+func revokeAccessToken(tx *gorm.DB, userID string, jti string, expiresAt time.Time) error {
+	if len(jti) == 0 || time.Now().After(expiresAt) {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}).Error
+}
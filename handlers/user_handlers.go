@@ -1,28 +1,44 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"slices"
 	"strconv"
 
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
 	"github.com/alanrb/badminton/backend/auth"
 	"github.com/alanrb/badminton/backend/database"
 	"github.com/alanrb/badminton/backend/models"
 	"github.com/alanrb/badminton/backend/models/dto"
 	"github.com/alanrb/badminton/backend/rbac"
-	"github.com/google/uuid"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/alanrb/badminton/backend/service"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
-func CreateUser(c echo.Context) error {
-	var user models.User
-	if err := c.Bind(&user); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+// UserHandler serves the user endpoints
+type UserHandler struct {
+	users *service.UserService
+}
+
+func NewUserHandler(users *service.UserService) *UserHandler {
+	return &UserHandler{users: users}
+}
+
+func (h *UserHandler) CreateUser(c echo.Context) error {
+	var request dto.NewUserRequest
+	if err := bind(c, &request); err != nil {
+		return err
 	}
-	// Generate a new UUID for the session
-	user.ID = uuid.New().String()
 
-	database.DB.Create(&user)
+	user, err := h.users.Create(c.Request().Context(), request)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to create user")
+	}
+	audit.Record(c, "user.create", audit.ResourceUser, user.ID, nil, dto.ToUserResponse(user))
 	return c.JSON(http.StatusOK, user)
 }
 
@@ -36,7 +52,7 @@ func CreateUser(c echo.Context) error {
 // @Security ApiKeyAuth
 // @Success 200 {object} map[string]interface{}
 // @Router /api/admin/users [get]
-func GetUsers(c echo.Context) error {
+func (h *UserHandler) GetUsers(c echo.Context) error {
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.QueryParam("page"))
 	limit, _ := strconv.Atoi(c.QueryParam("limit"))
@@ -49,13 +65,10 @@ func GetUsers(c echo.Context) error {
 		limit = 10 // Default limit
 	}
 
-	// Calculate offset
-	offset := (page - 1) * limit
-
 	// Fetch paginated users
-	var users []*models.User
-	if err := database.DB.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch users"})
+	users, total, err := h.users.List(c.Request().Context(), (page-1)*limit, limit)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch users")
 	}
 
 	// Convert users to DTOs
@@ -65,12 +78,6 @@ func GetUsers(c echo.Context) error {
 		userResponses = append(userResponses, &userResponse)
 	}
 
-	// Get total count of users
-	var total int64
-	if err := database.DB.Model(&models.User{}).Count(&total).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to count users"})
-	}
-
 	// Return paginated response
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data":  userResponses,
@@ -80,67 +87,35 @@ func GetUsers(c echo.Context) error {
 	})
 }
 
-func GetProfile(c echo.Context) error {
+func (h *UserHandler) GetProfile(c echo.Context) error {
 	cc := c.(*auth.Context)
 
 	ctxUser := cc.AuthUser()
 	if ctxUser == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "Failed to get profile",
-		})
-	}
-
-	// Fetch the user from the database
-	var user *models.User
-	if err := database.DB.First(&user, "id = ?", cc.AuthUser().ID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
-	}
-
-	roles, err := GetRoles(database.DB, user.ID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch roles"})
-	}
-
-	permissions, err := GetPermissions(database.DB, user.ID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch permissions"})
+		return apperror.NotFound("Failed to get profile")
 	}
-
-	// Return the response with user details, roles, and permissions
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"user":        dto.ToUserResponse(user),
-		"roles":       roles,
-		"permissions": permissions,
-	})
+	return h.profile(c, ctxUser.ID)
 }
 
-func GetUser(c echo.Context) error {
+func (h *UserHandler) GetUser(c echo.Context) error {
 	userID, err := GetParamID(c, "user_id")
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found."})
-	}
-
-	// Fetch the user from the database
-	var user *models.User
-	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
-	}
-
-	roles, err := GetRoles(database.DB, user.ID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch roles"})
+		return apperror.NotFound("User not found.")
 	}
+	return h.profile(c, userID)
+}
 
-	permissions, err := GetPermissions(database.DB, user.ID)
+// profile responds with the details, roles and permissions of a user
+func (h *UserHandler) profile(c echo.Context, userID string) error {
+	profile, err := h.users.Profile(c.Request().Context(), userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch permissions"})
+		return apperror.Wrap(err, "Failed to fetch user")
 	}
 
-	// Return the response with user details, roles, and permissions
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"user":        dto.ToUserResponse(user),
-		"roles":       roles,
-		"permissions": permissions,
+		"user":        dto.ToUserResponse(profile.User),
+		"roles":       profile.Roles,
+		"permissions": profile.Permissions,
 	})
 }
 
@@ -156,9 +131,7 @@ func GetAttendedSessions(c echo.Context) error {
 		Scan(&sessions)
 
 	if result.Error != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Failed to fetch attended sessions",
-		})
+		return apperror.Internal("Failed to fetch attended sessions", result.Error)
 	}
 
 	// Convert users to DTOs
@@ -173,110 +146,87 @@ func GetAttendedSessions(c echo.Context) error {
 	})
 }
 
-func UpdateUser(c echo.Context) error {
+func (h *UserHandler) UpdateUser(c echo.Context) error {
 	userID, err := GetParamID(c, "user_id")
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		return apperror.NotFound("User not found")
 	}
-	cc := c.(*auth.Context)
-	ctxUser := cc.AuthUser()
-	isAdmin := IsAdmin(database.DB, ctxUser.ID)
 
-	type updateUserRequest struct {
-		AvatarURL string   `json:"avatar_url"`
-		Roles     []string `json:"roles"`
+	// Parse the request body
+	var req dto.UpdateUserRequest
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 
-	// Parse the request body
-	var req *updateUserRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	// An empty avatar URL keeps the current one
+	var avatarURL *string
+	if req.AvatarURL != "" {
+		avatarURL = &req.AvatarURL
+	}
+	return h.update(c, userID, service.UserChanges{AvatarURL: avatarURL, Roles: req.Roles})
+}
+
+// PatchUser applies a JSON Merge Patch to the avatar and roles of a user, the fields missing from the patch are kept
+func (h *UserHandler) PatchUser(c echo.Context) error {
+	userID, err := GetParamID(c, "user_id")
+	if err != nil {
+		return apperror.NotFound("User not found")
 	}
 
-	// Start a transaction
-	tranErr := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
-		// Find the user by ID
-		var user *models.User
-		if err := tx.First(&user, "id = ?", userID).Error; err != nil {
-			return err
-		}
-
-		// Update the user's avatar URL
-		if req.AvatarURL != "" {
-			user.AvatarURL = req.AvatarURL
-		}
-
-		// Validate roles if provided
-		if len(req.Roles) > 0 {
-			// Check if the current user has admin privileges
-			if !isAdmin {
-				return c.JSON(http.StatusForbidden, map[string]string{"error": "Only admins can update user roles"})
-			}
-
-			// Validate that all provided roles are valid
-			for _, roleName := range req.Roles {
-				var role models.Role
-				if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
-					return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role: " + roleName})
-				}
-			}
-
-			// Update the user's role if roles are provided
-			if len(req.Roles) > 0 && len(req.Roles) == 1 {
-				// Set the primary role to the first role in the list
-				user.Role = req.Roles[0] // TODO: Add priority
-
-				// Validate that the role is valid
-				if !models.ValidUserRole(user.Role) {
-					return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid primary role"})
-				}
-			}
-		}
-
-		// Save the updated user
-		if err := tx.Save(&user).Error; err != nil {
-			return err
-		}
-
-		// Updates user roles
-		if len(req.Roles) > 0 && ctxUser.Role == models.UserRoleAdmin {
-			// Clear existing roles
-			if err := tx.Model(&user).Association("Roles").Clear(); err != nil {
-				return err
-			}
-
-			// Assign new roles to the user
-			for _, role := range req.Roles {
-				if err := rbac.AssignRoleToUser(tx, user.ID, role); err != nil {
-					return err
-				}
-			}
-		}
-
-		return nil
-	})
-	if tranErr != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user"})
+	user, err := h.users.Get(c.Request().Context(), userID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to fetch user")
+	}
+	current := dto.UpdateUserRequest{AvatarURL: user.AvatarURL, Roles: roleNames(user)}
+
+	var req dto.UpdateUserRequest
+	if err := patch(c, current, &req); err != nil {
+		return err
+	}
+	if len(req.Roles) == 0 {
+		return apperror.Invalid("roles", "At least one role is required")
+	}
+
+	// Only admins can change roles, patching the avatar alone leaves them as they are
+	roles := slices.Clone(req.Roles)
+	slices.Sort(roles)
+	if slices.Equal(slices.Compact(roles), current.Roles) {
+		roles = nil
+	}
+	return h.update(c, userID, service.UserChanges{AvatarURL: &req.AvatarURL, Roles: roles})
+}
+
+// update changes a user and records the change
+func (h *UserHandler) update(c echo.Context, userID string, changes service.UserChanges) error {
+	cc := c.(*auth.Context)
+	user, before, err := h.users.Update(c.Request().Context(), cc.AuthUser().ID, userID, changes)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to update user")
 	}
+	rbac.Cache.Invalidate(userID)
+	audit.Record(c, "user.update", audit.ResourceUser, userID, userSnapshot(&before), userSnapshot(user))
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "User updated successfully"})
 }
 
-func GetPermissions(db *gorm.DB, userID string) ([]string, error) {
-	// Fetch the user's permissions using raw SQL
-	permissions := make([]string, 0)
-	query := `
-			SELECT p.name
-			FROM permissions p
-			JOIN role_permissions rp ON p.id = rp.permission_id
-			JOIN roles r ON rp.role_id = r.id
-			JOIN user_roles ur ON r.id = ur.role_id
-			WHERE ur.user_id = ?
-		`
-	if err := db.Raw(query, userID).Scan(&permissions).Error; err != nil {
-		return nil, err
+// userSnapshot describes the fields of a user that can be updated for the audit log, roles must be preloaded
+func userSnapshot(user *models.User) map[string]interface{} {
+	return map[string]interface{}{"avatar_url": user.AvatarURL, "roles": roleNames(user)}
+}
+
+// roleNames are the sorted names of the roles of a user, roles must be preloaded
+func roleNames(user *models.User) []string {
+	roles := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
 	}
-	return permissions, nil
+	slices.Sort(roles)
+	return roles
+}
+
+// GetPermissions returns the names of the permissions the roles of a user grant
+func GetPermissions(db *gorm.DB, userID string) ([]string, error) {
+	return repository.NewStore(db).Users().Permissions(context.Background(), userID)
 }
 
 func GetRoles(db *gorm.DB, userID string) ([]string, error) {
@@ -287,6 +237,7 @@ func GetRoles(db *gorm.DB, userID string) ([]string, error) {
 	FROM roles r
 	JOIN user_roles ur ON r.id = ur.role_id
 	WHERE ur.user_id = ?
+	ORDER BY r.priority DESC, r.name
 `
 	if err := db.Raw(rolesQuery, userID).Scan(&roles).Error; err != nil {
 		return nil, err
@@ -296,14 +247,27 @@ func GetRoles(db *gorm.DB, userID string) ([]string, error) {
 
 // IsAdmin checks if a user has the admin role
 func IsAdmin(db *gorm.DB, userID string) bool {
-	var isAdmin bool
-	err := db.Model(&models.UserRole{}).
-		Joins("JOIN roles ON user_roles.role_id = roles.id").
-		Where("user_roles.user_id = ? AND roles.name = ?", userID, models.UserRoleAdmin).
-		Select("COUNT(*) > 0").
-		Scan(&isAdmin).Error
+	grants, err := rbac.UserGrants(db, userID)
 	if err != nil {
 		return false
 	}
-	return isAdmin
+	return grants.HasRole(models.UserRoleAdmin)
+}
+
+// grantsKey is the echo context key of the grants of the authenticated user
+const grantsKey = "auth_grants"
+
+// RequestGrants returns the grants of the authenticated user, looked up once per request
+func RequestGrants(c echo.Context, db *gorm.DB) (*rbac.Grants, error) {
+	if grants, ok := c.Get(grantsKey).(*rbac.Grants); ok {
+		return grants, nil
+	}
+
+	cc := c.(*auth.Context)
+	grants, err := rbac.UserGrants(db, cc.AuthUser().ID)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(grantsKey, grants)
+	return grants, nil
 }
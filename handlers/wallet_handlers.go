@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetGroupWallet returns the wallet of a group. Organizers also see the balance of every member.
+func GetGroupWallet(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	cc := c.(*auth.Context)
+	userID := cc.AuthUser().ID
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return apperror.NotFound("Group not found")
+	}
+
+	resource, err := groupResource(c, group.ID, group.OwnerID, userID)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !allowed(c, userID, policy.View, resource) {
+		return apperror.Forbidden("You are not a member of this group")
+	}
+	canViewFinances := allowed(c, userID, policy.ViewFinances, resource)
+
+	wallet, err := getGroupWallet(database.DB, groupID)
+	if err != nil {
+		return apperror.Internal("Failed to fetch wallet", err)
+	}
+
+	var balances []*models.GroupWalletBalance
+	if err := database.DB.Preload("User").Where("group_id = ?", groupID).Find(&balances).Error; err != nil {
+		return apperror.Internal("Failed to fetch member balances", err)
+	}
+
+	resp := dto.ToWalletResponse(wallet)
+	for _, balance := range balances {
+		if balance.UserID == userID {
+			resp.MyBalance = balance.Balance
+		}
+		if canViewFinances {
+			resp.Members = append(resp.Members, dto.ToMemberBalanceResponse(balance))
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// UpdateGroupWallet updates the low balance thresholds of a group wallet
+func UpdateGroupWallet(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	var request dto.UpdateWalletRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return apperror.NotFound("Group not found")
+	}
+
+	// Only the group owner or admin can configure the wallet
+	cc := c.(*auth.Context)
+	canConfigure, err := authorizeGroup(c, &group, cc.AuthUser().ID, policy.ConfigureWallet)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canConfigure {
+		return apperror.Forbidden("Only the group owner can configure the wallet")
+	}
+
+	var wallet *models.GroupWallet
+	var before *dto.WalletResponse
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		wallet, err = repository.NewStore(tx).Wallets().Lock(c.Request().Context(), groupID)
+		if err != nil {
+			return err
+		}
+		before = dto.ToWalletResponse(wallet)
+
+		if request.LowBalanceThreshold != nil {
+			wallet.LowBalanceThreshold = *request.LowBalanceThreshold
+		}
+		if request.MemberLowBalanceThreshold != nil {
+			wallet.MemberLowBalanceThreshold = *request.MemberLowBalanceThreshold
+		}
+		return tx.Save(wallet).Error
+	}); err != nil {
+		return apperror.Internal("Failed to update wallet", err)
+	}
+
+	audit.Record(c, "group.wallet_update", audit.ResourceGroup, groupID, before, dto.ToWalletResponse(wallet))
+	return c.JSON(http.StatusOK, dto.ToWalletResponse(wallet))
+}
+
+// TopUpGroupWallet records money received from a member, either as prepaid credit or as a membership fee
+func TopUpGroupWallet(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	var request dto.WalletTopUpRequest
+	if err := bind(c, &request); err != nil {
+		return err
+	}
+
+	if len(request.Type) == 0 {
+		request.Type = models.WalletTransactionTopUp
+	}
+
+	// Only group organizers can record money they received
+	cc := c.(*auth.Context)
+	canRecord, err := authorizeGroupID(c, groupID, cc.AuthUser().ID, policy.RecordTopUp)
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound("Group not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canRecord {
+		return apperror.Forbidden("Only group organizers can record top-ups")
+	}
+
+	isMember, err := IsGroupMember(database.DB, groupID, request.UserID)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !isMember {
+		return apperror.BadRequest("User is not a member of the group")
+	}
+
+	transaction := models.WalletTransaction{
+		GroupID:   groupID,
+		UserID:    &request.UserID,
+		Type:      request.Type,
+		Amount:    request.Amount,
+		Note:      request.Note,
+		CreatedBy: cc.AuthUser().ID,
+	}
+	ctx := c.Request().Context()
+	if err := database.RunInTransaction(database.DB, func(tx *gorm.DB) error {
+		wallets := repository.NewStore(tx).Wallets()
+		wallet, err := wallets.Lock(ctx, groupID)
+		if err != nil {
+			return err
+		}
+
+		wallet.Balance = wallet.Balance.Add(request.Amount)
+		if err := wallets.UpdateBalance(ctx, wallet); err != nil {
+			return err
+		}
+		transaction.PoolBalance = wallet.Balance
+
+		// Membership fees belong to the pool, top-ups are also credited to the member
+		if request.Type == models.WalletTransactionTopUp {
+			memberBalance, err := wallets.AdjustMemberBalance(ctx, groupID, request.UserID, request.Amount)
+			if err != nil {
+				return err
+			}
+			transaction.MemberBalance = &memberBalance
+		}
+
+		return wallets.AddTransaction(ctx, &transaction)
+	}); err != nil {
+		return apperror.Internal("Failed to record top-up", err)
+	}
+
+	audit.Record(c, "group.wallet_top_up", audit.ResourceGroup, groupID, nil, dto.ToWalletTransactionResponse(&transaction))
+	return c.JSON(http.StatusCreated, dto.ToWalletTransactionResponse(&transaction))
+}
+
+// ListWalletTransactions lists the wallet history of a group, newest first.
+// Members who do not organize the group only see their own transactions.
+func ListWalletTransactions(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	cc := c.(*auth.Context)
+	userID := cc.AuthUser().ID
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return apperror.NotFound("Group not found")
+	}
+
+	resource, err := groupResource(c, group.ID, group.OwnerID, userID)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !allowed(c, userID, policy.View, resource) {
+		return apperror.Forbidden("You are not a member of this group")
+	}
+	canViewFinances := allowed(c, userID, policy.ViewFinances, resource)
+
+	// Get pagination parameters using the utility
+	pagination := database.GetPagination(c.QueryParam("page"), c.QueryParam("limit"))
+
+	query := database.DB.Model(&models.WalletTransaction{}).Where("group_id = ?", groupID)
+
+	if !canViewFinances {
+		query = query.Where("user_id = ?", userID)
+	} else if filterUserID := c.QueryParam("user_id"); len(filterUserID) > 0 {
+		query = query.Where("user_id = ?", filterUserID)
+	}
+
+	if sessionID := c.QueryParam("session_id"); len(sessionID) > 0 {
+		query = query.Where("session_id = ?", sessionID)
+	}
+
+	if transactionType := c.QueryParam("type"); len(transactionType) > 0 {
+		query = query.Where("type = ?", transactionType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apperror.Internal("Failed to fetch total transactions", err)
+	}
+
+	var transactions []*models.WalletTransaction
+	if err := query.
+		Preload("User").
+		Order("created_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&transactions).Error; err != nil {
+		return apperror.Internal("Failed to fetch transactions", err)
+	}
+
+	// Convert transactions to DTOs
+	var transactionResponses = make([]*dto.WalletTransactionResponse, 0, len(transactions))
+	for _, transaction := range transactions {
+		transactionResponses = append(transactionResponses, dto.ToWalletTransactionResponse(transaction))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      transactionResponses,
+		"total":     total,
+		"page":      pagination.Page,
+		"page_size": pagination.PageSize,
+	})
+}
+
+// GetLowBalanceReport reports whether the pool and which members need topping up
+func GetLowBalanceReport(c echo.Context) error {
+	groupID, err := getGroupID(c)
+	if err != nil {
+		return err
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return apperror.NotFound("Group not found")
+	}
+
+	// Only the group owner or admin can see the report, as they set the thresholds it is based on
+	cc := c.(*auth.Context)
+	canConfigure, err := authorizeGroup(c, &group, cc.AuthUser().ID, policy.ConfigureWallet)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !canConfigure {
+		return apperror.Forbidden("Only the group owner can view the wallet report")
+	}
+
+	wallet, err := getGroupWallet(database.DB, groupID)
+	if err != nil {
+		return apperror.Internal("Failed to fetch wallet", err)
+	}
+
+	var balances []*models.GroupWalletBalance
+	if err := database.DB.
+		Preload("User").
+		Where("group_id = ? AND balance < ?", groupID, wallet.MemberLowBalanceThreshold).
+		Order("balance").
+		Find(&balances).Error; err != nil {
+		return apperror.Internal("Failed to fetch member balances", err)
+	}
+
+	resp := &dto.LowBalanceReportResponse{
+		GroupID:             groupID,
+		Balance:             wallet.Balance,
+		LowBalanceThreshold: wallet.LowBalanceThreshold,
+		IsLow:               wallet.IsLow(),
+		MembersBelow:        make([]*dto.MemberBalanceResponse, 0, len(balances)),
+	}
+	for _, balance := range balances {
+		resp.MembersBelow = append(resp.MembersBelow, dto.ToMemberBalanceResponse(balance))
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// getGroupWallet fetches the wallet of a group, a group without one has an empty wallet
+func getGroupWallet(db *gorm.DB, groupID string) (*models.GroupWallet, error) {
+	var wallets []*models.GroupWallet
+	if err := db.Where("group_id = ?", groupID).Limit(1).Find(&wallets).Error; err != nil {
+		return nil, err
+	}
+	if len(wallets) == 0 {
+		return &models.GroupWallet{GroupID: groupID}, nil
+	}
+	return wallets[0], nil
+}
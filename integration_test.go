@@ -0,0 +1,801 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/handlers"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/google/uuid"
+)
+
+type idResponse struct {
+	ID string `json:"id"`
+}
+
+// createGroup creates a group as the admin with the players as members and returns its ID
+func createGroup(t *testing.T, api *testAPI, admin *testUser, players ...*testUser) string {
+	t.Helper()
+
+	var group idResponse
+	api.do(admin, http.MethodPost, "/api/groups", map[string]interface{}{"name": "Thursday club"}).expect(t, http.StatusCreated, &group)
+	for _, player := range players {
+		api.do(admin, http.MethodPost, "/api/groups/"+group.ID+"/players", map[string]string{"user_email": player.Email}).expect(t, http.StatusOK, nil)
+	}
+	return group.ID
+}
+
+func TestAuthentication(t *testing.T) {
+	api := newTestAPI(t)
+	player := api.user("Player", models.UserRolePlayer)
+
+	api.do(nil, http.MethodGet, "/api/profile", nil).expect(t, http.StatusUnauthorized, nil)
+
+	var profile struct {
+		User struct {
+			ID   string `json:"id"`
+			Role string `json:"role"`
+		} `json:"user"`
+		Roles []string `json:"roles"`
+	}
+	api.do(player, http.MethodGet, "/api/profile", nil).expect(t, http.StatusOK, &profile)
+	if profile.User.ID != player.ID || profile.User.Role != models.UserRolePlayer {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+
+	// Logging out revokes the token
+	api.do(player, http.MethodPost, "/api/auth/logout", nil).expect(t, http.StatusOK, nil)
+	api.do(player, http.MethodGet, "/api/profile", nil).expectError(t, http.StatusUnauthorized, "Token has been revoked")
+}
+
+func TestLoginCodeExchange(t *testing.T) {
+	api := newTestAPI(t)
+	player := api.user("Player", models.UserRolePlayer)
+
+	code, codeHash, err := auth.GenerateLoginCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.Create(&models.LoginCode{CodeHash: codeHash, UserID: player.ID, ExpiresAt: time.Now().Add(auth.LoginCodeTTL)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	api.do(nil, http.MethodPost, "/auth/token", map[string]string{"code": code}).expect(t, http.StatusOK, &tokens)
+	if len(tokens.AccessToken) == 0 || len(tokens.RefreshToken) == 0 {
+		t.Fatalf("expected tokens, got %+v", tokens)
+	}
+	api.do(&testUser{User: player.User, token: tokens.AccessToken}, http.MethodGet, "/api/profile", nil).expect(t, http.StatusOK, nil)
+
+	// Codes are single-use
+	api.do(nil, http.MethodPost, "/auth/token", map[string]string{"code": code}).expectError(t, http.StatusUnauthorized, "Invalid login code")
+
+	expired, expiredHash, err := auth.GenerateLoginCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.Create(&models.LoginCode{CodeHash: expiredHash, UserID: player.ID, ExpiresAt: time.Now().Add(-time.Second)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	api.do(nil, http.MethodPost, "/auth/token", map[string]string{"code": expired}).expectError(t, http.StatusUnauthorized, "Invalid login code")
+}
+
+// loggedInUser exchanges the login code of a provider login for tokens and returns the profile of the user
+func loggedInUser(t *testing.T, api *testAPI, login url.Values) dto.UserResponse {
+	t.Helper()
+
+	if len(login.Get("code")) == 0 {
+		t.Fatalf("expected a login code, got %v", login)
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	api.do(nil, http.MethodPost, "/auth/token", map[string]string{"code": login.Get("code")}).expect(t, http.StatusOK, &tokens)
+
+	var profile struct {
+		User dto.UserResponse `json:"user"`
+	}
+	api.do(&testUser{token: tokens.AccessToken}, http.MethodGet, "/api/profile", nil).expect(t, http.StatusOK, &profile)
+	return profile.User
+}
+
+func TestProviderLogin(t *testing.T) {
+	api := newTestAPI(t)
+	player := api.user("Player", models.UserRolePlayer)
+
+	t.Run("links the user with the verified email", func(t *testing.T) {
+		subject := uuid.NewString()
+		user := loggedInUser(t, api, api.providerLogin(auth.Identity{Subject: subject, Email: player.Email, EmailVerified: true}))
+		if user.ID != player.ID {
+			t.Fatalf("expected the existing user %s, got %s", player.ID, user.ID)
+		}
+
+		// Later logins find the user by subject, whatever the email the provider reports
+		user = loggedInUser(t, api, api.providerLogin(auth.Identity{Subject: subject, Email: "renamed-" + player.Email}))
+		if user.ID != player.ID {
+			t.Errorf("expected the linked user %s, got %s", player.ID, user.ID)
+		}
+	})
+
+	t.Run("creates a player for a new verified email", func(t *testing.T) {
+		email := "new-" + uuid.NewString()[:8] + "@example.com"
+		user := loggedInUser(t, api, api.providerLogin(auth.Identity{Subject: uuid.NewString(), Email: email, EmailVerified: true, Name: "Newcomer"}))
+		if user.ID == player.ID || user.Name != "Newcomer" || user.Role != models.UserRolePlayer {
+			t.Errorf("expected a new player, got %+v", user)
+		}
+
+		var count int64
+		if err := testDB.Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("expected one user with the email, got %d", count)
+		}
+	})
+
+	t.Run("refuses unverified emails", func(t *testing.T) {
+		for _, identity := range []auth.Identity{
+			{Subject: uuid.NewString(), Email: player.Email},
+			{Subject: uuid.NewString(), Email: "unverified-" + uuid.NewString()[:8] + "@example.com"},
+			{Subject: uuid.NewString(), EmailVerified: true},
+		} {
+			login := api.providerLogin(identity)
+			if login.Get("error") != handlers.LoginErrorEmailNotVerified || len(login.Get("code")) > 0 {
+				t.Errorf("expected %s for %+v, got %v", handlers.LoginErrorEmailNotVerified, identity, login)
+			}
+
+			var count int64
+			if err := testDB.Model(&models.UserIdentity{}).Where("subject = ?", identity.Subject).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Errorf("expected %+v not to be linked", identity)
+			}
+		}
+	})
+}
+
+func TestRolePermissions(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	owner := api.user("Owner", models.UserRoleGroupOwner)
+	player := api.user("Player", models.UserRolePlayer)
+
+	for _, test := range []struct {
+		name   string
+		user   *testUser
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"players list courts", player, http.MethodGet, "/api/courts", nil, http.StatusOK},
+		{"players cannot create groups", player, http.MethodPost, "/api/groups", map[string]string{"name": "Club"}, http.StatusForbidden},
+		{"group owners cannot create groups", owner, http.MethodPost, "/api/groups", map[string]string{"name": "Club"}, http.StatusForbidden},
+		{"admins create groups", admin, http.MethodPost, "/api/groups", map[string]string{"name": "Club"}, http.StatusCreated},
+		{"players cannot list users", player, http.MethodGet, "/api/admin/users", nil, http.StatusForbidden},
+		{"group owners cannot manage courts", owner, http.MethodPost, "/api/admin/courts", map[string]string{"name": "Hall"}, http.StatusForbidden},
+		{"admins list users", admin, http.MethodGet, "/api/admin/users", nil, http.StatusOK},
+		{"admins list roles", admin, http.MethodGet, "/api/admin/roles", nil, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			api.do(test.user, test.method, test.path, test.body).expect(t, test.status, nil)
+		})
+	}
+}
+
+func TestCourtFlow(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	player := api.user("Player", models.UserRolePlayer)
+
+	api.do(player, http.MethodPost, "/api/admin/courts", map[string]string{"name": "Hall A"}).expectError(t, http.StatusForbidden, "Admin access required")
+
+	var court struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		Address string `json:"address"`
+	}
+	api.do(admin, http.MethodPost, "/api/admin/courts", map[string]interface{}{
+		"name":                    "Hall A",
+		"address":                 "1 Court Road",
+		"google_map_url":          "https://maps.google.com/?q=hall+a",
+		"estimate_price_per_hour": "12.50",
+	}).expect(t, http.StatusOK, &court)
+
+	api.do(admin, http.MethodPost, "/api/admin/courts", map[string]interface{}{"name": "Hall B", "google_map_url": "not a url"}).
+		expectError(t, http.StatusBadRequest, "Invalid Google Map URL")
+
+	// Changes must name the version they were made to
+	fetched := api.do(player, http.MethodGet, "/api/courts/"+court.ID, nil)
+	fetched.expect(t, http.StatusOK, nil)
+	renovation := map[string]interface{}{
+		"name":                    "Hall A (renovated)",
+		"address":                 "1 Court Road",
+		"estimate_price_per_hour": "15",
+	}
+	api.do(admin, http.MethodPut, "/api/admin/courts/"+court.ID, renovation).
+		expectError(t, http.StatusPreconditionRequired, "If-Match header is required")
+	updated := api.do(admin, http.MethodPut, "/api/admin/courts/"+court.ID, renovation, "If-Match", fetched.header.Get("ETag"))
+	updated.expect(t, http.StatusOK, nil)
+	if updated.header.Get("ETag") == fetched.header.Get("ETag") {
+		t.Errorf("expected the update to change the ETag %s", fetched.header.Get("ETag"))
+	}
+
+	api.do(player, http.MethodGet, "/api/courts/"+court.ID, nil, "If-None-Match", fetched.header.Get("ETag")).expect(t, http.StatusOK, &court)
+	if court.Name != "Hall A (renovated)" {
+		t.Errorf("expected the court to be renamed, got %q", court.Name)
+	}
+	api.do(player, http.MethodGet, "/api/courts/"+court.ID, nil, "If-None-Match", updated.header.Get("ETag")).expect(t, http.StatusNotModified, nil)
+
+	// Changes made to the version before the update are refused
+	api.do(admin, http.MethodPatch, "/api/admin/courts/"+court.ID, map[string]interface{}{"address": "2 Court Road"}, "If-Match", fetched.header.Get("ETag")).
+		expectError(t, http.StatusPreconditionFailed, "Court changed since it was fetched")
+	patched := api.do(admin, http.MethodPatch, "/api/admin/courts/"+court.ID, map[string]interface{}{"address": "2 Court Road"}, "If-Match", updated.header.Get("ETag"))
+	patched.expect(t, http.StatusOK, &court)
+	if court.Name != "Hall A (renovated)" || court.Address != "2 Court Road" {
+		t.Errorf("expected only the address to change, got %q %q", court.Name, court.Address)
+	}
+
+	api.do(admin, http.MethodDelete, "/api/admin/courts/"+court.ID, nil, "If-Match", updated.header.Get("ETag")).
+		expectError(t, http.StatusPreconditionFailed, "Court changed since it was fetched")
+	api.do(admin, http.MethodDelete, "/api/admin/courts/"+court.ID, nil, "If-Match", patched.header.Get("ETag")).expect(t, http.StatusOK, nil)
+	api.do(player, http.MethodGet, "/api/courts/"+court.ID, nil).expectError(t, http.StatusNotFound, "Court not found")
+}
+
+func TestGroupFlow(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	member := api.user("Member", models.UserRolePlayer)
+	outsider := api.user("Outsider", models.UserRolePlayer)
+	groupID := createGroup(t, api, admin, member)
+
+	api.do(admin, http.MethodPost, "/api/groups/"+groupID+"/players", map[string]string{"user_email": member.Email}).
+		expectError(t, http.StatusBadRequest, "User is already a member of the group")
+
+	var group struct {
+		OwnerID string `json:"owner_id"`
+		Members []struct {
+			ID        string `json:"id"`
+			GroupRole string `json:"group_role"`
+		} `json:"members"`
+	}
+	api.do(member, http.MethodGet, "/api/groups/"+groupID, nil).expect(t, http.StatusOK, &group)
+	if len(group.Members) != 2 {
+		t.Errorf("expected 2 members, got %+v", group.Members)
+	}
+	api.do(outsider, http.MethodGet, "/api/groups/"+groupID, nil).expectError(t, http.StatusForbidden, "You are not a member of this group")
+
+	var groups struct {
+		Total int `json:"total"`
+	}
+	api.do(outsider, http.MethodGet, "/api/groups", nil).expect(t, http.StatusOK, &groups)
+	if groups.Total != 0 {
+		t.Errorf("expected the outsider to have no groups, got %d", groups.Total)
+	}
+
+	// Ownership is handed to a member, the previous owner stays on as co-organizer
+	api.do(admin, http.MethodPut, "/api/groups/"+groupID+"/owner", map[string]string{"user_id": outsider.ID}).
+		expectError(t, http.StatusBadRequest, "The new owner must be a member of the group")
+	api.do(admin, http.MethodPut, "/api/groups/"+groupID+"/owner", map[string]string{"user_id": member.ID}).expect(t, http.StatusOK, nil)
+	api.do(member, http.MethodGet, "/api/groups/"+groupID, nil).expect(t, http.StatusOK, &group)
+	if group.OwnerID != member.ID {
+		t.Errorf("expected %s to own the group, got %s", member.ID, group.OwnerID)
+	}
+	for _, m := range group.Members {
+		expected := models.GroupRoleCoOrganizer
+		if m.ID == member.ID {
+			expected = models.GroupRoleOwner
+		}
+		if m.GroupRole != expected {
+			t.Errorf("expected %s to be %s, got %s", m.ID, expected, m.GroupRole)
+		}
+	}
+
+	api.do(member, http.MethodPost, "/api/groups/"+groupID+"/leave", nil).
+		expectError(t, http.StatusBadRequest, "The group owner cannot leave, transfer ownership first")
+	api.do(admin, http.MethodPost, "/api/groups/"+groupID+"/leave", nil).expect(t, http.StatusOK, nil)
+	api.do(admin, http.MethodPost, "/api/groups/"+groupID+"/leave", nil).expectError(t, http.StatusNotFound, "You are not a member of the group")
+}
+
+func TestPlayerOwnerManagesGroup(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	owner := api.user("Owner", models.UserRolePlayer)
+	member := api.user("Member", models.UserRolePlayer)
+	groupID := createGroup(t, api, admin, owner, member)
+
+	// Players handed a group manage it as its owner
+	api.do(admin, http.MethodPut, "/api/groups/"+groupID+"/owner", map[string]string{"user_id": owner.ID}).expect(t, http.StatusOK, nil)
+
+	fetched := api.do(owner, http.MethodGet, "/api/groups/"+groupID, nil)
+	fetched.expect(t, http.StatusOK, nil)
+	rename := map[string]interface{}{"name": "Friday club"}
+	api.do(member, http.MethodPut, "/api/groups/"+groupID, rename, "If-Match", fetched.header.Get("ETag")).
+		expectError(t, http.StatusForbidden, "You do not have permission to update this group")
+	api.do(owner, http.MethodPut, "/api/groups/"+groupID, rename, "If-Match", fetched.header.Get("ETag")).expect(t, http.StatusOK, nil)
+
+	api.do(member, http.MethodPut, "/api/groups/"+groupID+"/members/"+admin.ID+"/role", map[string]string{"role": models.GroupRoleMember}).
+		expectError(t, http.StatusForbidden, "Only the group owner can change member roles")
+	api.do(owner, http.MethodPut, "/api/groups/"+groupID+"/members/"+member.ID+"/role", map[string]string{"role": models.GroupRoleCoOrganizer}).
+		expect(t, http.StatusOK, nil)
+	api.do(owner, http.MethodDelete, "/api/groups/"+groupID+"/members/"+member.ID, nil).expect(t, http.StatusOK, nil)
+
+	api.do(owner, http.MethodPut, "/api/groups/"+groupID+"/owner", map[string]string{"user_id": admin.ID}).expect(t, http.StatusOK, nil)
+}
+
+func TestSessionFlow(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	member := api.user("Member", models.UserRolePlayer)
+	late := api.user("Late", models.UserRolePlayer)
+	outsider := api.user("Outsider", models.UserRolePlayer)
+	groupID := createGroup(t, api, admin, member, late)
+
+	api.do(outsider, http.MethodPost, "/api/sessions", map[string]interface{}{
+		"group_id":    groupID,
+		"max_members": 2,
+		"date_time":   time.Now().Add(48 * time.Hour),
+	}).expectError(t, http.StatusForbidden, "Only group members can create sessions for the group")
+
+	var session idResponse
+	api.do(admin, http.MethodPost, "/api/sessions", map[string]interface{}{
+		"group_id":    groupID,
+		"description": "Doubles night",
+		"max_members": 2,
+		"date_time":   time.Now().Add(48 * time.Hour),
+	}).expect(t, http.StatusOK, &session)
+	sessionPath := "/api/sessions/" + session.ID
+
+	// Group sessions are only visible to and attended by the group
+	api.do(outsider, http.MethodGet, sessionPath, nil).expectError(t, http.StatusForbidden, "You must be a member of the group to view this session")
+	api.do(outsider, http.MethodPost, sessionPath+"/attend", map[string]int{"slot": 1}).
+		expectError(t, http.StatusForbidden, "Only group members can attend this session")
+
+	var sessions struct {
+		Data []idResponse `json:"data"`
+	}
+	api.do(outsider, http.MethodGet, "/api/sessions?limit=100", nil).expect(t, http.StatusOK, &sessions)
+	for _, s := range sessions.Data {
+		if s.ID == session.ID {
+			t.Error("expected the group session to be hidden from the outsider")
+		}
+	}
+
+	// Attendance is capped by the max members
+	api.do(member, http.MethodPost, sessionPath+"/attend", map[string]int{"slot": 2}).expect(t, http.StatusOK, nil)
+	api.do(member, http.MethodPost, sessionPath+"/attend", map[string]int{"slot": 1}).
+		expectError(t, http.StatusBadRequest, "User is already attending this session")
+	api.do(late, http.MethodPost, sessionPath+"/attend", map[string]int{"slot": 1}).
+		expectError(t, http.StatusBadRequest, "Session is full: max members is 2")
+
+	var details struct {
+		CurrentMembers int `json:"current_members"`
+		Attendees      []struct {
+			UserID string `json:"user_id"`
+		} `json:"attendees"`
+	}
+	api.do(late, http.MethodGet, sessionPath, nil).expect(t, http.StatusOK, &details)
+	if len(details.Attendees) != 1 || details.Attendees[0].UserID != member.ID {
+		t.Errorf("expected the member to attend, got %+v", details.Attendees)
+	}
+
+	// Cancelling frees the slots
+	api.do(member, http.MethodDelete, sessionPath+"/attend", nil).expect(t, http.StatusOK, nil)
+	api.do(member, http.MethodDelete, sessionPath+"/attend", nil).expectError(t, http.StatusNotFound, "Attendance record not found")
+	api.do(late, http.MethodPost, sessionPath+"/attend", map[string]int{"slot": 2}).expect(t, http.StatusOK, nil)
+
+	// Attending changes the session, so organizers editing it concurrently refetch it
+	fetched := api.do(admin, http.MethodGet, sessionPath, nil)
+	fetched.expect(t, http.StatusOK, nil)
+	api.do(admin, http.MethodGet, sessionPath, nil, "If-None-Match", fetched.header.Get("ETag")).expect(t, http.StatusNotModified, nil)
+	api.do(late, http.MethodDelete, sessionPath+"/attend", nil).expect(t, http.StatusOK, nil)
+	api.do(admin, http.MethodPatch, sessionPath, map[string]int{"max_members": 4}, "If-Match", fetched.header.Get("ETag")).
+		expectError(t, http.StatusPreconditionFailed, "Session changed since it was fetched")
+	api.do(admin, http.MethodGet, sessionPath, nil, "If-None-Match", fetched.header.Get("ETag")).expect(t, http.StatusOK, nil)
+
+	fetched = api.do(admin, http.MethodGet, sessionPath, nil)
+	api.do(member, http.MethodDelete, sessionPath, nil, "If-Match", fetched.header.Get("ETag")).
+		expectError(t, http.StatusForbidden, "You are not the creator of this session")
+	api.do(admin, http.MethodDelete, sessionPath, nil).expectError(t, http.StatusPreconditionRequired, "If-Match header is required")
+	api.do(admin, http.MethodDelete, sessionPath, nil, "If-Match", fetched.header.Get("ETag")).expect(t, http.StatusOK, nil)
+	api.do(late, http.MethodGet, sessionPath, nil).expectError(t, http.StatusNotFound, "Session not found")
+}
+
+func TestConcurrentJoinsRespectCapacity(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	players := make([]*testUser, 20)
+	for i := range players {
+		players[i] = api.user(fmt.Sprintf("Player%d", i), models.UserRolePlayer)
+	}
+	groupID := createGroup(t, api, admin, players...)
+
+	const maxMembers = 5
+	var session idResponse
+	api.do(admin, http.MethodPost, "/api/sessions", map[string]interface{}{
+		"group_id":    groupID,
+		"max_members": maxMembers,
+		"date_time":   time.Now().Add(48 * time.Hour),
+	}).expect(t, http.StatusOK, &session)
+	sessionPath := "/api/sessions/" + session.ID
+
+	// Every player joins at once, only as many as the session has slots for get in. The goroutines only record the
+	// outcome, the test fails on its own goroutine.
+	requests := make([]*http.Request, len(players))
+	for i, player := range players {
+		requests[i] = api.request(player, http.MethodPost, sessionPath+"/attend", map[string]int{"slot": 1})
+	}
+	statuses := make([]int, len(requests))
+	errs := make([]error, len(requests))
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := api.server.Client().Do(req)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			res.Body.Close()
+			statuses[i] = res.StatusCode
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	joined := 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			joined++
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("expected 200 or 400, got %d", status)
+		}
+	}
+	if joined != maxMembers {
+		t.Errorf("expected %d players to join, got %d", maxMembers, joined)
+	}
+
+	var details struct {
+		CurrentMembers int `json:"current_members"`
+	}
+	api.do(admin, http.MethodGet, sessionPath, nil).expect(t, http.StatusOK, &details)
+	if details.CurrentMembers != maxMembers {
+		t.Errorf("expected %d members, got %d", maxMembers, details.CurrentMembers)
+	}
+}
+
+func TestUserRoleChange(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	player := api.user("Player", models.UserRolePlayer)
+
+	var user struct {
+		User struct {
+			Role string `json:"role"`
+		} `json:"user"`
+		Permissions []string `json:"permissions"`
+	}
+	api.do(admin, http.MethodGet, "/api/admin/users/"+player.ID, nil).expect(t, http.StatusOK, &user)
+	if user.User.Role != models.UserRolePlayer {
+		t.Errorf("expected a player, got %s", user.User.Role)
+	}
+
+	api.do(player, http.MethodPut, "/api/admin/users/"+player.ID, map[string]interface{}{"roles": []string{models.UserRoleAdmin}}).
+		expectError(t, http.StatusForbidden, "Admin access required")
+	api.do(admin, http.MethodPut, "/api/admin/users/"+player.ID, map[string]interface{}{"roles": []string{models.UserRoleGroupOwner}}).
+		expect(t, http.StatusOK, nil)
+
+	// Tokens carrying the previous roles are refused until refreshed
+	api.do(player, http.MethodGet, "/api/profile", nil).expect(t, http.StatusUnauthorized, nil)
+
+	player = api.login(player.ID)
+	api.do(player, http.MethodGet, "/api/profile", nil).expect(t, http.StatusOK, &user)
+	if user.User.Role != models.UserRoleGroupOwner {
+		t.Errorf("expected a group owner, got %s", user.User.Role)
+	}
+}
+
+func TestAdminCreatedAPIKeys(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	player := api.user("Player", models.UserRolePlayer)
+
+	var created struct {
+		ID      string `json:"id"`
+		Key     string `json:"key"`
+		Pending bool   `json:"pending"`
+	}
+	api.do(admin, http.MethodPost, "/api/admin/users/"+player.ID+"/api-keys", map[string]interface{}{
+		"name":   "Attendance export",
+		"scopes": []string{"list_courts"},
+	}).expect(t, http.StatusCreated, &created)
+	if len(created.Key) > 0 || !created.Pending {
+		t.Fatalf("expected a pending key without the key itself, got %+v", created)
+	}
+
+	// Only the user issues the key itself
+	issue := "/api/api-keys/" + created.ID + "/issue"
+	api.do(admin, http.MethodPost, issue, nil).expectError(t, http.StatusNotFound, "API key not found")
+
+	var issued struct {
+		Key     string `json:"key"`
+		Pending bool   `json:"pending"`
+	}
+	api.do(player, http.MethodPost, issue, nil).expect(t, http.StatusOK, &issued)
+	if len(issued.Key) == 0 || issued.Pending {
+		t.Fatalf("expected the issued key, got %+v", issued)
+	}
+	api.do(&testUser{token: issued.Key}, http.MethodGet, "/api/courts", nil).expect(t, http.StatusOK, nil)
+
+	api.do(player, http.MethodPost, issue, nil).expectError(t, http.StatusConflict, "API key was already issued")
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	api := newTestAPI(t)
+	player := api.user("Player", models.UserRolePlayer)
+	other := api.user("Other", models.UserRolePlayer)
+
+	api.do(player, http.MethodPost, "/api/api-keys", map[string]interface{}{"name": "Export", "scopes": []string{"nope"}}).
+		expectError(t, http.StatusBadRequest, "Invalid scope: nope")
+
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	api.do(player, http.MethodPost, "/api/api-keys", map[string]interface{}{
+		"name":   "Export",
+		"scopes": []string{"list_courts", "create_groups"},
+	}).expect(t, http.StatusCreated, &created)
+	key := &testUser{token: created.Key}
+
+	api.do(key, http.MethodGet, "/api/courts", nil).expect(t, http.StatusOK, nil)
+	api.do(key, http.MethodGet, "/api/groups", nil).expectError(t, http.StatusForbidden, "API key is missing the list_groups scope")
+
+	// Scopes only narrow the permissions of the user
+	api.do(key, http.MethodPost, "/api/groups", map[string]string{"name": "Club"}).
+		expectError(t, http.StatusForbidden, "You do not have permission to perform this action")
+
+	// Keys cannot manage keys
+	api.do(key, http.MethodPost, "/api/api-keys", map[string]interface{}{"name": "More", "scopes": []string{"list_courts"}}).
+		expectError(t, http.StatusForbidden, "Not allowed with an API key")
+
+	api.do(other, http.MethodDelete, "/api/api-keys/"+created.ID, nil).expectError(t, http.StatusNotFound, "API key not found")
+	api.do(player, http.MethodDelete, "/api/api-keys/"+created.ID, nil).expect(t, http.StatusOK, nil)
+	api.do(key, http.MethodGet, "/api/courts", nil).expectError(t, http.StatusUnauthorized, "Invalid API key")
+}
+
+func TestImpersonation(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	otherAdmin := api.user("OtherAdmin", models.UserRoleAdmin)
+	player := api.user("Player", models.UserRolePlayer)
+	groupID := createGroup(t, api, admin, player)
+
+	reason := map[string]string{"reason": "Reproduce the missing session"}
+	api.do(admin, http.MethodPost, "/api/admin/users/"+otherAdmin.ID+"/impersonate", reason).
+		expectError(t, http.StatusForbidden, "Admins cannot be impersonated")
+
+	var started struct {
+		AccessToken string `json:"access_token"`
+	}
+	api.do(admin, http.MethodPost, "/api/admin/users/"+player.ID+"/impersonate", reason).expect(t, http.StatusCreated, &started)
+	impersonated := &testUser{User: player.User, token: started.AccessToken}
+
+	// Requests are made as the user and marked with the admin
+	var profile struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	res := api.do(impersonated, http.MethodGet, "/api/profile", nil)
+	res.expect(t, http.StatusOK, &profile)
+	if profile.User.ID != player.ID || res.header.Get("X-Impersonated-By") != admin.ID {
+		t.Errorf("expected to act as %s for %s, got %s marked by %q", player.ID, admin.ID, profile.User.ID, res.header.Get("X-Impersonated-By"))
+	}
+
+	// Sensitive actions are forbidden
+	for _, request := range []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodPost, "/api/api-keys", map[string]interface{}{"name": "Export", "scopes": []string{"list_courts"}}},
+		{http.MethodPut, "/api/groups/" + groupID + "/owner", map[string]string{"user_id": admin.ID}},
+		{http.MethodPost, "/api/auth/logout-all", nil},
+	} {
+		api.do(impersonated, request.method, request.path, request.body).
+			expectError(t, http.StatusForbidden, "Not allowed while impersonating a user")
+	}
+
+	var impersonations struct {
+		Total int `json:"total"`
+	}
+	api.do(admin, http.MethodGet, "/api/admin/impersonations?user_id="+player.ID, nil).expect(t, http.StatusOK, &impersonations)
+	if impersonations.Total != 1 {
+		t.Errorf("expected the impersonation to be recorded, got %d", impersonations.Total)
+	}
+
+	api.do(impersonated, http.MethodDelete, "/api/auth/impersonation", nil).expect(t, http.StatusOK, nil)
+	api.do(impersonated, http.MethodGet, "/api/profile", nil).expectError(t, http.StatusUnauthorized, "Token has been revoked")
+}
+
+func TestGroupJoinRequests(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	member := api.user("Member", models.UserRolePlayer)
+	approved := api.user("Approved", models.UserRolePlayer)
+	rejected := api.user("Rejected", models.UserRolePlayer)
+	groupID := createGroup(t, api, admin, member)
+
+	// Private groups cannot be joined
+	api.do(approved, http.MethodPost, "/api/groups/"+groupID+"/join", map[string]string{}).expectError(t, http.StatusNotFound, "Group not found")
+
+	fetched := api.do(admin, http.MethodGet, "/api/groups/"+groupID, nil)
+	fetched.expect(t, http.StatusOK, nil)
+	api.do(admin, http.MethodPut, "/api/groups/"+groupID, map[string]string{"name": "Thursday club", "visibility": models.GroupVisibilityDiscoverable},
+		"If-Match", fetched.header.Get("ETag")).expect(t, http.StatusOK, nil)
+
+	requests := make(map[string]string)
+	for _, user := range []*testUser{approved, rejected} {
+		var request idResponse
+		api.do(user, http.MethodPost, "/api/groups/"+groupID+"/join", map[string]string{"message": "Hi"}).expect(t, http.StatusCreated, &request)
+		requests[user.ID] = request.ID
+	}
+	api.do(approved, http.MethodPost, "/api/groups/"+groupID+"/join", map[string]string{}).
+		expectError(t, http.StatusBadRequest, "You already have a pending request for this group")
+
+	// Only organizers review the requests
+	review := func(user *testUser, requestID string, status string) *testResponse {
+		return api.do(user, http.MethodPut, "/api/groups/"+groupID+"/join-requests/"+requestID, map[string]string{"status": status})
+	}
+	review(member, requests[approved.ID], "approved").expectError(t, http.StatusForbidden, "Only group organizers can review join requests")
+
+	var pending struct {
+		Total int `json:"total"`
+	}
+	api.do(admin, http.MethodGet, "/api/groups/"+groupID+"/join-requests", nil).expect(t, http.StatusOK, &pending)
+	if pending.Total != 2 {
+		t.Errorf("expected 2 pending requests, got %d", pending.Total)
+	}
+
+	review(admin, requests[approved.ID], "approved").expect(t, http.StatusOK, nil)
+	review(admin, requests[rejected.ID], "rejected").expect(t, http.StatusOK, nil)
+	review(admin, requests[rejected.ID], "approved").expectError(t, http.StatusBadRequest, "Join request has already been reviewed")
+
+	api.do(approved, http.MethodGet, "/api/groups/"+groupID, nil).expect(t, http.StatusOK, nil)
+	api.do(rejected, http.MethodGet, "/api/groups/"+groupID, nil).expectError(t, http.StatusForbidden, "You are not a member of this group")
+}
+
+func TestAnnouncementsAndComments(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	member := api.user("Member", models.UserRolePlayer)
+	outsider := api.user("Outsider", models.UserRolePlayer)
+	groupID := createGroup(t, api, admin, member)
+
+	// Organizers post announcements to the group feed, mentioning its members
+	announcements := "/api/groups/" + groupID + "/announcements"
+	api.do(member, http.MethodPost, announcements, map[string]interface{}{"title": "Hall closed", "content": "No play on Thursday"}).
+		expectError(t, http.StatusForbidden, "Only group organizers can post announcements")
+	api.do(admin, http.MethodPost, announcements, map[string]interface{}{"title": "Hall closed", "content": "No play on Thursday", "mentions": []string{outsider.ID}}).
+		expectError(t, http.StatusBadRequest, "Mentioned users must be members of the group")
+	api.do(admin, http.MethodPost, announcements, map[string]interface{}{"title": "Hall closed", "content": "No play on Thursday", "mentions": []string{member.ID}}).
+		expect(t, http.StatusCreated, nil)
+
+	var feed struct {
+		Total int `json:"total"`
+	}
+	api.do(member, http.MethodGet, announcements, nil).expect(t, http.StatusOK, &feed)
+	if feed.Total != 1 {
+		t.Errorf("expected 1 announcement, got %d", feed.Total)
+	}
+	api.do(outsider, http.MethodGet, announcements, nil).expectError(t, http.StatusForbidden, "You are not a member of this group")
+
+	// Comments are visible to whoever can see the session
+	var session idResponse
+	api.do(admin, http.MethodPost, "/api/sessions", map[string]interface{}{
+		"group_id":    groupID,
+		"max_members": 4,
+		"date_time":   time.Now().Add(48 * time.Hour),
+	}).expect(t, http.StatusOK, &session)
+	comments := "/api/sessions/" + session.ID + "/comments"
+
+	var comment idResponse
+	api.do(member, http.MethodPost, comments, map[string]interface{}{"content": "Who brings shuttles?"}).expect(t, http.StatusCreated, &comment)
+	api.do(outsider, http.MethodPost, comments, map[string]interface{}{"content": "Can I come?"}).
+		expectError(t, http.StatusForbidden, "You must be a member of the group to view this session")
+	api.do(outsider, http.MethodGet, comments, nil).
+		expectError(t, http.StatusForbidden, "You must be a member of the group to view this session")
+
+	// Only authors edit their comments, organizers may delete them
+	api.do(admin, http.MethodPut, comments+"/"+comment.ID, map[string]interface{}{"content": "Edited"}).
+		expectError(t, http.StatusForbidden, "You are not the author of this comment")
+	api.do(member, http.MethodPut, comments+"/"+comment.ID, map[string]interface{}{"content": "I bring shuttles", "mentions": []string{admin.ID}}).
+		expect(t, http.StatusOK, nil)
+	api.do(admin, http.MethodDelete, comments+"/"+comment.ID, nil).expect(t, http.StatusOK, nil)
+
+	var thread struct {
+		Total int `json:"total"`
+	}
+	api.do(member, http.MethodGet, comments, nil).expect(t, http.StatusOK, &thread)
+	if thread.Total != 0 {
+		t.Errorf("expected the comment to be deleted, got %d", thread.Total)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.user("Admin", models.UserRoleAdmin)
+	player := api.user("Player", models.UserRolePlayer)
+	groupID := createGroup(t, api, admin, player)
+
+	api.do(admin, http.MethodPut, "/api/admin/users/"+player.ID, map[string]interface{}{"roles": []string{models.UserRoleGroupOwner}}).
+		expect(t, http.StatusOK, nil)
+
+	var logs struct {
+		Data  []dto.AuditLogResponse `json:"data"`
+		Total int                    `json:"total"`
+	}
+	api.do(admin, http.MethodGet, "/api/admin/audit-logs?action=user.update&resource_id="+player.ID, nil).expect(t, http.StatusOK, &logs)
+	if logs.Total != 1 || len(logs.Data) != 1 {
+		t.Fatalf("expected the role change to be recorded once, got %d", logs.Total)
+	}
+	entry := logs.Data[0]
+	if entry.ActorID != admin.ID || entry.ResourceType != "user" || entry.Method != http.MethodPut || entry.Status != http.StatusOK {
+		t.Errorf("expected a PUT by %s on the user, got %+v", admin.ID, entry)
+	}
+	roles, ok := entry.Changes["roles"]
+	if !ok || string(roles.Before) != `["player"]` || string(roles.After) != `["group_owner"]` {
+		t.Errorf("expected the roles to change from player to group_owner, got %+v", entry.Changes)
+	}
+	if _, ok := entry.Changes["avatar_url"]; ok {
+		t.Errorf("expected only the changed fields to be recorded, got %+v", entry.Changes)
+	}
+
+	// Changes made while impersonating are recorded for the user and marked with the admin
+	var started struct {
+		AccessToken string `json:"access_token"`
+	}
+	api.do(admin, http.MethodPost, "/api/admin/users/"+player.ID+"/impersonate", map[string]string{"reason": "Leave the group for the player"}).
+		expect(t, http.StatusCreated, &started)
+	impersonated := &testUser{User: player.User, token: started.AccessToken}
+	api.do(impersonated, http.MethodPost, "/api/groups/"+groupID+"/leave", nil).expect(t, http.StatusOK, nil)
+
+	api.do(admin, http.MethodGet, "/api/admin/audit-logs?action=group.leave&resource_id="+groupID, nil).expect(t, http.StatusOK, &logs)
+	if logs.Total != 1 || len(logs.Data) != 1 {
+		t.Fatalf("expected the impersonated change to be recorded once, got %d", logs.Total)
+	}
+	if entry := logs.Data[0]; entry.ActorID != player.ID || entry.ImpersonatedBy != admin.ID {
+		t.Errorf("expected a change by %s impersonated by %s, got %+v", player.ID, admin.ID, entry)
+	}
+
+	// Reads and failed requests are not recorded
+	api.do(admin, http.MethodGet, "/api/admin/audit-logs?actor_id="+admin.ID+"&resource_type=user", nil).expect(t, http.StatusOK, &logs)
+	for _, entry := range logs.Data {
+		if entry.Method == http.MethodGet || entry.Status >= http.StatusBadRequest {
+			t.Errorf("expected only successful changes to be recorded, got %+v", entry)
+		}
+	}
+
+	api.do(admin, http.MethodGet, "/api/admin/audit-logs?from=yesterday", nil).expectError(t, http.StatusBadRequest, "Invalid from time")
+	api.do(api.login(player.ID), http.MethodGet, "/api/admin/audit-logs", nil).expect(t, http.StatusForbidden, nil)
+}
@@ -0,0 +1,65 @@
+// Package jobs holds the maintenance jobs meant to run on a schedule, outside of requests.
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"gorm.io/gorm"
+)
+
+// Job is a maintenance job, Run returns the number of rows it changed
+type Job struct {
+	Name        string
+	Description string
+	Run         func(db *gorm.DB) (int64, error)
+}
+
+// All lists every maintenance job in the order they are run
+var All = []Job{
+	{
+		Name:        "purge-revoked-tokens",
+		Description: "Delete revoked access tokens that have expired anyway",
+		Run:         PurgeRevokedTokens,
+	},
+	{
+		Name:        "purge-refresh-tokens",
+		Description: "Delete refresh tokens that have expired",
+		Run:         PurgeRefreshTokens,
+	},
+	{
+		Name:        "purge-login-codes",
+		Description: "Delete login codes that were never exchanged",
+		Run:         PurgeLoginCodes,
+	},
+}
+
+// Find returns the job with a name
+func Find(name string) (Job, error) {
+	for _, job := range All {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	return Job{}, fmt.Errorf("unknown job %s", name)
+}
+
+// PurgeRevokedTokens deletes the revoked access tokens past their expiry, which are refused anyway
+func PurgeRevokedTokens(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeRefreshTokens deletes the refresh tokens past their expiry. Their access tokens have expired long before,
+// so nothing is left to revoke when an expired token is replayed.
+func PurgeRefreshTokens(db *gorm.DB) (int64, error) {
+	result := db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeLoginCodes deletes the login codes past their expiry, left behind by logins the frontend never completed
+func PurgeLoginCodes(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at < ?", time.Now()).Delete(&models.LoginCode{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,67 @@
+// Package mergepatch applies JSON Merge Patches (RFC 7396). A patch is a JSON document that looks like the
+// resource it changes: the members it holds replace those of the resource, objects are merged member by member,
+// and null removes a member. Anything other than an object, arrays included, replaces the value as a whole.
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// MIMEMergePatch is the content type of JSON Merge Patches
+const MIMEMergePatch = "application/merge-patch+json"
+
+var errTrailingData = errors.New("mergepatch: invalid data after the JSON document")
+
+// Apply applies the patch to the JSON document and returns the result
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var patchValue interface{}
+	if err := decode(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	var docValue interface{}
+	if len(bytes.TrimSpace(doc)) > 0 {
+		if err := decode(doc, &docValue); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(merge(docValue, patchValue))
+}
+
+// merge merges the patch into the target, following the MergePatch function of RFC 7396
+func merge(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = merge(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// decode decodes a JSON document keeping its numbers as they are written
+func decode(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	// A document holds a single value
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package mergepatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestApply covers the examples of RFC 7396
+func TestApply(t *testing.T) {
+	for _, test := range []struct {
+		doc    string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{``, `{"a":1}`, `{"a":1}`},
+		{`{"cost":"12.50","slots":9007199254740993}`, `{"name":"Hall"}`, `{"cost":"12.50","name":"Hall","slots":9007199254740993}`},
+	} {
+		result, err := Apply([]byte(test.doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %v", test.doc, test.patch, err)
+			continue
+		}
+		if !equalJSON(t, result, []byte(test.result)) {
+			t.Errorf("%s + %s: expected %s, got %s", test.doc, test.patch, test.result, result)
+		}
+	}
+}
+
+func TestApplyInvalidPatch(t *testing.T) {
+	for _, patch := range []string{``, `{"a":`, `{"a":1}}`, `{"a":1} {"b":2}`} {
+		if _, err := Apply([]byte(`{"a":"b"}`), []byte(patch)); err == nil {
+			t.Errorf("expected %q to be refused", patch)
+		}
+	}
+}
+
+func equalJSON(t *testing.T, a []byte, b []byte) bool {
+	t.Helper()
+
+	var va, vb interface{}
+	if err := decode(a, &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := decode(b, &vb); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/alanrb/badminton/backend/audit"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Audit middleware to append every successful change made by an authenticated user to the audit log.
+// Handlers describe the change with audit.Record, other changes are recorded with the route as action.
+func Audit(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+
+			method := c.Request().Method
+			if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+				return err
+			}
+			if err != nil || c.Response().Status >= http.StatusBadRequest {
+				return err
+			}
+
+			cc, ok := c.(*auth.Context)
+			if !ok || cc.AuthUser() == nil {
+				return err
+			}
+			authUser := cc.AuthUser()
+
+			entry, ok := audit.FromContext(c)
+			if !ok {
+				entry = routeEntry(c)
+			}
+
+			log := models.AuditLog{
+				ActorID:        authUser.ID,
+				ImpersonatedBy: authUser.ActorID,
+				APIKeyID:       authUser.APIKeyID,
+				Action:         entry.Action,
+				ResourceType:   entry.ResourceType,
+				ResourceID:     entry.ResourceID,
+				Changes:        entry.Changes,
+				Method:         method,
+				Path:           c.Request().URL.Path,
+				Status:         c.Response().Status,
+				RequestID:      c.Response().Header().Get(echo.HeaderXRequestID),
+				IPAddress:      c.RealIP(),
+				UserAgent:      c.Request().UserAgent(),
+			}
+			// The change is already made, a failure to record it must not fail the request
+			if dbErr := db.Create(&log).Error; dbErr != nil {
+				c.Logger().Errorf("failed to write audit log of %s %s: %v", method, log.Path, dbErr)
+			}
+
+			return err
+		}
+	}
+}
+
+// routeEntry describes a change from its route: the action is the route, the resource is named by the first
+// path segment after /api and /admin and identified by the first route parameter
+func routeEntry(c echo.Context) *audit.Entry {
+	entry := &audit.Entry{Action: c.Request().Method + " " + c.Path()}
+
+	segments := strings.Split(strings.Trim(c.Path(), "/"), "/")
+	for _, segment := range segments {
+		if segment == "api" || segment == "admin" {
+			continue
+		}
+		entry.ResourceType = strings.TrimSuffix(segment, "s")
+		break
+	}
+
+	if values := c.ParamValues(); len(values) > 0 {
+		entry.ResourceID = values[0]
+	}
+	return entry
+}
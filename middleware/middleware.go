@@ -1,104 +1,204 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/alanrb/badminton/backend/apperror"
 	"github.com/alanrb/badminton/backend/auth"
 	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/etag"
 	"github.com/alanrb/badminton/backend/handlers"
 	"github.com/alanrb/badminton/backend/models"
 	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
 )
 
+// HeaderImpersonatedBy carries the admin impersonating the user on every response
+const HeaderImpersonatedBy = "X-Impersonated-By"
+
 // AdminOnly middleware to check if the user is an admin
 func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		cc, ok := c.(*auth.Context)
 		if !ok {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Invalid context type"})
+			return apperror.Internal("Invalid context type", nil)
 		}
 
 		authUser := cc.AuthUser()
 		if authUser == nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "User not found"})
+			return apperror.Unauthorized("User not found")
 		}
 
-		// Early return if the user role is already known not to be admin
-		if authUser.Role != models.UserRoleAdmin {
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Admin access required"})
+		// Admin status comes from the roles of the user, not from the role carried by the token
+		grants, err := handlers.RequestGrants(c, database.DB)
+		if err != nil {
+			return apperror.Internal("Failed to check permissions", err)
 		}
-
-		// Double-check admin status in the database
-		var isAdmin = handlers.IsAdmin(database.DB, authUser.ID)
-		if !isAdmin {
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Admin access required"})
+		if !grants.HasRole(models.UserRoleAdmin) {
+			return apperror.Forbidden("Admin access required")
 		}
 
 		return next(c)
 	}
 }
 
+// Context middleware to wrap the echo context with the authentication context
 func Context(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		cc := &auth.Context{Context: c}
-
-		// Get user from AWS Cognito token if available
-		authorization := c.Request().Header.Get("CognitoAuthorization")
-		if len(authorization) > 0 {
-			// Parse JWT token from header and extract user ID
-			jwtString := strings.Split(authorization, "Bearer ")[1]
-			claims := jwt.MapClaims{}
-			_, _, err := jwt.NewParser().ParseUnverified(jwtString, claims)
+		return next(&auth.Context{Context: c})
+	}
+}
+
+// Cognito middleware to authenticate users from the AWS Cognito token, verified against the user pool's JWKS.
+// Users are the ones their Cognito identity is linked to, until it is linked their ID is the Cognito subject.
+func Cognito(verifier *auth.CognitoVerifier, db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			jwtString, ok := strings.CutPrefix(c.Request().Header.Get("CognitoAuthorization"), "Bearer ")
+			if !ok || len(strings.TrimSpace(jwtString)) == 0 {
+				return apperror.Unauthorized("Invalid authorization header")
+			}
+
+			claims, err := verifier.Verify(c.Request().Context(), strings.TrimSpace(jwtString))
 			if err != nil {
-				return c.JSON(http.StatusForbidden, map[string]string{"error": "MapClaims"})
+				c.Logger().Warnf("cognito token rejected: %v", err)
+				return apperror.Unauthorized("Invalid token")
 			}
 
-			issuer, err := claims.GetIssuer()
+			authUser := auth.CognitoAuthUser(claims)
+			identity := auth.CognitoIdentity(claims)
+			userID, err := handlers.LinkedUserID(db, identity)
 			if err != nil {
-				return c.JSON(http.StatusForbidden, map[string]string{"error": "Issuer"})
+				return apperror.Internal("Failed to verify user", err)
+			}
+			if len(userID) > 0 {
+				authUser.ID = userID
+			}
+
+			// Set user in context for later use
+			cc := c.(*auth.Context)
+			cc.SetAuthUser(authUser)
+			cc.Set(auth.IdentityKey, identity)
+			return next(cc)
+		}
+	}
+}
+
+// APIKey middleware authenticates personal API keys sent as a bearer token or in the X-API-Key header,
+// other requests are authenticated by the fallback middleware
+func APIKey(db *gorm.DB, fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		authenticateFallback := fallback(next)
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get("X-API-Key")
+			if bearer, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok && auth.IsAPIKey(bearer) {
+				key = bearer
+			}
+			if len(key) == 0 {
+				return authenticateFallback(c)
 			}
 
-			if issuer != os.Getenv("COGNITO_ISSUER") {
-				return c.JSON(http.StatusForbidden, map[string]string{"error": "Invalid issuer"})
+			authUser, err := handlers.AuthenticateAPIKey(db, strings.TrimSpace(key))
+			if err != nil {
+				if errors.Is(err, handlers.ErrInvalidAPIKey) {
+					return apperror.Unauthorized("Invalid API key")
+				}
+				return apperror.Internal("Failed to verify API key", err)
 			}
 
-			groups := claims["cognito:groups"]
 			// Set user in context for later use
-			if groups == nil {
-				// Set user in context for later use
-				cc.SetAuthUser(&models.AuthUser{
-					ID:     claims["sub"].(string),
-					Role:   models.UserRolePlayer,
-					Source: auth.UserSourceCognito,
-				})
-			} else {
-				cc.SetAuthUser(&models.AuthUser{
-					ID:     claims["sub"].(string),
-					Role:   groups.([]interface{})[0].(string),
-					Source: auth.UserSourceCognito,
-				})
+			cc := c.(*auth.Context)
+			cc.SetAuthUser(authUser)
+			return next(cc)
+		}
+	}
+}
+
+// Scope middleware limits API keys to the routes covered by their scopes, on routes not guarded by a permission.
+// Users signed in with a token are not affected.
+func Scope(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cc := c.(*auth.Context)
+			if !cc.AuthUser().HasScope(permission) {
+				return apperror.Forbidden(fmt.Sprintf("API key is missing the %s scope", permission))
 			}
+			return next(c)
 		}
-		return next(cc)
 	}
 }
 
+// NoAPIKey middleware rejects requests made with an API key, e.g. to keep keys from creating more keys
+func NoAPIKey(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*auth.Context)
+		if len(cc.AuthUser().APIKeyID) > 0 {
+			return apperror.Forbidden("Not allowed with an API key")
+		}
+		return next(c)
+	}
+}
+
+// NoImpersonation middleware forbids sensitive actions while an admin impersonates a user
+func NoImpersonation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*auth.Context)
+		if cc.AuthUser().IsImpersonated() {
+			return apperror.Forbidden("Not allowed while impersonating a user")
+		}
+		return next(c)
+	}
+}
+
+// Logger middleware logs requests along with the authenticated user and the admin impersonating them
+func Logger() echo.MiddlewareFunc {
+	config := echomiddleware.DefaultLoggerConfig
+	config.Format = strings.TrimSuffix(config.Format, "}\n") + "${custom}}\n"
+	config.CustomTagFunc = func(c echo.Context, buf *bytes.Buffer) (int, error) {
+		authUser, ok := c.Get(auth.AuthUserKey).(*models.AuthUser)
+		if !ok || authUser == nil {
+			return 0, nil
+		}
+
+		fields := map[string]string{"user_id": authUser.ID}
+		if authUser.IsImpersonated() {
+			fields["impersonated_by"] = authUser.ActorID
+		}
+		if len(authUser.APIKeyID) > 0 {
+			fields["api_key_id"] = authUser.APIKeyID
+		}
+
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return 0, err
+		}
+		// Append the fields to the JSON object of the log line
+		b[0] = ','
+		return buf.Write(b[:len(b)-1])
+	}
+	return echomiddleware.LoggerWithConfig(config)
+}
+
 // CORS middleware to allow cross-origin requests
 func CORS() echo.MiddlewareFunc {
 	return echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
-		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "CognitoAuthorization"},
+		AllowMethods:  []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization", "CognitoAuthorization", "X-API-Key", etag.HeaderIfMatch, etag.HeaderIfNoneMatch},
+		ExposeHeaders: []string{HeaderImpersonatedBy, echo.HeaderXRequestID, etag.HeaderETag},
 	})
 }
 
-// JWTConfig middleware to handle JWT token verification
-func JWTConfig(jwtSecret interface{}) echo.MiddlewareFunc {
-	return echojwt.WithConfig(echojwt.Config{
+// JWTConfig middleware to handle JWT token verification and reject revoked tokens
+func JWTConfig(jwtSecret interface{}, db *gorm.DB) echo.MiddlewareFunc {
+	verifyToken := echojwt.WithConfig(echojwt.Config{
 		SigningKey: jwtSecret, // Secret key to validate token
 		ContextKey: "user",    // Key to store the user in the context
 		NewClaimsFunc: func(c echo.Context) jwt.Claims {
@@ -120,11 +220,53 @@ func JWTConfig(jwtSecret interface{}) echo.MiddlewareFunc {
 
 			cc := c.(*auth.Context)
 			// Set user in context for later use
-			cc.SetAuthUser(&models.AuthUser{
-				ID:     payload.Subject,
-				Role:   payload.Role,
-				Source: payload.Source,
-			})
+			authUser := &models.AuthUser{
+				ID:      payload.Subject,
+				Role:    payload.Role,
+				Source:  payload.Source,
+				TokenID: payload.ID,
+
+				PermissionVersion: payload.PermissionVersion,
+			}
+			if payload.Act != nil {
+				authUser.ActorID = payload.Act.Subject
+			}
+			cc.SetAuthUser(authUser)
 		},
 	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return verifyToken(func(c echo.Context) error {
+			cc := c.(*auth.Context)
+			authUser := cc.AuthUser()
+			if authUser == nil || len(authUser.TokenID) == 0 {
+				return apperror.Unauthorized("Invalid token")
+			}
+
+			// Check the token has not been revoked by logging out
+			revoked, err := handlers.IsTokenRevoked(db, authUser.TokenID)
+			if err != nil {
+				return apperror.Internal("Failed to verify token", err)
+			}
+			if revoked {
+				return apperror.New(http.StatusUnauthorized, apperror.CodeTokenRevoked, "Token has been revoked")
+			}
+
+			// Tokens issued before the roles of the user changed carry outdated roles, the client has to refresh them
+			grants, err := handlers.RequestGrants(c, db)
+			if err != nil {
+				return apperror.Internal("Failed to verify token", err)
+			}
+			if authUser.PermissionVersion < grants.Version {
+				return apperror.New(http.StatusUnauthorized, apperror.CodeTokenOutdated, "Token permissions are outdated")
+			}
+
+			// Mark every response made while an admin impersonates the user
+			if authUser.IsImpersonated() {
+				c.Response().Header().Set(HeaderImpersonatedBy, authUser.ActorID)
+			}
+
+			return next(c)
+		})
+	}
 }
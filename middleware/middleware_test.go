@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCognitoRejectsMalformedHeaders(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.Handler
+	e.Use(Context)
+
+	// The issuer is never reached for malformed headers
+	verifier := auth.NewCognitoVerifier("http://127.0.0.1:0", []string{"client"})
+	e.GET("/api/profile", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, Cognito(verifier, nil))
+
+	for _, header := range []string{"", "Bearer", "Bearer ", "Basic abc", "token-without-scheme"} {
+		t.Run(header, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+			if len(header) > 0 {
+				req.Header.Set("CognitoAuthorization", header)
+			}
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("expected 401, got %d", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// APIKey is a personal API key used by scripts and integrations to call the API as its user.
+// Only the hash of the key is stored, the key itself is shown once to its user when issued.
+type APIKey struct {
+	BaseModel
+	UserID     string     `gorm:"not null;index"`
+	User       *User      `gorm:"foreignKey:UserID"`
+	Name       string     `gorm:"not null"`
+	Prefix     string     `gorm:"type:varchar(20);not null"`          // Start of the key, to tell keys apart
+	KeyHash    *string    `gorm:"uniqueIndex"`                        // Nil until the user issues a key an admin created for them
+	Scopes     []string   `gorm:"type:text;serializer:json;not null"` // Permissions the key is limited to
+	ExpiresAt  *time.Time // Keys without expiry stay valid until revoked
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedBy  string `gorm:"not null"`
+}
+
+// IsActive checks if the API key can still be used
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// IsPending checks if the key was created by an admin and not yet issued by its user
+func (k *APIKey) IsPending() bool {
+	return k.KeyHash == nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditLog records a change made through the API. Entries are never updated or deleted.
+type AuditLog struct {
+	ID             string                 `gorm:"primaryKey"`
+	CreatedAt      time.Time              `gorm:"index"`
+	ActorID        string                 `gorm:"not null;index"`
+	ImpersonatedBy string                 // Admin impersonating the actor
+	APIKeyID       string                 // API key the actor used
+	Action         string                 `gorm:"not null;index"`
+	ResourceType   string                 `gorm:"index:idx_audit_logs_resource"`
+	ResourceID     string                 `gorm:"index:idx_audit_logs_resource"`
+	Changes        map[string]AuditChange `gorm:"type:jsonb;serializer:json"` // Changed fields, empty when unknown
+	Method         string
+	Path           string
+	Status         int
+	RequestID      string
+	IPAddress      string
+	UserAgent      string
+}
+
+// AuditChange is the value of a field before and after a change, either is empty when the resource was created or deleted
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (l *AuditLog) BeforeCreate(tx *gorm.DB) (err error) {
+	if len(l.ID) == 0 {
+		l.ID = uuid.New().String()
+	}
+	return
+}
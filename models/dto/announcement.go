@@ -0,0 +1,68 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
+)
+
+type AnnouncementRequest struct {
+	Title    string   `json:"title"`
+	Content  string   `json:"content"`
+	Mentions []string `json:"mentions"`
+}
+
+func (r *AnnouncementRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("title", r.Title, "Title and content are required")
+	errs.Required("content", r.Content, "Title and content are required")
+	errs.MaxLength("title", r.Title, 200, "Title is too long")
+	errs.MaxLength("content", r.Content, 5000, "Content is too long")
+	errs.UUIDs("mentions", r.Mentions, "Mentioned users must be members of the group")
+	return errs.Err()
+}
+
+type AnnouncementResponse struct {
+	ID         string          `json:"id"`
+	GroupID    string          `json:"group_id"`
+	AuthorID   string          `json:"author_id"`
+	AuthorName string          `json:"author_name"`
+	Title      string          `json:"title"`
+	Content    string          `json:"content"`
+	Mentions   []*UserResponse `json:"mentions"`
+	Edited     bool            `json:"edited"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+func ToAnnouncementResponse(announcement *models.GroupAnnouncement) *AnnouncementResponse {
+	resp := &AnnouncementResponse{
+		ID:         announcement.ID,
+		GroupID:    announcement.GroupID,
+		AuthorID:   announcement.AuthorID,
+		AuthorName: "N/A",
+		Title:      announcement.Title,
+		Content:    announcement.Content,
+		Mentions:   toMentionResponses(announcement.Mentions),
+		Edited:     announcement.UpdatedAt.After(announcement.CreatedAt),
+		CreatedAt:  announcement.CreatedAt,
+		UpdatedAt:  announcement.UpdatedAt,
+	}
+	if announcement.Author != nil {
+		resp.AuthorName = announcement.Author.Name
+	}
+	return resp
+}
+
+func toMentionResponses(users []*models.User) []*UserResponse {
+	mentions := make([]*UserResponse, 0, len(users))
+	for _, usr := range users {
+		mentions = append(mentions, &UserResponse{
+			ID:        usr.ID,
+			Name:      usr.Name,
+			AvatarURL: usr.AvatarURL,
+		})
+	}
+	return mentions
+}
@@ -0,0 +1,63 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/rbac"
+	"github.com/alanrb/badminton/backend/validate"
+)
+
+type NewAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r *NewAPIKeyRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("name", r.Name, "Name is required")
+	errs.MaxLength("name", r.Name, 100, "Name is too long")
+	errs.Check(len(r.Scopes) > 0, "scopes", "At least one scope is required")
+	for _, scope := range r.Scopes {
+		errs.Check(rbac.ValidPermission(scope), "scopes", "Invalid scope: "+scope)
+	}
+	errs.Within("expires_at", r.ExpiresAt, 0, "Expiry must be in the future")
+	return errs.Err()
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Pending    bool       `json:"pending"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKeyResponse carries the key itself, which is only returned once
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+func ToAPIKeyResponse(key *models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		UserID:     key.UserID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		Pending:    key.IsPending(),
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+	}
+}
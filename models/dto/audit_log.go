@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+)
+
+type AuditLogResponse struct {
+	ID             string                        `json:"id"`
+	ActorID        string                        `json:"actor_id"`
+	ImpersonatedBy string                        `json:"impersonated_by,omitempty"`
+	APIKeyID       string                        `json:"api_key_id,omitempty"`
+	Action         string                        `json:"action"`
+	ResourceType   string                        `json:"resource_type"`
+	ResourceID     string                        `json:"resource_id"`
+	Changes        map[string]models.AuditChange `json:"changes"`
+	Method         string                        `json:"method"`
+	Path           string                        `json:"path"`
+	Status         int                           `json:"status"`
+	RequestID      string                        `json:"request_id"`
+	IPAddress      string                        `json:"ip_address"`
+	UserAgent      string                        `json:"user_agent"`
+	CreatedAt      time.Time                     `json:"created_at"`
+}
+
+func ToAuditLogResponse(log *models.AuditLog) AuditLogResponse {
+	changes := log.Changes
+	if changes == nil {
+		changes = map[string]models.AuditChange{}
+	}
+
+	return AuditLogResponse{
+		ID:             log.ID,
+		ActorID:        log.ActorID,
+		ImpersonatedBy: log.ImpersonatedBy,
+		APIKeyID:       log.APIKeyID,
+		Action:         log.Action,
+		ResourceType:   log.ResourceType,
+		ResourceID:     log.ResourceID,
+		Changes:        changes,
+		Method:         log.Method,
+		Path:           log.Path,
+		Status:         log.Status,
+		RequestID:      log.RequestID,
+		IPAddress:      log.IPAddress,
+		UserAgent:      log.UserAgent,
+		CreatedAt:      log.CreatedAt,
+	}
+}
@@ -2,9 +2,40 @@ package dto
 
 import (
 	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
 	"github.com/shopspring/decimal"
 )
 
+// BadmintonCourtRequest represents the request body for creating or updating a court
+type BadmintonCourtRequest struct {
+	Name                 string          `json:"name"`
+	Address              string          `json:"address"`
+	GoogleMapURL         string          `json:"google_map_url"`
+	EstimatePricePerHour decimal.Decimal `json:"estimate_price_per_hour"`
+	Contact              string          `json:"contact"`
+}
+
+func (r *BadmintonCourtRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("name", r.Name, "Invalid name")
+	errs.MaxLength("name", r.Name, 200, "Invalid name")
+	errs.MaxLength("address", r.Address, 500, "Invalid address")
+	errs.URL("google_map_url", r.GoogleMapURL, "Invalid Google Map URL")
+	errs.NotNegative("estimate_price_per_hour", r.EstimatePricePerHour, "Invalid price")
+	errs.MaxLength("contact", r.Contact, 200, "Invalid contact")
+	return errs.Err()
+}
+
+func ToBadmintonCourtRequest(court *models.BadmintonCourt) BadmintonCourtRequest {
+	return BadmintonCourtRequest{
+		Name:                 court.Name,
+		Address:              court.Address,
+		GoogleMapURL:         court.GoogleMapURL,
+		EstimatePricePerHour: court.EstimatePricePerHour,
+		Contact:              court.Contact,
+	}
+}
+
 type BadmintonCourtResponse struct {
 	ID                   string          `json:"id"`
 	Name                 string          `json:"name"`
@@ -0,0 +1,53 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
+)
+
+type CommentRequest struct {
+	Content  string   `json:"content"`
+	Mentions []string `json:"mentions"`
+}
+
+func (r *CommentRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("content", r.Content, "Content is required")
+	errs.MaxLength("content", r.Content, 2000, "Content is too long")
+	errs.UUIDs("mentions", r.Mentions, "Mentioned users must be members of the session")
+	return errs.Err()
+}
+
+type CommentResponse struct {
+	ID              string          `json:"id"`
+	SessionID       string          `json:"session_id"`
+	AuthorID        string          `json:"author_id"`
+	AuthorName      string          `json:"author_name"`
+	AuthorAvatarURL string          `json:"author_avatar_url"`
+	Content         string          `json:"content"`
+	Mentions        []*UserResponse `json:"mentions"`
+	Edited          bool            `json:"edited"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+func ToCommentResponse(comment *models.SessionComment) *CommentResponse {
+	resp := &CommentResponse{
+		ID:         comment.ID,
+		SessionID:  comment.SessionID,
+		AuthorID:   comment.AuthorID,
+		AuthorName: "N/A",
+		Content:    comment.Content,
+		Mentions:   toMentionResponses(comment.Mentions),
+		Edited:     comment.UpdatedAt.After(comment.CreatedAt),
+		CreatedAt:  comment.CreatedAt,
+		UpdatedAt:  comment.UpdatedAt,
+	}
+	if comment.Author != nil {
+		resp.AuthorName = comment.Author.Name
+		resp.AuthorAvatarURL = comment.Author.AvatarURL
+	}
+	return resp
+}
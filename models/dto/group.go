@@ -1,41 +1,197 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
 )
 
 type NewGroupRequest struct {
-	Name     string  `json:"name"`
-	ImageUrl *string `json:"image_url"`
-	Remark   *string `json:"remark"`
+	Name       string  `json:"name"`
+	ImageUrl   *string `json:"image_url"`
+	Remark     *string `json:"remark"`
+	Visibility string  `json:"visibility"`
+}
+
+func (r *NewGroupRequest) Validate() error {
+	return validateGroup(r.Name, r.ImageUrl, r.Remark, r.Visibility)
 }
 
 type GroupResponse struct {
-	ID       string             `json:"id"`
-	Name     string             `json:"name"`
-	OwnerID  string             `json:"owner_id"`
-	ImageUrl *string            `json:"image_url"`
-	Remark   *string            `json:"remark"`
-	Members  []*UserResponse    `json:"members"`
-	Sessions []*SessionResponse `json:"sessions"`
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	OwnerID    string                 `json:"owner_id"`
+	ImageUrl   *string                `json:"image_url"`
+	Remark     *string                `json:"remark"`
+	Visibility string                 `json:"visibility"`
+	Members    []*GroupMemberResponse `json:"members"`
+	Sessions   []*SessionResponse     `json:"sessions"`
+}
+
+type GroupMemberResponse struct {
+	UserResponse
+	GroupRole string `json:"group_role"`
+}
+
+type UpdateGroupRequest struct {
+	Name       string  `json:"name"`
+	ImageUrl   *string `json:"image_url"`
+	Remark     *string `json:"remark"`
+	Visibility string  `json:"visibility"`
+}
+
+func (r *UpdateGroupRequest) Validate() error {
+	return validateGroup(r.Name, r.ImageUrl, r.Remark, r.Visibility)
+}
+
+func ToUpdateGroupRequest(group *models.Group) UpdateGroupRequest {
+	return UpdateGroupRequest{
+		Name:       group.Name,
+		ImageUrl:   group.ImageUrl,
+		Remark:     group.Remark,
+		Visibility: group.Visibility,
+	}
+}
+
+// validateGroup checks the fields of a group, an empty visibility keeps the current or default one
+func validateGroup(name string, imageURL *string, remark *string, visibility string) error {
+	var errs validate.Errors
+	errs.Required("name", name, "Invalid name")
+	errs.MaxLength("name", name, 100, "Invalid name")
+	if imageURL != nil {
+		errs.URL("image_url", *imageURL, "Invalid image URL")
+	}
+	if remark != nil {
+		errs.MaxLength("remark", *remark, 1000, "Remark is too long")
+	}
+	errs.Check(len(visibility) == 0 || models.ValidGroupVisibility(visibility), "visibility", "Invalid visibility")
+	return errs.Err()
+}
+
+// AddGroupPlayerRequest represents the request body for adding a player to a group by email
+type AddGroupPlayerRequest struct {
+	UserEmail string `json:"user_email"`
+}
+
+func (r *AddGroupPlayerRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("user_email", r.UserEmail, "Email is invalid")
+	errs.Email("user_email", r.UserEmail, "Email is invalid")
+	return errs.Err()
+}
+
+// UpdateGroupMemberRoleRequest represents the request body for changing a member's role in a group
+type UpdateGroupMemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Validate only accepts the roles below the owner, ownership changes hands through a transfer
+func (r *UpdateGroupMemberRoleRequest) Validate() error {
+	var errs validate.Errors
+	errs.OneOf("role", r.Role, []string{models.GroupRoleCoOrganizer, models.GroupRoleMember}, "Invalid group role")
+	return errs.Err()
+}
+
+// TransferGroupOwnershipRequest represents the request body for handing a group over to another member
+type TransferGroupOwnershipRequest struct {
+	UserID string `json:"user_id"`
+}
+
+func (r *TransferGroupOwnershipRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("user_id", r.UserID, "Invalid user ID")
+	errs.UUID("user_id", r.UserID, "Invalid user ID")
+	return errs.Err()
+}
+
+// GroupDirectoryResponse is the public view of a group listed in the directory
+type GroupDirectoryResponse struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	ImageUrl    *string `json:"image_url"`
+	Remark      *string `json:"remark"`
+	Visibility  string  `json:"visibility"`
+	MemberCount int64   `json:"member_count"`
+}
+
+// JoinGroupRequest represents the request body for joining a group
+type JoinGroupRequest struct {
+	Message string `json:"message"`
+}
+
+func (r *JoinGroupRequest) Validate() error {
+	var errs validate.Errors
+	errs.MaxLength("message", r.Message, 500, "Message is too long")
+	return errs.Err()
+}
+
+// ReviewJoinRequest represents the request body for approving or rejecting a join request
+type ReviewJoinRequest struct {
+	Status string `json:"status"`
+}
+
+func (r *ReviewJoinRequest) Validate() error {
+	var errs validate.Errors
+	errs.OneOf("status", r.Status, []string{string(models.ApprovalStatusApproved), string(models.ApprovalStatusRejected)}, "Invalid status")
+	return errs.Err()
+}
+
+type GroupJoinRequestResponse struct {
+	ID        string    `json:"id"`
+	GroupID   string    `json:"group_id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	AvatarURL string    `json:"avatar_url"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 func ToGroupResponse(group *models.Group) *GroupResponse {
 	resp := &GroupResponse{
-		ID:       group.ID,
-		Name:     group.Name,
-		OwnerID:  group.OwnerID,
-		ImageUrl: group.ImageUrl,
-		Remark:   group.Remark,
+		ID:         group.ID,
+		Name:       group.Name,
+		OwnerID:    group.OwnerID,
+		ImageUrl:   group.ImageUrl,
+		Remark:     group.Remark,
+		Visibility: group.Visibility,
+	}
+
+	// Group roles are only known when memberships are loaded
+	groupRoles := make(map[string]string, len(group.Memberships))
+	for _, membership := range group.Memberships {
+		groupRoles[membership.UserID] = membership.Role
 	}
 
 	for _, usr := range group.Members {
-		resp.Members = append(resp.Members, &UserResponse{
-			ID:        usr.ID,
-			Name:      usr.Name,
-			AvatarURL: usr.AvatarURL,
+		resp.Members = append(resp.Members, &GroupMemberResponse{
+			UserResponse: UserResponse{
+				ID:        usr.ID,
+				Name:      usr.Name,
+				AvatarURL: usr.AvatarURL,
+			},
+			GroupRole: groupRoles[usr.ID],
 		})
 	}
 
 	return resp
 }
+
+func ToGroupJoinRequestResponse(request *models.GroupJoinRequest) *GroupJoinRequestResponse {
+	resp := &GroupJoinRequestResponse{
+		ID:        request.ID,
+		GroupID:   request.GroupID,
+		UserID:    request.UserID,
+		Status:    string(request.Status),
+		Message:   request.Message,
+		CreatedAt: request.CreatedAt,
+	}
+	if request.User != nil {
+		resp.Name = request.User.Name
+		resp.AvatarURL = request.User.AvatarURL
+	} else {
+		resp.Name = "N/A"
+	}
+	return resp
+}
@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
+)
+
+type ImpersonationRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (r *ImpersonationRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("reason", r.Reason, "Reason is required")
+	errs.MaxLength("reason", r.Reason, 500, "Reason is too long")
+	return errs.Err()
+}
+
+type ImpersonationResponse struct {
+	ID        string     `json:"id"`
+	AdminID   string     `json:"admin_id"`
+	AdminName string     `json:"admin_name,omitempty"`
+	UserID    string     `json:"user_id"`
+	UserName  string     `json:"user_name,omitempty"`
+	Reason    string     `json:"reason"`
+	IPAddress string     `json:"ip_address"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ImpersonationTokenResponse carries the access token acting as the impersonated user. It cannot be refreshed.
+type ImpersonationTokenResponse struct {
+	AccessToken   string                `json:"access_token"`
+	TokenType     string                `json:"token_type"`
+	ExpiresIn     int                   `json:"expires_in"`
+	Impersonation ImpersonationResponse `json:"impersonation"`
+}
+
+func ToImpersonationResponse(impersonation *models.ImpersonationSession) ImpersonationResponse {
+	response := ImpersonationResponse{
+		ID:        impersonation.ID,
+		AdminID:   impersonation.AdminID,
+		UserID:    impersonation.UserID,
+		Reason:    impersonation.Reason,
+		IPAddress: impersonation.IPAddress,
+		ExpiresAt: impersonation.ExpiresAt,
+		EndedAt:   impersonation.EndedAt,
+		CreatedAt: impersonation.CreatedAt,
+	}
+	if impersonation.Admin != nil {
+		response.AdminName = impersonation.Admin.Name
+	}
+	if impersonation.User != nil {
+		response.UserName = impersonation.User.Name
+	}
+	return response
+}
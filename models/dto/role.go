@@ -0,0 +1,89 @@
+package dto
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
+)
+
+// roleNamePattern is what role names look like, they are referred to in code and tokens
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// MaxRolePriority is the highest priority a role can be given
+const MaxRolePriority = 1000
+
+type NewRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Priority    int      `json:"priority"`
+	Permissions []string `json:"permissions"`
+}
+
+func (r *NewRoleRequest) Validate() error {
+	var errs validate.Errors
+	errs.Check(roleNamePattern.MatchString(strings.TrimSpace(r.Name)), "name", "Role name must be 2-50 lowercase letters, digits or underscores")
+	errs.MaxLength("description", r.Description, 500, "Description is too long")
+	errs.Range("priority", r.Priority, 0, MaxRolePriority, "Invalid priority")
+	return errs.Err()
+}
+
+type UpdateRoleRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Priority    *int    `json:"priority"`
+}
+
+func (r *UpdateRoleRequest) Validate() error {
+	var errs validate.Errors
+	if r.Name != nil {
+		errs.Check(roleNamePattern.MatchString(strings.TrimSpace(*r.Name)), "name", "Role name must be 2-50 lowercase letters, digits or underscores")
+	}
+	if r.Description != nil {
+		errs.MaxLength("description", *r.Description, 500, "Description is too long")
+	}
+	if r.Priority != nil {
+		errs.Range("priority", *r.Priority, 0, MaxRolePriority, "Invalid priority")
+	}
+	return errs.Err()
+}
+
+type RoleResponse struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Protected   bool     `json:"protected"`
+	Priority    int      `json:"priority"`
+	Permissions []string `json:"permissions"`
+	UserCount   int64    `json:"user_count"`
+}
+
+type PermissionResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func ToRoleResponse(role *models.Role, userCount int64) RoleResponse {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		permissions = append(permissions, permission.Name)
+	}
+
+	return RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Protected:   role.Protected,
+		Priority:    role.Priority,
+		Permissions: permissions,
+		UserCount:   userCount,
+	}
+}
+
+func ToPermissionResponse(permission *models.Permission) PermissionResponse {
+	return PermissionResponse{
+		ID:   permission.ID,
+		Name: permission.Name,
+	}
+}
@@ -4,21 +4,135 @@ import (
 	"time"
 
 	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
+	"github.com/shopspring/decimal"
 )
 
+// MaxSessionMembers is the most members a session can have
+const MaxSessionMembers = 100
+
+// sessionWindow is how far ahead sessions can be scheduled
+const sessionWindow = 365 * 24 * time.Hour
+
 type NewSessionRequest struct {
-	BadmintonCourtID string     `json:"badminton_court_id"`
-	Description      string     `json:"description"`
-	MaxMembers       int        `json:"max_members"`
-	GroupID          string     `json:"group_id"`
-	DateTime         *time.Time `json:"date_time"`
+	BadmintonCourtID string          `json:"badminton_court_id"`
+	Description      string          `json:"description"`
+	MaxMembers       int             `json:"max_members"`
+	GroupID          string          `json:"group_id"`
+	DateTime         *time.Time      `json:"date_time"`
+	Cost             decimal.Decimal `json:"cost"`
+	CostSplit        string          `json:"cost_split"`
 }
 
+func (r *NewSessionRequest) Validate() error {
+	var errs validate.Errors
+	errs.UUID("badminton_court_id", r.BadmintonCourtID, "Invalid BadmintonCourtID")
+	errs.UUID("group_id", r.GroupID, "Invalid group ID")
+	errs.MaxLength("description", r.Description, 2000, "Description is too long")
+	errs.Range("max_members", r.MaxMembers, 1, MaxSessionMembers, "Invalid max members")
+	errs.Check(r.DateTime != nil, "date_time", "Invalid DateTime")
+	errs.Within("date_time", r.DateTime, sessionWindow, "Invalid DateTime")
+	errs.NotNegative("cost", r.Cost, "Invalid cost")
+	errs.Check(len(r.CostSplit) == 0 || models.ValidSessionCostSplit(r.CostSplit), "cost_split", "Invalid cost split")
+	return errs.Err()
+}
+
+// UpdateSessionRequest changes the fields of a session that are set, an empty court ID removes the court
 type UpdateSessionRequest struct {
-	BadmintonCourtID string     `json:"badminton_court_id"`
-	Description      string     `json:"description"`
-	MaxMembers       int        `json:"max_members"`
-	DateTime         *time.Time `json:"date_time"`
+	BadmintonCourtID *string          `json:"badminton_court_id"`
+	Description      *string          `json:"description"`
+	MaxMembers       *int             `json:"max_members"`
+	DateTime         *time.Time       `json:"date_time"`
+	Cost             *decimal.Decimal `json:"cost"`
+	CostSplit        string           `json:"cost_split"`
+}
+
+func (r *UpdateSessionRequest) Validate() error {
+	var errs validate.Errors
+	if r.BadmintonCourtID != nil {
+		errs.UUID("badminton_court_id", *r.BadmintonCourtID, "Invalid BadmintonCourtID")
+	}
+	if r.Description != nil {
+		errs.MaxLength("description", *r.Description, 2000, "Description is too long")
+	}
+	if r.MaxMembers != nil {
+		errs.Range("max_members", *r.MaxMembers, 1, MaxSessionMembers, "Invalid max members")
+	}
+	errs.Within("date_time", r.DateTime, sessionWindow, "Invalid DateTime")
+	if r.Cost != nil {
+		errs.NotNegative("cost", *r.Cost, "Invalid cost")
+	}
+	errs.Check(len(r.CostSplit) == 0 || models.ValidSessionCostSplit(r.CostSplit), "cost_split", "Invalid cost split")
+	return errs.Err()
+}
+
+// PatchSessionRequest is a session as JSON Merge Patches apply to it, the patched session replaces the session
+type PatchSessionRequest struct {
+	BadmintonCourtID string          `json:"badminton_court_id"`
+	Description      string          `json:"description"`
+	MaxMembers       int             `json:"max_members"`
+	DateTime         *time.Time      `json:"date_time"`
+	Cost             decimal.Decimal `json:"cost"`
+	CostSplit        string          `json:"cost_split"`
+
+	scheduled *time.Time // When the session takes place before the patch
+}
+
+// NewPatchSessionRequest is the request a patch of a session decodes into. Sessions that took place keep their date
+// time, it only has to be upcoming when the patch changes it.
+func NewPatchSessionRequest(session *models.Session) PatchSessionRequest {
+	return PatchSessionRequest{scheduled: session.DateTime}
+}
+
+func ToPatchSessionRequest(session *models.Session) PatchSessionRequest {
+	request := PatchSessionRequest{
+		Description: session.Description,
+		MaxMembers:  session.MaxMembers,
+		DateTime:    session.DateTime,
+		Cost:        session.Cost,
+		CostSplit:   session.CostSplit,
+	}
+	if session.BadmintonCourtID != nil {
+		request.BadmintonCourtID = *session.BadmintonCourtID
+	}
+	return request
+}
+
+func (r *PatchSessionRequest) Validate() error {
+	var errs validate.Errors
+	errs.UUID("badminton_court_id", r.BadmintonCourtID, "Invalid BadmintonCourtID")
+	errs.MaxLength("description", r.Description, 2000, "Description is too long")
+	errs.Range("max_members", r.MaxMembers, 1, MaxSessionMembers, "Invalid max members")
+	errs.Check(r.DateTime != nil, "date_time", "Invalid DateTime")
+	if r.DateTime == nil || r.scheduled == nil || !r.DateTime.Equal(*r.scheduled) {
+		errs.Within("date_time", r.DateTime, sessionWindow, "Invalid DateTime")
+	}
+	errs.NotNegative("cost", r.Cost, "Invalid cost")
+	errs.Check(len(r.CostSplit) == 0 || models.ValidSessionCostSplit(r.CostSplit), "cost_split", "Invalid cost split")
+	return errs.Err()
+}
+
+// UpdateRequest sets every field of the session to the patched ones
+func (r *PatchSessionRequest) UpdateRequest() UpdateSessionRequest {
+	return UpdateSessionRequest{
+		BadmintonCourtID: &r.BadmintonCourtID,
+		Description:      &r.Description,
+		MaxMembers:       &r.MaxMembers,
+		DateTime:         r.DateTime,
+		Cost:             &r.Cost,
+		CostSplit:        r.CostSplit,
+	}
+}
+
+// UpdateSessionStatusRequest represents the request body for moving a session to another status
+type UpdateSessionStatusRequest struct {
+	Status string `json:"status"`
+}
+
+func (r *UpdateSessionStatusRequest) Validate() error {
+	var errs validate.Errors
+	errs.Check(models.ValidSessionStatus(r.Status), "status", "Invalid session status")
+	return errs.Err()
 }
 
 // AttendSessionRequest represents the request body for attending a session
@@ -26,6 +140,27 @@ type AttendSessionRequest struct {
 	Slot int `json:"slot"`
 }
 
+func (r *AttendSessionRequest) Validate() error {
+	var errs validate.Errors
+	errs.Range("slot", r.Slot, 1, MaxSessionMembers, "Invalid Slot")
+	return errs.Err()
+}
+
+// UpdateAttendeeStatusRequest represents the request body for approving or rejecting an attendee
+type UpdateAttendeeStatusRequest struct {
+	Status string  `json:"status"`
+	Remark *string `json:"remark"`
+}
+
+func (r *UpdateAttendeeStatusRequest) Validate() error {
+	var errs validate.Errors
+	errs.OneOf("status", r.Status, []string{string(models.ApprovalStatusApproved), string(models.ApprovalStatusRejected)}, "Invalid status")
+	if r.Remark != nil {
+		errs.MaxLength("remark", *r.Remark, 500, "Remark is too long")
+	}
+	return errs.Err()
+}
+
 type SessionResponse struct {
 	CreatedAt        time.Time                  `json:"created_at"`
 	ID               string                     `json:"id"`
@@ -39,6 +174,8 @@ type SessionResponse struct {
 	Status           string                     `json:"status"`
 	BadmintonCourtID string                     `json:"badminton_court_id"`
 	GroupName        string                     `json:"group_name"`
+	Cost             decimal.Decimal            `json:"cost"`
+	CostSplit        string                     `json:"cost_split"`
 	Attendees        []*SessionAttendeeResponse `json:"attendees"`
 }
 
@@ -53,15 +190,19 @@ type SessionAttendeeResponse struct {
 
 func ToSessionResponse(session *models.Session) SessionResponse {
 	resp := SessionResponse{
-		CreatedAt:        session.CreatedAt,
-		ID:               session.ID,
-		Description:      session.Description,
-		MaxMembers:       session.MaxMembers,
-		DateTime:         session.DateTime,
-		CreatedBy:        session.CreatedBy,
-		CreatedByName:    session.CreatedByName,
-		Status:           session.Status,
-		BadmintonCourtID: *session.BadmintonCourtID,
+		CreatedAt:     session.CreatedAt,
+		ID:            session.ID,
+		Description:   session.Description,
+		MaxMembers:    session.MaxMembers,
+		DateTime:      session.DateTime,
+		CreatedBy:     session.CreatedBy,
+		CreatedByName: session.CreatedByName,
+		Status:        session.Status,
+		Cost:          session.Cost,
+		CostSplit:     session.CostSplit,
+	}
+	if session.BadmintonCourtID != nil {
+		resp.BadmintonCourtID = *session.BadmintonCourtID
 	}
 	if session.BadmintonCourt != nil {
 		resp.Location = session.BadmintonCourt.Name
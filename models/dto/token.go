@@ -0,0 +1,31 @@
+package dto
+
+import "github.com/alanrb/badminton/backend/validate"
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (r *RefreshTokenRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("refresh_token", r.RefreshToken, "Invalid request")
+	return errs.Err()
+}
+
+// LoginCodeRequest carries the code a login redirected the frontend with
+type LoginCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (r *LoginCodeRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("code", r.Code, "Invalid request")
+	return errs.Err()
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Lifetime of the access token in seconds
+}
@@ -1,6 +1,58 @@
 package dto
 
-import "github.com/alanrb/badminton/backend/models"
+import (
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
+)
+
+// NewUserRequest represents the request body for creating a user, who is linked to their account on first login
+type NewUserRequest struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+func (r *NewUserRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("name", r.Name, "Name is required")
+	errs.MaxLength("name", r.Name, 100, "Name is too long")
+	errs.Required("email", r.Email, "Email is invalid")
+	errs.Email("email", r.Email, "Email is invalid")
+	errs.URL("avatar_url", r.AvatarURL, "Invalid avatar URL")
+	return errs.Err()
+}
+
+// UpdateUserRequest changes the avatar of a user, and their roles when set
+type UpdateUserRequest struct {
+	AvatarURL string   `json:"avatar_url"`
+	Roles     []string `json:"roles"`
+}
+
+func (r *UpdateUserRequest) Validate() error {
+	var errs validate.Errors
+	errs.URL("avatar_url", r.AvatarURL, "Invalid avatar URL")
+	for _, role := range r.Roles {
+		errs.Required("roles", role, "Invalid role: "+role)
+	}
+	return errs.Err()
+}
+
+// CognitoUserRequest is the profile of a user signed in with Cognito, whose ID is their Cognito subject
+type CognitoUserRequest struct {
+	ID      string `json:"id"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
+
+func (r *CognitoUserRequest) Validate() error {
+	var errs validate.Errors
+	errs.Required("id", r.ID, "Failed to fetch user.")
+	errs.Email("email", r.Email, "Email is invalid")
+	errs.MaxLength("name", r.Name, 100, "Name is too long")
+	errs.URL("picture", r.Picture, "Invalid picture URL")
+	return errs.Err()
+}
 
 type UserResponse struct {
 	ID        string `json:"id"`
@@ -9,11 +61,12 @@ type UserResponse struct {
 	AvatarURL string `json:"avatar_url"`
 }
 
+// ToUserResponse converts a user, its role is only set when the roles of the user are loaded
 func ToUserResponse(user *models.User) UserResponse {
 	return UserResponse{
 		ID:        user.ID,
 		Name:      user.Name,
-		Role:      user.Role,
+		Role:      user.PrimaryRole(),
 		AvatarURL: user.AvatarURL,
 	}
 }
@@ -0,0 +1,125 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/validate"
+	"github.com/shopspring/decimal"
+)
+
+// WalletTopUpRequest records money received from a member
+type WalletTopUpRequest struct {
+	UserID string          `json:"user_id"`
+	Amount decimal.Decimal `json:"amount"`
+	Type   string          `json:"type"` // A top-up unless set
+	Note   string          `json:"note"`
+}
+
+func (r *WalletTopUpRequest) Validate() error {
+	var errs validate.Errors
+	errs.Check(len(r.Type) == 0 || r.Type == models.WalletTransactionTopUp || r.Type == models.WalletTransactionMembershipFee, "type", "Invalid top-up type")
+	errs.Positive("amount", r.Amount, "Invalid amount")
+	errs.Required("user_id", r.UserID, "Invalid user ID")
+	errs.UUID("user_id", r.UserID, "Invalid user ID")
+	errs.MaxLength("note", r.Note, 500, "Note is too long")
+	return errs.Err()
+}
+
+type UpdateWalletRequest struct {
+	LowBalanceThreshold       *decimal.Decimal `json:"low_balance_threshold"`
+	MemberLowBalanceThreshold *decimal.Decimal `json:"member_low_balance_threshold"`
+}
+
+func (r *UpdateWalletRequest) Validate() error {
+	var errs validate.Errors
+	if r.LowBalanceThreshold != nil {
+		errs.NotNegative("low_balance_threshold", *r.LowBalanceThreshold, "Invalid threshold")
+	}
+	if r.MemberLowBalanceThreshold != nil {
+		errs.NotNegative("member_low_balance_threshold", *r.MemberLowBalanceThreshold, "Invalid threshold")
+	}
+	return errs.Err()
+}
+
+type WalletResponse struct {
+	GroupID                   string                   `json:"group_id"`
+	Balance                   decimal.Decimal          `json:"balance"`
+	LowBalanceThreshold       decimal.Decimal          `json:"low_balance_threshold"`
+	MemberLowBalanceThreshold decimal.Decimal          `json:"member_low_balance_threshold"`
+	IsLow                     bool                     `json:"is_low"`
+	MyBalance                 decimal.Decimal          `json:"my_balance"`
+	Members                   []*MemberBalanceResponse `json:"members,omitempty"`
+}
+
+type MemberBalanceResponse struct {
+	UserID    string          `json:"user_id"`
+	Name      string          `json:"name"`
+	AvatarURL string          `json:"avatar_url"`
+	Balance   decimal.Decimal `json:"balance"`
+}
+
+// LowBalanceReportResponse lists what needs topping up in a group wallet
+type LowBalanceReportResponse struct {
+	GroupID             string                   `json:"group_id"`
+	Balance             decimal.Decimal          `json:"balance"`
+	LowBalanceThreshold decimal.Decimal          `json:"low_balance_threshold"`
+	IsLow               bool                     `json:"is_low"`
+	MembersBelow        []*MemberBalanceResponse `json:"members_below"`
+}
+
+type WalletTransactionResponse struct {
+	ID            string           `json:"id"`
+	UserID        *string          `json:"user_id"`
+	Name          string           `json:"name,omitempty"`
+	SessionID     *string          `json:"session_id"`
+	Type          string           `json:"type"`
+	Amount        decimal.Decimal  `json:"amount"`
+	PoolBalance   decimal.Decimal  `json:"pool_balance"`
+	MemberBalance *decimal.Decimal `json:"member_balance"`
+	Note          string           `json:"note"`
+	CreatedBy     string           `json:"created_by"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+func ToWalletResponse(wallet *models.GroupWallet) *WalletResponse {
+	return &WalletResponse{
+		GroupID:                   wallet.GroupID,
+		Balance:                   wallet.Balance,
+		LowBalanceThreshold:       wallet.LowBalanceThreshold,
+		MemberLowBalanceThreshold: wallet.MemberLowBalanceThreshold,
+		IsLow:                     wallet.IsLow(),
+	}
+}
+
+func ToMemberBalanceResponse(balance *models.GroupWalletBalance) *MemberBalanceResponse {
+	resp := &MemberBalanceResponse{
+		UserID:  balance.UserID,
+		Name:    "N/A",
+		Balance: balance.Balance,
+	}
+	if balance.User != nil {
+		resp.Name = balance.User.Name
+		resp.AvatarURL = balance.User.AvatarURL
+	}
+	return resp
+}
+
+func ToWalletTransactionResponse(transaction *models.WalletTransaction) *WalletTransactionResponse {
+	resp := &WalletTransactionResponse{
+		ID:            transaction.ID,
+		UserID:        transaction.UserID,
+		SessionID:     transaction.SessionID,
+		Type:          transaction.Type,
+		Amount:        transaction.Amount,
+		PoolBalance:   transaction.PoolBalance,
+		MemberBalance: transaction.MemberBalance,
+		Note:          transaction.Note,
+		CreatedBy:     transaction.CreatedBy,
+		CreatedAt:     transaction.CreatedAt,
+	}
+	if transaction.User != nil {
+		resp.Name = transaction.User.Name
+	}
+	return resp
+}
@@ -17,6 +17,26 @@ const (
 	ApprovalStatusPending  ApprovalStatus = "pending"
 	ApprovalStatusApproved ApprovalStatus = "approved"
 	ApprovalStatusRejected ApprovalStatus = "rejected"
+
+	// Group Visibility
+	GroupVisibilityPrivate      = "private"      // Only members can see the group
+	GroupVisibilityDiscoverable = "discoverable" // Listed in the directory, joining requires owner approval
+	GroupVisibilityOpen         = "open"         // Listed in the directory, anyone can join instantly
+
+	// Group Member Role
+	GroupRoleOwner       = "owner"
+	GroupRoleCoOrganizer = "co_organizer"
+	GroupRoleMember      = "member"
+
+	// Session Cost Split
+	SessionCostSplitPool      = "pool"      // The cost is taken from the group pool
+	SessionCostSplitAttendees = "attendees" // The cost is taken from the group pool and charged to attendees' credit
+
+	// Wallet Transaction Type
+	WalletTransactionTopUp         = "top_up"         // Member prepays credit into the wallet
+	WalletTransactionMembershipFee = "membership_fee" // Member pays a fee into the pool
+	WalletTransactionSessionDebit  = "session_debit"  // The pool pays for a completed session
+	WalletTransactionMemberCharge  = "member_charge"  // An attendee's share of a completed session
 )
 
 // ValidSessionStatus checks if the session status is valid
@@ -29,10 +49,35 @@ func ValidSessionStatus(status string) bool {
 	}
 }
 
-// ValidUserRole checks if the user role is valid
-func ValidUserRole(role string) bool {
+// ValidGroupVisibility checks if the group visibility is valid
+func ValidGroupVisibility(visibility string) bool {
+	switch visibility {
+	case GroupVisibilityPrivate, GroupVisibilityDiscoverable, GroupVisibilityOpen:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidGroupRole checks if the group member role is valid
+func ValidGroupRole(role string) bool {
 	switch role {
-	case UserRolePlayer, UserRoleAdmin, UserRoleGroupOwner:
+	case GroupRoleOwner, GroupRoleCoOrganizer, GroupRoleMember:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsGroupOrganizerRole checks if the group member role can organize the group
+func IsGroupOrganizerRole(role string) bool {
+	return role == GroupRoleOwner || role == GroupRoleCoOrganizer
+}
+
+// ValidSessionCostSplit checks if the session cost split is valid
+func ValidSessionCostSplit(split string) bool {
+	switch split {
+	case SessionCostSplitPool, SessionCostSplitAttendees:
 		return true
 	default:
 		return false
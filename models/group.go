@@ -2,17 +2,25 @@ package models
 
 type Group struct {
 	BaseModel
-	Name     string `gorm:"not null"`
-	OwnerID  string `gorm:"not null"`
-	ImageUrl *string
-	Remark   *string
-	Members  []*User    `gorm:"many2many:group_members;"`
-	Sessions []*Session `gorm:"many2many:group_sessions;"`
+	Name        string `gorm:"not null"`
+	OwnerID     string `gorm:"not null"`
+	ImageUrl    *string
+	Remark      *string
+	Visibility  string         `gorm:"type:varchar(20);default:'private'"`
+	Members     []*User        `gorm:"many2many:group_members;"`
+	Memberships []*GroupMember `gorm:"foreignKey:GroupID"`
+	Sessions    []*Session     `gorm:"many2many:group_sessions;"`
+}
+
+// IsListed checks if the group appears in the public group directory
+func (g *Group) IsListed() bool {
+	return g.Visibility == GroupVisibilityDiscoverable || g.Visibility == GroupVisibilityOpen
 }
 
 type GroupMember struct {
 	GroupID string `gorm:"primaryKey"`
 	UserID  string `gorm:"primaryKey"`
+	Role    string `gorm:"type:varchar(20);default:'member'"`
 }
 
 type GroupSession struct {
@@ -0,0 +1,11 @@
+package models
+
+type GroupAnnouncement struct {
+	BaseModel
+	GroupID  string  `gorm:"not null;index"`
+	AuthorID string  `gorm:"not null"`
+	Author   *User   `gorm:"foreignKey:AuthorID"`
+	Title    string  `gorm:"not null"`
+	Content  string  `gorm:"not null"`
+	Mentions []*User `gorm:"many2many:group_announcement_mentions;"`
+}
@@ -0,0 +1,10 @@
+package models
+
+type GroupJoinRequest struct {
+	BaseModel
+	GroupID string `gorm:"not null;index"`
+	UserID  string `gorm:"not null;index"`
+	User    *User
+	Status  ApprovalStatus `gorm:"type:varchar(20);default:'pending'"`
+	Message string
+}
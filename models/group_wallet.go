@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// GroupWallet holds the pooled money of a group
+type GroupWallet struct {
+	BaseModel
+	GroupID                   string          `gorm:"uniqueIndex;not null"`
+	Balance                   decimal.Decimal `gorm:"type:numeric(12,2);not null;default:0"`
+	LowBalanceThreshold       decimal.Decimal `gorm:"type:numeric(12,2);not null;default:0"`
+	MemberLowBalanceThreshold decimal.Decimal `gorm:"type:numeric(12,2);not null;default:0"`
+}
+
+// IsLow checks if the pool has fallen below its threshold
+func (w *GroupWallet) IsLow() bool {
+	return w.Balance.LessThan(w.LowBalanceThreshold)
+}
+
+// GroupWalletBalance is the prepaid credit of a member in a group wallet.
+// It is kept when the member leaves so outstanding balances can still be settled.
+type GroupWalletBalance struct {
+	GroupID   string `gorm:"primaryKey"`
+	UserID    string `gorm:"primaryKey"`
+	User      *User
+	Balance   decimal.Decimal `gorm:"type:numeric(12,2);not null;default:0"`
+	UpdatedAt time.Time
+}
+
+// WalletTransaction is an entry of the group wallet history
+type WalletTransaction struct {
+	BaseModel
+	GroupID       string           `gorm:"not null;index"`
+	UserID        *string          `gorm:"index"` // Member the transaction concerns, if any
+	User          *User            `gorm:"foreignKey:UserID"`
+	SessionID     *string          `gorm:"index"` // Session the transaction pays for, if any
+	Type          string           `gorm:"type:varchar(20);not null"`
+	Amount        decimal.Decimal  `gorm:"type:numeric(12,2);not null"` // Positive amounts are credits
+	PoolBalance   decimal.Decimal  `gorm:"type:numeric(12,2);not null"` // Pool balance after the transaction
+	MemberBalance *decimal.Decimal `gorm:"type:numeric(12,2)"`          // Member balance after the transaction, if a member was charged or credited
+	Note          string
+	CreatedBy     string `gorm:"not null"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ImpersonationSession records an admin acting as another user, for support
+type ImpersonationSession struct {
+	BaseModel
+	AdminID   string     `gorm:"not null;index"`
+	Admin     *User      `gorm:"foreignKey:AdminID"`
+	UserID    string     `gorm:"not null;index"`
+	User      *User      `gorm:"foreignKey:UserID"`
+	Reason    string     `gorm:"not null"`
+	TokenJTI  string     `gorm:"uniqueIndex;not null"` // jti of the impersonation token
+	ExpiresAt time.Time  `gorm:"not null"`
+	EndedAt   *time.Time // Set when the admin ends the impersonation before it expires
+	IPAddress string
+}
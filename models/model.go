@@ -12,6 +12,7 @@ type BaseModel struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt
+	Version   int64 `gorm:"not null;default:1"` // Incremented by every update, see ETags
 }
 
 // BeforeCreate hook to generate UUID if not set
@@ -19,5 +20,8 @@ func (u *BaseModel) BeforeCreate(tx *gorm.DB) (err error) {
 	if len(u.ID) == 0 {
 		u.ID = uuid.New().String()
 	}
+	if u.Version == 0 {
+		u.Version = 1
+	}
 	return
 }
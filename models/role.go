@@ -1,8 +1,13 @@
 package models
 
+import "time"
+
 type Role struct {
 	BaseModel
 	Name        string        `gorm:"unique;not null" json:"name"`
+	Description string        `json:"description"`
+	Protected   bool          `gorm:"not null;default:false" json:"protected"` // Seeded roles cannot be renamed or deleted
+	Priority    int           `gorm:"not null;default:0" json:"priority"`      // The role of a user with the highest priority is their primary role
 	Permissions []*Permission `gorm:"many2many:role_permissions;" json:"permissions"`
 }
 
@@ -15,3 +20,11 @@ type UserRole struct {
 	UserID string `gorm:"primaryKey" json:"user_id"`
 	RoleID string `gorm:"primaryKey" json:"role_id"`
 }
+
+// SeededRolePermission records a default permission granted to a seeded role,
+// so seeding again does not grant it back after an admin revoked it
+type SeededRolePermission struct {
+	RoleID       string `gorm:"primaryKey"`
+	PermissionID string `gorm:"primaryKey"`
+	CreatedAt    time.Time
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type Session struct {
@@ -9,10 +11,12 @@ type Session struct {
 	Description      string `gorm:"not null"`
 	MaxMembers       int    `gorm:"not null"` // Maximum number of members allowed
 	DateTime         *time.Time
-	CreatedBy        string  `gorm:"not null"`
-	Status           string  `gorm:"type:varchar(20);default:'open'"`
-	BadmintonCourtID *string // Foreign key to BadmintonCourt
-	GroupID          *string // Optional group ID
+	CreatedBy        string          `gorm:"not null"`
+	Status           string          `gorm:"type:varchar(20);default:'open'"`
+	BadmintonCourtID *string         // Foreign key to BadmintonCourt
+	GroupID          *string         // Optional group ID
+	Cost             decimal.Decimal `gorm:"type:numeric(12,2);not null;default:0"` // Court cost debited from the group wallet on completion
+	CostSplit        string          `gorm:"type:varchar(20);default:'pool'"`
 	Group            *Group
 	BadmintonCourt   *BadmintonCourt `gorm:"foreignKey:BadmintonCourtID"` // Relationship
 	Attendees        []*SessionAttendee
@@ -0,0 +1,10 @@
+package models
+
+type SessionComment struct {
+	BaseModel
+	SessionID string  `gorm:"not null;index"`
+	AuthorID  string  `gorm:"not null"`
+	Author    *User   `gorm:"foreignKey:AuthorID"`
+	Content   string  `gorm:"not null"`
+	Mentions  []*User `gorm:"many2many:session_comment_mentions;"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use token exchanged for a new access token and a new refresh token.
+// Tokens rotated from the same login share a family, which is revoked as a whole when a used token is replayed.
+type RefreshToken struct {
+	BaseModel
+	UserID    string     `gorm:"not null;index"`
+	FamilyID  string     `gorm:"not null;index"`
+	TokenHash string     `gorm:"uniqueIndex;not null"`
+	AccessJTI string     `gorm:"index"` // jti of the access token issued along with this token
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set when the token is rotated
+	RevokedAt *time.Time
+}
+
+// IsActive checks if the refresh token can still be exchanged
+func (t *RefreshToken) IsActive() bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// LoginCode is a single-use code the frontend exchanges for the tokens of a login, so tokens never travel in a URL
+type LoginCode struct {
+	CodeHash  string    `gorm:"primaryKey"`
+	UserID    string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// RevokedToken is an access token revoked before it expires, keyed on its jti
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	UserID    string    `gorm:"index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
@@ -1,22 +1,54 @@
 package models
 
+import "slices"
+
 type AuthUser struct {
-	ID     string
-	Role   string
-	Source string // Source of the user, e.g. "badminton", "cognito"
+	ID       string
+	Role     string
+	Source   string   // Source of the user, e.g. "badminton", "cognito", "api_key"
+	TokenID  string   // jti of the access token, empty for Cognito users and API keys
+	APIKeyID string   // API key the request is authenticated with
+	Scopes   []string // Permissions an API key is limited to, nil when not using an API key
+	ActorID  string   // Admin impersonating the user, empty otherwise
+
+	PermissionVersion int // Permission version of the user when the access token was issued
+}
+
+// IsImpersonated checks if an admin is acting as the user
+func (u *AuthUser) IsImpersonated() bool {
+	return len(u.ActorID) > 0
+}
+
+// HasScope checks if the request may use a permission. Only API keys are limited by scopes.
+func (u *AuthUser) HasScope(permission string) bool {
+	return u.Scopes == nil || slices.Contains(u.Scopes, permission)
 }
 
 type User struct {
 	BaseModel
-	GoogleID  string  `gorm:"unique;not null"`
+	GoogleID  *string `gorm:"unique"` // Deprecated: logins are linked through UserIdentity
 	Email     string  `gorm:"unique;not null"`
 	Name      string  `gorm:"not null"`
-	Role      string  `gorm:"type:varchar(20);default:'player'"`
 	Roles     []*Role `gorm:"many2many:user_roles;"`
 	AvatarURL string
+
+	// PermissionVersion is increased whenever the roles of the user change, so older access tokens are refused
+	PermissionVersion int `gorm:"not null;default:0"`
+
+	Identities []*UserIdentity `gorm:"foreignKey:UserID"`
 }
 
-// ValidateUserRole validates the user role
-func (u *User) ValidateUserRole() bool {
-	return ValidUserRole(u.Role)
+// PrimaryRole returns the name of the role of the user with the highest priority, or an empty string without roles.
+// Roles must be loaded.
+func (u *User) PrimaryRole() string {
+	var primary *Role
+	for _, role := range u.Roles {
+		if primary == nil || role.Priority > primary.Priority || (role.Priority == primary.Priority && role.Name < primary.Name) {
+			primary = role
+		}
+	}
+	if primary == nil {
+		return ""
+	}
+	return primary.Name
 }
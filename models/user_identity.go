@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an identity provider, e.g. Google or Keycloak
+type UserIdentity struct {
+	BaseModel
+	UserID      string `gorm:"not null;index"`
+	Provider    string `gorm:"type:varchar(50);not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject     string `gorm:"not null;uniqueIndex:idx_user_identities_provider_subject"` // sub claim of the provider
+	Email       string // Email reported by the provider at the last login
+	LastLoginAt *time.Time
+}
@@ -0,0 +1,164 @@
+// Package policy decides what a user may do with a specific resource, from their global role,
+// ownership of the resource and their role in its group. Callers load the facts a decision depends on,
+// the decisions themselves are pure functions.
+package policy
+
+import "github.com/alanrb/badminton/backend/models"
+
+// Action is something a user does with a resource
+type Action string
+
+const (
+	View   Action = "view"
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+
+	// Group actions
+	AddMember          Action = "add_member"
+	RemoveMember       Action = "remove_member"
+	ManageMemberRoles  Action = "manage_member_roles"
+	TransferOwnership  Action = "transfer_ownership"
+	ReviewJoinRequests Action = "review_join_requests"
+	PostAnnouncement   Action = "post_announcement"
+	CreateSession      Action = "create_session"
+	ViewFinances       Action = "view_finances" // Balances and transactions of every member
+	RecordTopUp        Action = "record_top_up"
+	ConfigureWallet    Action = "configure_wallet"
+
+	// Session actions
+	Attend          Action = "attend"
+	ManageAttendees Action = "manage_attendees"
+	Comment         Action = "comment"
+)
+
+// Subject is the user a decision is made for
+type Subject struct {
+	UserID string
+	Admin  bool
+}
+
+// Resource is something a decision is made about
+type Resource interface {
+	allows(subject Subject, action Action) bool
+}
+
+// Allowed decides if the subject may perform the action on the resource. Unknown actions are denied.
+func Allowed(subject Subject, action Action, resource Resource) bool {
+	if resource == nil {
+		return false
+	}
+	return resource.allows(subject, action)
+}
+
+// Group holds what decisions about a group depend on
+type Group struct {
+	OwnerID    string
+	MemberRole string // Role of the subject in the group, empty when not a member
+}
+
+func (g *Group) isMember() bool {
+	return len(g.MemberRole) > 0
+}
+
+func (g *Group) isOrganizer() bool {
+	return models.IsGroupOrganizerRole(g.MemberRole)
+}
+
+func (g *Group) allows(subject Subject, action Action) bool {
+	switch action {
+	case View, CreateSession:
+		return subject.Admin || g.isMember()
+	case AddMember, ReviewJoinRequests, PostAnnouncement, ViewFinances, RecordTopUp:
+		return subject.Admin || g.isOrganizer()
+	case Update, Delete, RemoveMember, ManageMemberRoles, TransferOwnership, ConfigureWallet:
+		return subject.Admin || g.OwnerID == subject.UserID
+	default:
+		return false
+	}
+}
+
+// Session holds what decisions about a session depend on
+type Session struct {
+	CreatedBy string
+	Group     *Group // Group the session belongs to, nil for public sessions
+}
+
+func (s *Session) allows(subject Subject, action Action) bool {
+	switch action {
+	case View, Attend, Comment:
+		// Public sessions are visible to everyone, group sessions to the group's members
+		return s.Group == nil || s.Group.allows(subject, View)
+	case Update, Delete, ManageAttendees:
+		return subject.Admin || s.CreatedBy == subject.UserID || (s.Group != nil && s.Group.isOrganizer())
+	default:
+		return false
+	}
+}
+
+// Court is a badminton court, managed by admins
+type Court struct{}
+
+func (Court) allows(subject Subject, action Action) bool {
+	switch action {
+	case View:
+		return true
+	case Create, Update, Delete:
+		return subject.Admin
+	default:
+		return false
+	}
+}
+
+// Announcement is a post in a group feed
+type Announcement struct {
+	AuthorID string
+	Group    Group
+}
+
+func (a *Announcement) allows(subject Subject, action Action) bool {
+	switch action {
+	case View:
+		return a.Group.allows(subject, View)
+	case Update:
+		// Nobody edits someone else's words
+		return a.AuthorID == subject.UserID
+	case Delete:
+		return a.AuthorID == subject.UserID || a.Group.allows(subject, PostAnnouncement)
+	default:
+		return false
+	}
+}
+
+// SessionComment is a comment in the thread of a session
+type SessionComment struct {
+	AuthorID string
+	Session  Session
+}
+
+func (c *SessionComment) allows(subject Subject, action Action) bool {
+	switch action {
+	case View:
+		return c.Session.allows(subject, View)
+	case Update:
+		return c.AuthorID == subject.UserID
+	case Delete:
+		return c.AuthorID == subject.UserID || c.Session.allows(subject, Update)
+	default:
+		return false
+	}
+}
+
+// APIKey is a personal API key
+type APIKey struct {
+	UserID string
+}
+
+func (k *APIKey) allows(subject Subject, action Action) bool {
+	switch action {
+	case View, Delete:
+		return subject.Admin || k.UserID == subject.UserID
+	default:
+		return false
+	}
+}
@@ -0,0 +1,216 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/alanrb/badminton/backend/models"
+)
+
+var (
+	admin      = Subject{UserID: "admin", Admin: true}
+	owner      = Subject{UserID: "owner"}
+	organizer  = Subject{UserID: "organizer"}
+	member     = Subject{UserID: "member"}
+	creator    = Subject{UserID: "creator"}
+	author     = Subject{UserID: "author"}
+	outsider   = Subject{UserID: "outsider"}
+	allActions = []Action{View, Create, Update, Delete, AddMember, RemoveMember, ManageMemberRoles, TransferOwnership,
+		ReviewJoinRequests, PostAnnouncement, CreateSession, ViewFinances, RecordTopUp, ConfigureWallet,
+		Attend, ManageAttendees, Comment}
+)
+
+// groupAs returns the group as seen by a subject, with the subject's role in it
+func groupAs(subject Subject) *Group {
+	roles := map[string]string{
+		owner.UserID:     models.GroupRoleOwner,
+		organizer.UserID: models.GroupRoleCoOrganizer,
+		member.UserID:    models.GroupRoleMember,
+		author.UserID:    models.GroupRoleMember,
+		creator.UserID:   models.GroupRoleMember,
+	}
+	return &Group{OwnerID: owner.UserID, MemberRole: roles[subject.UserID]}
+}
+
+type testCase struct {
+	name     string
+	subject  Subject
+	action   Action
+	resource func(subject Subject) Resource
+	allowed  bool
+}
+
+func runCases(t *testing.T, cases []testCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Allowed(tc.subject, tc.action, tc.resource(tc.subject)); got != tc.allowed {
+				t.Errorf("Allowed(%s, %s) = %v, want %v", tc.subject.UserID, tc.action, got, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	group := func(subject Subject) Resource { return groupAs(subject) }
+
+	runCases(t, []testCase{
+		{"member views", member, View, group, true},
+		{"outsider cannot view", outsider, View, group, false},
+		{"admin views", admin, View, group, true},
+
+		{"owner updates", owner, Update, group, true},
+		{"organizer cannot update", organizer, Update, group, false},
+		{"admin updates", admin, Update, group, true},
+		{"owner deletes", owner, Delete, group, true},
+		{"member cannot delete", member, Delete, group, false},
+		{"owner transfers ownership", owner, TransferOwnership, group, true},
+		{"organizer cannot transfer ownership", organizer, TransferOwnership, group, false},
+		{"owner manages member roles", owner, ManageMemberRoles, group, true},
+		{"organizer cannot manage member roles", organizer, ManageMemberRoles, group, false},
+		{"owner removes members", owner, RemoveMember, group, true},
+		{"organizer cannot remove members", organizer, RemoveMember, group, false},
+		{"owner configures wallet", owner, ConfigureWallet, group, true},
+		{"organizer cannot configure wallet", organizer, ConfigureWallet, group, false},
+
+		{"organizer adds members", organizer, AddMember, group, true},
+		{"owner adds members", owner, AddMember, group, true},
+		{"member cannot add members", member, AddMember, group, false},
+		{"organizer reviews join requests", organizer, ReviewJoinRequests, group, true},
+		{"outsider cannot review join requests", outsider, ReviewJoinRequests, group, false},
+		{"organizer posts announcements", organizer, PostAnnouncement, group, true},
+		{"member cannot post announcements", member, PostAnnouncement, group, false},
+		{"organizer creates sessions", organizer, CreateSession, group, true},
+		{"member creates sessions", member, CreateSession, group, true},
+		{"outsider cannot create sessions", outsider, CreateSession, group, false},
+		{"organizer views finances", organizer, ViewFinances, group, true},
+		{"member cannot view finances", member, ViewFinances, group, false},
+		{"organizer records top-ups", organizer, RecordTopUp, group, true},
+		{"member cannot record top-ups", member, RecordTopUp, group, false},
+
+		{"unknown action is denied", owner, Attend, group, false},
+	})
+}
+
+func TestSession(t *testing.T) {
+	public := func(subject Subject) Resource { return &Session{CreatedBy: creator.UserID} }
+	inGroup := func(subject Subject) Resource { return &Session{CreatedBy: creator.UserID, Group: groupAs(subject)} }
+
+	runCases(t, []testCase{
+		{"anyone views public session", outsider, View, public, true},
+		{"anyone attends public session", outsider, Attend, public, true},
+		{"member views group session", member, View, inGroup, true},
+		{"member comments on group session", member, Comment, inGroup, true},
+		{"outsider cannot view group session", outsider, View, inGroup, false},
+		{"outsider cannot attend group session", outsider, Attend, inGroup, false},
+		{"admin views group session", admin, View, inGroup, true},
+
+		{"creator updates", creator, Update, public, true},
+		{"outsider cannot update public session", outsider, Update, public, false},
+		{"organizer updates group session", organizer, Update, inGroup, true},
+		{"member cannot update group session", member, Update, inGroup, false},
+		{"organizer manages attendees", organizer, ManageAttendees, inGroup, true},
+		{"member cannot manage attendees", member, ManageAttendees, inGroup, false},
+		{"creator deletes", creator, Delete, inGroup, true},
+		{"admin deletes", admin, Delete, public, true},
+
+		{"unknown action is denied", admin, TransferOwnership, public, false},
+	})
+}
+
+func TestCourt(t *testing.T) {
+	court := func(subject Subject) Resource { return Court{} }
+
+	runCases(t, []testCase{
+		{"anyone views", outsider, View, court, true},
+		{"admin creates", admin, Create, court, true},
+		{"player cannot create", member, Create, court, false},
+		{"admin updates", admin, Update, court, true},
+		{"player cannot update", owner, Update, court, false},
+		{"admin deletes", admin, Delete, court, true},
+		{"player cannot delete", member, Delete, court, false},
+	})
+}
+
+func TestAnnouncement(t *testing.T) {
+	announcement := func(subject Subject) Resource {
+		return &Announcement{AuthorID: author.UserID, Group: *groupAs(subject)}
+	}
+
+	runCases(t, []testCase{
+		{"member views", member, View, announcement, true},
+		{"outsider cannot view", outsider, View, announcement, false},
+		{"author updates", author, Update, announcement, true},
+		{"organizer cannot update", organizer, Update, announcement, false},
+		{"admin cannot update", admin, Update, announcement, false},
+		{"author deletes", author, Delete, announcement, true},
+		{"organizer deletes", organizer, Delete, announcement, true},
+		{"admin deletes", admin, Delete, announcement, true},
+		{"member cannot delete", member, Delete, announcement, false},
+	})
+}
+
+func TestSessionComment(t *testing.T) {
+	comment := func(subject Subject) Resource {
+		return &SessionComment{AuthorID: author.UserID, Session: Session{CreatedBy: creator.UserID, Group: groupAs(subject)}}
+	}
+
+	runCases(t, []testCase{
+		{"member views", member, View, comment, true},
+		{"outsider cannot view", outsider, View, comment, false},
+		{"author updates", author, Update, comment, true},
+		{"session creator cannot update", creator, Update, comment, false},
+		{"author deletes", author, Delete, comment, true},
+		{"session creator deletes", creator, Delete, comment, true},
+		{"organizer deletes", organizer, Delete, comment, true},
+		{"member cannot delete", member, Delete, comment, false},
+	})
+}
+
+func TestAPIKey(t *testing.T) {
+	key := func(subject Subject) Resource { return &APIKey{UserID: member.UserID} }
+
+	runCases(t, []testCase{
+		{"owner views", member, View, key, true},
+		{"owner revokes", member, Delete, key, true},
+		{"other user cannot revoke", outsider, Delete, key, false},
+		{"admin revokes", admin, Delete, key, true},
+		{"nobody updates", member, Update, key, false},
+	})
+}
+
+func TestUnknownActionsAreDenied(t *testing.T) {
+	resources := []Resource{
+		groupAs(admin),
+		&Session{},
+		Court{},
+		&Announcement{},
+		&SessionComment{},
+		&APIKey{},
+	}
+	for _, resource := range resources {
+		if Allowed(admin, Action("unknown"), resource) {
+			t.Errorf("unknown action allowed on %T", resource)
+		}
+	}
+
+	if Allowed(admin, View, nil) {
+		t.Error("nil resource allowed")
+	}
+}
+
+func TestOutsiderIsDeniedGroupResources(t *testing.T) {
+	group := groupAs(outsider)
+	resources := []Resource{
+		group,
+		&Session{CreatedBy: creator.UserID, Group: group},
+		&Announcement{AuthorID: author.UserID, Group: *group},
+		&SessionComment{AuthorID: author.UserID, Session: Session{CreatedBy: creator.UserID, Group: group}},
+	}
+	for _, resource := range resources {
+		for _, action := range allActions {
+			if Allowed(outsider, action, resource) {
+				t.Errorf("outsider allowed to %s on %T", action, resource)
+			}
+		}
+	}
+}
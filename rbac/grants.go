@@ -0,0 +1,139 @@
+package rbac
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"gorm.io/gorm"
+)
+
+// GrantsTTL is how long the grants of a user are cached. Every instance keeps its own cache,
+// so a change made on another instance is seen at the latest after this long.
+const GrantsTTL = 30 * time.Second
+
+// Grants are the roles and permissions of a user
+type Grants struct {
+	Roles       []string // Highest priority first
+	Permissions []string
+	Version     int // PermissionVersion of the user
+}
+
+// HasRole checks if the user has a role
+func (g *Grants) HasRole(role string) bool {
+	return slices.Contains(g.Roles, role)
+}
+
+// PrimaryRole returns the role of the user with the highest priority, or an empty string without roles
+func (g *Grants) PrimaryRole() string {
+	if len(g.Roles) == 0 {
+		return ""
+	}
+	return g.Roles[0]
+}
+
+// HasPermission checks if any role of the user grants a permission
+func (g *Grants) HasPermission(permission string) bool {
+	return slices.Contains(g.Permissions, permission)
+}
+
+// LoadGrants loads the roles and permissions of a user from the database
+func LoadGrants(db *gorm.DB, userID string) (*Grants, error) {
+	grants := &Grants{Roles: make([]string, 0), Permissions: make([]string, 0)}
+
+	if err := db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("permission_version").
+		Scan(&grants.Version).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.UserRole{}).
+		Joins("JOIN roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.priority DESC, roles.name").
+		Pluck("roles.name", &grants.Roles).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.UserRole{}).
+		Joins("JOIN role_permissions ON user_roles.role_id = role_permissions.role_id").
+		Joins("JOIN permissions ON role_permissions.permission_id = permissions.id").
+		Where("user_roles.user_id = ?", userID).
+		Distinct().
+		Pluck("permissions.name", &grants.Permissions).Error; err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// GrantsCache keeps the grants of recently seen users for a short time
+type GrantsCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]grantsEntry
+}
+
+type grantsEntry struct {
+	grants    *Grants
+	expiresAt time.Time
+}
+
+// NewGrantsCache creates a cache keeping grants for ttl
+func NewGrantsCache(ttl time.Duration) *GrantsCache {
+	return &GrantsCache{ttl: ttl, entries: make(map[string]grantsEntry)}
+}
+
+// Get returns the cached grants of a user, loading them when missing or expired. Failed loads are not cached.
+func (c *GrantsCache) Get(db *gorm.DB, userID string) (*Grants, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.grants, nil
+	}
+
+	grants, err := LoadGrants(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[userID] = grantsEntry{grants: grants, expiresAt: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return grants, nil
+}
+
+// Invalidate drops the cached grants of users, after their roles changed
+func (c *GrantsCache) Invalidate(userIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, userID := range userIDs {
+		delete(c.entries, userID)
+	}
+}
+
+// InvalidateAll drops every cached grant, after the permissions of a role changed
+func (c *GrantsCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// Cache is the grants cache shared by the whole application
+var Cache = NewGrantsCache(GrantsTTL)
+
+// UserGrants returns the grants of a user through the shared cache
+func UserGrants(db *gorm.DB, userID string) (*Grants, error) {
+	return Cache.Get(db, userID)
+}
+
+// BumpPermissionVersion increases the permission version of users whose roles changed,
+// so the access tokens issued to them before are refused. Drop their cached grants once the change is committed.
+func BumpPermissionVersion(db *gorm.DB, userIDs ...string) error {
+	return db.Model(&models.User{}).
+		Where("id IN ?", userIDs).
+		UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+}
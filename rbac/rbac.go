@@ -2,6 +2,7 @@ package rbac
 
 import (
 	"log"
+	"slices"
 
 	"github.com/alanrb/badminton/backend/models"
 	"gorm.io/gorm"
@@ -17,6 +18,10 @@ const (
 	PermissionDeleteUsers PermissionName = "delete_users"
 	PermissionCreateUsers PermissionName = "create_users"
 
+	PermissionImpersonateUsers PermissionName = "impersonate_users"
+	PermissionManageRoles      PermissionName = "manage_roles"
+	PermissionViewAuditLog     PermissionName = "view_audit_log"
+
 	PermissionListGroups     PermissionName = "list_groups"
 	PermissionCreateGroups   PermissionName = "create_groups"
 	PermissionEditGroups     PermissionName = "edit_groups"
@@ -34,9 +39,39 @@ const (
 	PermissionEditSessions   PermissionName = "edit_sessions"
 )
 
+// Permissions lists every permission, they are also the scopes of API keys
+var Permissions = []PermissionName{
+	PermissionListUsers,
+	PermissionEditUsers,
+	PermissionDeleteUsers,
+	PermissionCreateUsers,
+	PermissionImpersonateUsers,
+	PermissionManageRoles,
+	PermissionViewAuditLog,
+	PermissionListGroups,
+	PermissionCreateGroups,
+	PermissionEditGroups,
+	PermissionDeleteGroups,
+	PermissionAddGroupPlayer,
+	PermissionListCourts,
+	PermissionCreateCourts,
+	PermissionEditCourts,
+	PermissionDeleteCourts,
+	PermissionListSessions,
+	PermissionCreateSessions,
+	PermissionDeleteSessions,
+	PermissionEditSessions,
+}
+
+// ValidPermission checks if a permission exists
+func ValidPermission(name string) bool {
+	return slices.Contains(Permissions, PermissionName(name))
+}
+
 func AssignRoleToUser(db *gorm.DB, userID string, roleName string) error {
+	// Locked for share so the role cannot be deleted before the assignment commits
 	var role models.Role
-	if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+	if err := db.Clauses(clause.Locking{Strength: "SHARE"}).Where("name = ?", roleName).First(&role).Error; err != nil {
 		return err
 	}
 
@@ -48,6 +83,51 @@ func AssignRoleToUser(db *gorm.DB, userID string, roleName string) error {
 	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&userRole).Error
 }
 
+// DefaultRoles are the seeded roles and the permissions granted to them by default
+var DefaultRoles = []struct {
+	Name        string
+	Description string
+	Priority    int
+	Permissions []PermissionName
+}{
+	{
+		Name:        models.UserRoleAdmin,
+		Description: "Manages users, courts and every group and session",
+		Priority:    100,
+		Permissions: Permissions, // Admin has all permissions
+	},
+	{
+		Name:        models.UserRoleGroupOwner,
+		Description: "Runs groups and their sessions",
+		Priority:    50,
+		Permissions: []PermissionName{
+			PermissionListGroups,
+			PermissionEditGroups,
+			PermissionDeleteGroups,
+			PermissionListCourts,
+			PermissionListSessions,
+			PermissionCreateSessions,
+			PermissionEditSessions,
+			PermissionDeleteSessions,
+		},
+	},
+	{
+		Name:        models.UserRolePlayer,
+		Description: "Joins groups and sessions",
+		Priority:    10,
+		Permissions: []PermissionName{
+			PermissionListGroups,
+			PermissionListCourts,
+			PermissionListSessions,
+			PermissionCreateSessions,
+			PermissionEditSessions,
+			PermissionDeleteSessions,
+		},
+	},
+}
+
+// SeedRolesAndPermissions creates the default roles and permissions. Each default permission is granted to its role
+// only once, so permissions an admin revoked from a seeded role stay revoked, while permissions added in code are granted.
 func SeedRolesAndPermissions(db *gorm.DB) {
 	// Start a new transaction
 	tx := db.Begin()
@@ -63,133 +143,62 @@ func SeedRolesAndPermissions(db *gorm.DB) {
 	}()
 
 	// Create roles
-	roles := []*models.Role{
-		{Name: models.UserRoleAdmin},
-		{Name: models.UserRoleGroupOwner},
-		{Name: models.UserRolePlayer},
+	roles := make([]*models.Role, 0, len(DefaultRoles))
+	roleNames := make([]string, 0, len(DefaultRoles))
+	for _, role := range DefaultRoles {
+		roles = append(roles, &models.Role{Name: role.Name, Description: role.Description, Protected: true, Priority: role.Priority})
+		roleNames = append(roleNames, role.Name)
 	}
 	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&roles).Error; err != nil {
 		tx.Rollback()
 		log.Fatalf("Failed to seed roles: %v", err)
 	}
+	if err := tx.Model(&models.Role{}).Where("name IN ?", roleNames).Update("protected", true).Error; err != nil {
+		tx.Rollback()
+		log.Fatalf("Failed to protect roles: %v", err)
+	}
 
 	// Create permissions
-	permissions := []*models.Permission{
-		{Name: string(PermissionListUsers)},
-		{Name: string(PermissionEditUsers)},
-		{Name: string(PermissionDeleteUsers)},
-		{Name: string(PermissionCreateUsers)},
-		{Name: string(PermissionListGroups)},
-		{Name: string(PermissionCreateGroups)},
-		{Name: string(PermissionEditGroups)},
-		{Name: string(PermissionDeleteGroups)},
-		{Name: string(PermissionAddGroupPlayer)},
-		{Name: string(PermissionListCourts)},
-		{Name: string(PermissionCreateCourts)},
-		{Name: string(PermissionEditCourts)},
-		{Name: string(PermissionDeleteCourts)},
-		{Name: string(PermissionListSessions)},
-		{Name: string(PermissionCreateSessions)},
-		{Name: string(PermissionDeleteSessions)},
-		{Name: string(PermissionEditSessions)},
+	permissions := make([]*models.Permission, 0, len(Permissions))
+	for _, permission := range Permissions {
+		permissions = append(permissions, &models.Permission{Name: string(permission)})
 	}
-
 	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&permissions).Error; err != nil {
 		tx.Rollback()
 		log.Fatalf("Failed to seed permissions: %v", err)
 	}
 
-	// Assign permissions to roles
-	var adminRole, groupOwnerRole, playerRole *models.Role
-	tx.Where("name = ?", models.UserRoleAdmin).First(&adminRole)
-	tx.Where("name = ?", models.UserRoleGroupOwner).First(&groupOwnerRole)
-	tx.Where("name = ?", models.UserRolePlayer).First(&playerRole)
-
-	var listUserPerm,
-		editUserPerm,
-		deleteUserPerm,
-		createUserPerm,
-		listGroupPerm,
-		createGroupPerm,
-		editGroupPerm,
-		deleteGroupPerm,
-		addPlayerPerm,
-		listCourtPerm,
-		createCourtPerm,
-		editCourtPerm,
-		deleteCourtPerm,
-		listSessionPerm,
-		createSessionPerm,
-		editSessionPerm,
-		deleteSessionPerm *models.Permission
-	tx.Where("name = ?", PermissionListUsers).First(&listUserPerm)
-	tx.Where("name = ?", PermissionEditUsers).First(&editUserPerm)
-	tx.Where("name = ?", PermissionDeleteUsers).First(&deleteUserPerm)
-	tx.Where("name = ?", PermissionCreateUsers).First(&createUserPerm)
-	tx.Where("name = ?", PermissionListGroups).First(&listGroupPerm)
-	tx.Where("name = ?", PermissionCreateGroups).First(&createGroupPerm)
-	tx.Where("name = ?", PermissionEditGroups).First(&editGroupPerm)
-	tx.Where("name = ?", PermissionDeleteGroups).First(&deleteGroupPerm)
-	tx.Where("name = ?", PermissionAddGroupPlayer).First(&addPlayerPerm)
-	tx.Where("name = ?", PermissionListCourts).First(&listCourtPerm)
-	tx.Where("name = ?", PermissionCreateCourts).First(&createCourtPerm)
-	tx.Where("name = ?", PermissionEditCourts).First(&editCourtPerm)
-	tx.Where("name = ?", PermissionDeleteCourts).First(&deleteCourtPerm)
-	tx.Where("name = ?", PermissionListSessions).First(&listSessionPerm)
-	tx.Where("name = ?", PermissionCreateSessions).First(&createSessionPerm)
-	tx.Where("name = ?", PermissionDeleteSessions).First(&deleteSessionPerm)
-	tx.Where("name = ?", PermissionEditSessions).First(&editSessionPerm)
-
-	// Admin has all permissions
-	adminRole.Permissions = append(adminRole.Permissions, []*models.Permission{
-		listUserPerm,
-		editUserPerm,
-		deleteUserPerm,
-		createUserPerm,
-		listGroupPerm,
-		createGroupPerm,
-		editGroupPerm,
-		deleteGroupPerm,
-		addPlayerPerm,
-		listCourtPerm,
-		createCourtPerm,
-		editCourtPerm,
-		deleteCourtPerm,
-		listSessionPerm,
-		createSessionPerm,
-		editSessionPerm,
-		deleteSessionPerm}...)
-	if err := tx.Save(&adminRole).Error; err != nil {
-		tx.Rollback()
-		log.Fatalf("Failed to assign permissions to roles: %v", err)
+	// Roles seeded before they had a priority get the default one
+	for _, role := range DefaultRoles {
+		if err := tx.Model(&models.Role{}).Where("name = ? AND priority = 0", role.Name).Update("priority", role.Priority).Error; err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to set the priority of role %s: %v", role.Name, err)
+		}
 	}
 
-	groupOwnerRole.Permissions = append(playerRole.Permissions, []*models.Permission{
-		listGroupPerm,
-		editGroupPerm,
-		deleteGroupPerm,
-		listCourtPerm,
-		listSessionPerm,
-		createSessionPerm,
-		editSessionPerm,
-		deleteSessionPerm,
-	}...)
-	if err := tx.Save(&groupOwnerRole).Error; err != nil {
-		tx.Rollback()
-		log.Fatalf("Failed to assign group owner permissions: %v", err)
-	}
+	// Assign permissions to roles
+	for _, role := range DefaultRoles {
+		permissionNames := make([]string, 0, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			permissionNames = append(permissionNames, string(permission))
+		}
 
-	playerRole.Permissions = append(playerRole.Permissions, []*models.Permission{
-		listGroupPerm,
-		listCourtPerm,
-		listSessionPerm,
-		createSessionPerm,
-		editSessionPerm,
-		deleteSessionPerm,
-	}...)
-	if err := tx.Save(&playerRole).Error; err != nil {
-		tx.Rollback()
-		log.Fatalf("Failed to assign player permissions: %v", err)
+		if err := tx.Exec(`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions
+			WHERE roles.name = ? AND permissions.name IN ? AND NOT EXISTS (
+				SELECT 1 FROM seeded_role_permissions s WHERE s.role_id = roles.id AND s.permission_id = permissions.id)
+			ON CONFLICT DO NOTHING`, role.Name, permissionNames).Error; err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to assign permissions to role %s: %v", role.Name, err)
+		}
+
+		if err := tx.Exec(`INSERT INTO seeded_role_permissions (role_id, permission_id, created_at)
+			SELECT roles.id, permissions.id, now() FROM roles CROSS JOIN permissions
+			WHERE roles.name = ? AND permissions.name IN ?
+			ON CONFLICT DO NOTHING`, role.Name, permissionNames).Error; err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to record permissions of role %s: %v", role.Name, err)
+		}
 	}
 
 	// Commit the transaction if everything succeeds
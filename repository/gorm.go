@@ -0,0 +1,494 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/alanrb/badminton/backend/database"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/rbac"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormStore stores the records in the database with GORM
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewStore creates a store backed by the database
+func NewStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Users() UserRepository {
+	return &gormUsers{db: s.db}
+}
+
+func (s *gormStore) Sessions() SessionRepository {
+	return &gormSessions{db: s.db}
+}
+
+func (s *gormStore) Groups() GroupRepository {
+	return &gormGroups{db: s.db}
+}
+
+func (s *gormStore) Courts() CourtRepository {
+	return &gormCourts{db: s.db}
+}
+
+func (s *gormStore) Wallets() WalletRepository {
+	return &gormWallets{db: s.db}
+}
+
+func (s *gormStore) Atomic(ctx context.Context, fn func(store Store) error) error {
+	return database.RunInTransaction(s.db.WithContext(ctx), func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// notFound turns GORM's not found error into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// save updates every column of a record at the version it was read and moves it to the next version,
+// failing with ErrStale when the record is no longer at that version
+func save(db *gorm.DB, value interface{}, base *models.BaseModel) error {
+	version := base.Version
+	base.Version++
+	result := db.Omit(clause.Associations).Select("*").Where("version = ?", version).Save(value)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrStale
+	}
+	if result.Error != nil {
+		base.Version = version
+	}
+	return result.Error
+}
+
+// affected fails with ErrNotFound when a change matched no row
+func affected(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r *gormUsers) FindByID(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Roles").First(&user, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	grants, err := rbac.UserGrants(r.db.WithContext(ctx), userID)
+	if err != nil {
+		return false, err
+	}
+	return grants.HasRole(models.UserRoleAdmin), nil
+}
+
+func (r *gormUsers) List(ctx context.Context, offset int, limit int) ([]*models.User, int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&models.User{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []*models.User
+	if err := r.db.WithContext(ctx).Preload("Roles").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *gormUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Omit("Roles", "Identities").Create(user).Error
+}
+
+func (r *gormUsers) Update(ctx context.Context, user *models.User) error {
+	return save(r.db.WithContext(ctx), user, &user.BaseModel)
+}
+
+func (r *gormUsers) FindRole(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &role, nil
+}
+
+func (r *gormUsers) ReplaceRoles(ctx context.Context, userID string, roles []*models.Role) error {
+	// Transaction nests in the one of Atomic
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locked for share so the roles cannot be deleted before the assignment commits
+		ids := make([]string, 0, len(roles))
+		for _, role := range roles {
+			ids = append(ids, role.ID)
+		}
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+		var locked []string
+		if err := tx.Model(&models.Role{}).Clauses(clause.Locking{Strength: "SHARE"}).
+			Where("id IN ?", ids).Pluck("id", &locked).Error; err != nil {
+			return err
+		}
+		// Roles deleted since they were found
+		if len(locked) != len(ids) {
+			return ErrNotFound
+		}
+
+		user := models.User{BaseModel: models.BaseModel{ID: userID}}
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		return rbac.BumpPermissionVersion(tx, userID)
+	})
+}
+
+func (r *gormUsers) Permissions(ctx context.Context, userID string) ([]string, error) {
+	permissions := make([]string, 0)
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT p.name
+		FROM permissions p
+		JOIN role_permissions rp ON p.id = rp.permission_id
+		JOIN roles r ON rp.role_id = r.id
+		JOIN user_roles ur ON r.id = ur.role_id
+		WHERE ur.user_id = ?
+	`, userID).Scan(&permissions).Error
+	return permissions, err
+}
+
+type gormCourts struct {
+	db *gorm.DB
+}
+
+func (r *gormCourts) List(ctx context.Context) ([]*models.BadmintonCourt, error) {
+	var courts []*models.BadmintonCourt
+	if err := r.db.WithContext(ctx).Find(&courts).Error; err != nil {
+		return nil, err
+	}
+	return courts, nil
+}
+
+func (r *gormCourts) FindByID(ctx context.Context, id string) (*models.BadmintonCourt, error) {
+	var court models.BadmintonCourt
+	if err := r.db.WithContext(ctx).First(&court, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &court, nil
+}
+
+func (r *gormCourts) Create(ctx context.Context, court *models.BadmintonCourt) error {
+	return r.db.WithContext(ctx).Create(court).Error
+}
+
+func (r *gormCourts) Update(ctx context.Context, court *models.BadmintonCourt) error {
+	return save(r.db.WithContext(ctx), court, &court.BaseModel)
+}
+
+func (r *gormCourts) Delete(ctx context.Context, id string) error {
+	return affected(r.db.WithContext(ctx).Delete(&models.BadmintonCourt{}, "id = ?", id))
+}
+
+type gormSessions struct {
+	db *gorm.DB
+}
+
+func (r *gormSessions) FindByID(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessions) FindForUpdate(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessions) FindWithDetails(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).
+		Preload("Group").
+		Preload("BadmintonCourt").
+		Preload("Attendees.User").
+		First(&session, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessions) List(ctx context.Context, filter SessionFilter, offset int, limit int) ([]*models.Session, int64, error) {
+	query := r.db.WithContext(ctx).Table("sessions").
+		Joins("left join users on users.id = sessions.created_by").
+		Where("sessions.deleted_at IS NULL AND sessions.date_time > ?", filter.After)
+	if len(filter.VisibleTo) > 0 {
+		// Public sessions and sessions of the groups the user belongs to
+		query = query.Where("(sessions.group_id IS NULL) OR (sessions.group_id IN (SELECT group_id FROM group_members WHERE user_id = ?))", filter.VisibleTo)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var sessions []*models.Session
+	if err := query.
+		Select("sessions.*, users.name as created_by_name").
+		Preload("BadmintonCourt").
+		Preload("Attendees.User").
+		Preload("Group").
+		Offset(offset).
+		Limit(limit).
+		Find(&sessions).Error; err != nil {
+		return nil, 0, err
+	}
+	return sessions, total, nil
+}
+
+func (r *gormSessions) Create(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *gormSessions) Update(ctx context.Context, session *models.Session) error {
+	return save(r.db.WithContext(ctx), session, &session.BaseModel)
+}
+
+func (r *gormSessions) Delete(ctx context.Context, id string) error {
+	return affected(r.db.WithContext(ctx).Delete(&models.Session{}, "id = ?", id))
+}
+
+func (r *gormSessions) FindAttendee(ctx context.Context, sessionID string, userID string) (*models.SessionAttendee, error) {
+	var attendee models.SessionAttendee
+	if err := r.db.WithContext(ctx).Where("session_id = ? AND user_id = ?", sessionID, userID).First(&attendee).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &attendee, nil
+}
+
+func (r *gormSessions) ApprovedSlots(ctx context.Context, sessionID string) (int, error) {
+	var slots int
+	err := r.db.WithContext(ctx).Model(&models.SessionAttendee{}).
+		Where("session_id = ? AND status = ?", sessionID, models.ApprovalStatusApproved).
+		Select("COALESCE(SUM(slot), 0)").
+		Scan(&slots).Error
+	return slots, err
+}
+
+func (r *gormSessions) ApprovedAttendees(ctx context.Context, sessionID string) ([]*models.SessionAttendee, error) {
+	var attendees []*models.SessionAttendee
+	if err := r.db.WithContext(ctx).
+		Where("session_id = ? AND status = ?", sessionID, models.ApprovalStatusApproved).
+		Order("user_id").
+		Find(&attendees).Error; err != nil {
+		return nil, err
+	}
+	return attendees, nil
+}
+
+func (r *gormSessions) AddAttendee(ctx context.Context, attendee *models.SessionAttendee) error {
+	return r.changeAttendees(ctx, "id = ?", []interface{}{attendee.SessionID}, func(tx *gorm.DB) error {
+		return tx.Omit("User").Create(attendee).Error
+	})
+}
+
+func (r *gormSessions) UpdateAttendee(ctx context.Context, attendee *models.SessionAttendee) error {
+	return r.changeAttendees(ctx, "id = ?", []interface{}{attendee.SessionID}, func(tx *gorm.DB) error {
+		return affected(tx.Model(&models.SessionAttendee{}).
+			Where("session_id = ? AND user_id = ?", attendee.SessionID, attendee.UserID).
+			Updates(map[string]interface{}{"slot": attendee.Slot, "status": attendee.Status, "remark": attendee.Remark}))
+	})
+}
+
+func (r *gormSessions) RemoveAttendee(ctx context.Context, sessionID string, userID string) error {
+	return r.changeAttendees(ctx, "id = ?", []interface{}{sessionID}, func(tx *gorm.DB) error {
+		return affected(tx.Where("session_id = ? AND user_id = ?", sessionID, userID).Delete(&models.SessionAttendee{}))
+	})
+}
+
+func (r *gormSessions) RemoveGroupAttendances(ctx context.Context, groupID string, userID string, after time.Time) error {
+	sessions := r.db.Model(&models.SessionAttendee{}).
+		Select("session_id").
+		Where("user_id = ? AND session_id IN (?)", userID, r.db.Model(&models.Session{}).
+			Select("id").
+			Where("group_id = ? AND status = ? AND date_time > ?", groupID, models.SessionStatusOpen, after))
+	return r.changeAttendees(ctx, "id IN (?)", []interface{}{sessions}, func(tx *gorm.DB) error {
+		return tx.Where("user_id = ? AND session_id IN (?)", userID, sessions).Delete(&models.SessionAttendee{}).Error
+	})
+}
+
+// changeAttendees changes the attendees of the sessions matching the query, and moves those sessions to their next version
+func (r *gormSessions) changeAttendees(ctx context.Context, query string, args []interface{}, change func(tx *gorm.DB) error) error {
+	// Transaction nests in the one of Atomic
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).Where(query, args...).UpdateColumn("version", gorm.Expr("version + 1")).Error; err != nil {
+			return err
+		}
+		return change(tx)
+	})
+}
+
+type gormGroups struct {
+	db *gorm.DB
+}
+
+func (r *gormGroups) FindByID(ctx context.Context, id string) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.WithContext(ctx).First(&group, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroups) FindWithMembers(ctx context.Context, id string) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.WithContext(ctx).Preload("Members").Preload("Memberships").First(&group, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroups) FindIncludingDeleted(ctx context.Context, id string) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.WithContext(ctx).Unscoped().First(&group, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroups) List(ctx context.Context, memberID string, offset int, limit int) ([]*models.Group, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Group{})
+	if len(memberID) > 0 {
+		query = query.Where("groups.owner_id = ? OR groups.id IN (SELECT group_id FROM group_members WHERE user_id = ?)", memberID, memberID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var groups []*models.Group
+	if err := query.Offset(offset).Limit(limit).Preload("Members").Preload("Memberships").Find(&groups).Error; err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+func (r *gormGroups) Create(ctx context.Context, group *models.Group) error {
+	return r.db.WithContext(ctx).Omit("Members", "Memberships", "Sessions").Create(group).Error
+}
+
+func (r *gormGroups) Update(ctx context.Context, group *models.Group) error {
+	return save(r.db.WithContext(ctx), group, &group.BaseModel)
+}
+
+func (r *gormGroups) Delete(ctx context.Context, id string) error {
+	return affected(r.db.WithContext(ctx).Delete(&models.Group{}, "id = ?", id))
+}
+
+func (r *gormGroups) MemberRole(ctx context.Context, groupID string, userID string) (string, error) {
+	var roles []string
+	err := r.db.WithContext(ctx).Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Limit(1).
+		Pluck("role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+func (r *gormGroups) AddMember(ctx context.Context, member *models.GroupMember) error {
+	return r.db.WithContext(ctx).Create(member).Error
+}
+
+func (r *gormGroups) UpdateMemberRole(ctx context.Context, groupID string, userID string, role string) error {
+	return affected(r.db.WithContext(ctx).Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Update("role", role))
+}
+
+func (r *gormGroups) RemoveMember(ctx context.Context, groupID string, userID string) error {
+	return affected(r.db.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{}))
+}
+
+type gormWallets struct {
+	db *gorm.DB
+}
+
+func (r *gormWallets) Lock(ctx context.Context, groupID string) (*models.GroupWallet, error) {
+	db := r.db.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.GroupWallet{GroupID: groupID}).Error; err != nil {
+		return nil, err
+	}
+
+	var wallet models.GroupWallet
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&wallet, "group_id = ?", groupID).Error; err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+func (r *gormWallets) UpdateBalance(ctx context.Context, wallet *models.GroupWallet) error {
+	return r.db.WithContext(ctx).Model(wallet).Update("balance", wallet.Balance).Error
+}
+
+func (r *gormWallets) AdjustMemberBalance(ctx context.Context, groupID string, userID string, amount decimal.Decimal) (decimal.Decimal, error) {
+	db := r.db.WithContext(ctx)
+	balance := models.GroupWalletBalance{
+		GroupID: groupID,
+		UserID:  userID,
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&balance).Error; err != nil {
+		return decimal.Zero, err
+	}
+	if err := db.First(&balance).Error; err != nil {
+		return decimal.Zero, err
+	}
+
+	balance.Balance = balance.Balance.Add(amount)
+	if err := db.Model(&balance).Update("balance", balance.Balance).Error; err != nil {
+		return decimal.Zero, err
+	}
+	return balance.Balance, nil
+}
+
+func (r *gormWallets) AddTransaction(ctx context.Context, transaction *models.WalletTransaction) error {
+	return r.db.WithContext(ctx).Create(transaction).Error
+}
+
+func (r *gormWallets) SessionDebited(ctx context.Context, sessionID string) (bool, error) {
+	var debited int64
+	err := r.db.WithContext(ctx).Model(&models.WalletTransaction{}).
+		Where("session_id = ? AND type = ?", sessionID, models.WalletTransactionSessionDebit).
+		Count(&debited).Error
+	return debited > 0, err
+}
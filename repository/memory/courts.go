@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+type courts struct {
+	s *Store
+}
+
+func (r *courts) List(ctx context.Context) ([]*models.BadmintonCourt, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	list := make([]*models.BadmintonCourt, 0, len(r.s.data.courts))
+	for _, court := range r.s.data.courts {
+		if !deleted(&court.BaseModel) {
+			copied := *court
+			list = append(list, &copied)
+		}
+	}
+	byCreation(list, func(court *models.BadmintonCourt) *models.BaseModel { return &court.BaseModel })
+	return list, nil
+}
+
+func (r *courts) FindByID(ctx context.Context, id string) (*models.BadmintonCourt, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	court, ok := r.s.data.courts[id]
+	if !ok || deleted(&court.BaseModel) {
+		return nil, repository.ErrNotFound
+	}
+	copied := *court
+	return &copied, nil
+}
+
+func (r *courts) Create(ctx context.Context, court *models.BadmintonCourt) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	created(&court.BaseModel)
+	copied := *court
+	r.s.data.courts[court.ID] = &copied
+	return nil
+}
+
+func (r *courts) Update(ctx context.Context, court *models.BadmintonCourt) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	current, ok := r.s.data.courts[court.ID]
+	if !ok {
+		return repository.ErrStale
+	}
+	if err := updated(&current.BaseModel, &court.BaseModel); err != nil {
+		return err
+	}
+	copied := *court
+	r.s.data.courts[court.ID] = &copied
+	return nil
+}
+
+func (r *courts) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	court, ok := r.s.data.courts[id]
+	if !ok || deleted(&court.BaseModel) {
+		return repository.ErrNotFound
+	}
+	markDeleted(&court.BaseModel)
+	return nil
+}
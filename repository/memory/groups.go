@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+type groups struct {
+	s *Store
+}
+
+func (r *groups) FindByID(ctx context.Context, id string) (*models.Group, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	group, ok := r.s.data.groups[id]
+	if !ok || deleted(&group.BaseModel) {
+		return nil, repository.ErrNotFound
+	}
+	return copyGroup(group), nil
+}
+
+func (r *groups) FindWithMembers(ctx context.Context, id string) (*models.Group, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	group, ok := r.s.data.groups[id]
+	if !ok || deleted(&group.BaseModel) {
+		return nil, repository.ErrNotFound
+	}
+	return r.withMembers(group), nil
+}
+
+// withMembers copies a group with its members and memberships, the lock must be held
+func (r *groups) withMembers(group *models.Group) *models.Group {
+	copied := copyGroup(group)
+	for userID, member := range r.s.data.members[group.ID] {
+		memberCopy := *member
+		copied.Memberships = append(copied.Memberships, &memberCopy)
+		if user, ok := r.s.data.users[userID]; ok && !deleted(&user.BaseModel) {
+			copied.Members = append(copied.Members, copyUser(user))
+		}
+	}
+	return copied
+}
+
+func (r *groups) FindIncludingDeleted(ctx context.Context, id string) (*models.Group, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	group, ok := r.s.data.groups[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return copyGroup(group), nil
+}
+
+func (r *groups) List(ctx context.Context, memberID string, offset int, limit int) ([]*models.Group, int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []*models.Group
+	for _, group := range r.s.data.groups {
+		if deleted(&group.BaseModel) {
+			continue
+		}
+		if len(memberID) > 0 && group.OwnerID != memberID {
+			if _, ok := r.s.data.members[group.ID][memberID]; !ok {
+				continue
+			}
+		}
+		list = append(list, r.withMembers(group))
+	}
+	byCreation(list, func(group *models.Group) *models.BaseModel { return &group.BaseModel })
+	return page(list, offset, limit), int64(len(list)), nil
+}
+
+func (r *groups) Create(ctx context.Context, group *models.Group) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	created(&group.BaseModel)
+	r.s.data.groups[group.ID] = copyGroup(group)
+	return nil
+}
+
+func (r *groups) Update(ctx context.Context, group *models.Group) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	current, ok := r.s.data.groups[group.ID]
+	if !ok {
+		return repository.ErrStale
+	}
+	if err := updated(&current.BaseModel, &group.BaseModel); err != nil {
+		return err
+	}
+	r.s.data.groups[group.ID] = copyGroup(group)
+	return nil
+}
+
+func (r *groups) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	group, ok := r.s.data.groups[id]
+	if !ok || deleted(&group.BaseModel) {
+		return repository.ErrNotFound
+	}
+	markDeleted(&group.BaseModel)
+	return nil
+}
+
+func (r *groups) MemberRole(ctx context.Context, groupID string, userID string) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	member, ok := r.s.data.members[groupID][userID]
+	if !ok {
+		return "", nil
+	}
+	return member.Role, nil
+}
+
+func (r *groups) AddMember(ctx context.Context, member *models.GroupMember) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.data.members[member.GroupID] == nil {
+		r.s.data.members[member.GroupID] = make(map[string]*models.GroupMember)
+	}
+	copied := *member
+	if len(copied.Role) == 0 {
+		copied.Role = models.GroupRoleMember
+	}
+	r.s.data.members[member.GroupID][member.UserID] = &copied
+	return nil
+}
+
+func (r *groups) UpdateMemberRole(ctx context.Context, groupID string, userID string, role string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	member, ok := r.s.data.members[groupID][userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	member.Role = role
+	return nil
+}
+
+func (r *groups) RemoveMember(ctx context.Context, groupID string, userID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.members[groupID][userID]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.s.data.members[groupID], userID)
+	return nil
+}
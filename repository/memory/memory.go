@@ -0,0 +1,271 @@
+// Package memory implements the repositories in memory, so handlers and services can be tested without a database
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store keeps the records in maps. Records are copied in and out, so callers never share them with the store.
+type Store struct {
+	mu   *sync.Mutex // Guards data
+	txMu *sync.Mutex // Serializes Atomic
+	data *data
+}
+
+type data struct {
+	users     map[string]*models.User
+	roles     map[string]*models.Role // By name
+	courts    map[string]*models.BadmintonCourt
+	sessions  map[string]*models.Session
+	attendees map[string]map[string]*models.SessionAttendee // By session then user
+	groups    map[string]*models.Group
+	members   map[string]map[string]*models.GroupMember        // By group then user
+	wallets   map[string]*models.GroupWallet                   // By group
+	balances  map[string]map[string]*models.GroupWalletBalance // By group then user
+	ledger    []*models.WalletTransaction
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{
+		mu:   &sync.Mutex{},
+		txMu: &sync.Mutex{},
+		data: &data{
+			users:     make(map[string]*models.User),
+			roles:     make(map[string]*models.Role),
+			courts:    make(map[string]*models.BadmintonCourt),
+			sessions:  make(map[string]*models.Session),
+			attendees: make(map[string]map[string]*models.SessionAttendee),
+			groups:    make(map[string]*models.Group),
+			members:   make(map[string]map[string]*models.GroupMember),
+			wallets:   make(map[string]*models.GroupWallet),
+			balances:  make(map[string]map[string]*models.GroupWalletBalance),
+		},
+	}
+}
+
+func (s *Store) Users() repository.UserRepository {
+	return &users{s}
+}
+
+func (s *Store) Sessions() repository.SessionRepository {
+	return &sessions{s}
+}
+
+func (s *Store) Groups() repository.GroupRepository {
+	return &groups{s}
+}
+
+func (s *Store) Courts() repository.CourtRepository {
+	return &courts{s}
+}
+
+// Atomic runs fn while no other Atomic call runs, and restores the records when fn fails
+func (s *Store) Wallets() repository.WalletRepository {
+	return &wallets{s}
+}
+
+func (s *Store) Atomic(ctx context.Context, fn func(store repository.Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	saved := s.data.clone()
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.data = saved
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// AddUser adds a user with roles, named after models.UserRole*, and returns it. Roles not added yet are added
+// without permissions.
+func (s *Store) AddUser(user *models.User, roles ...string) *models.User {
+	if len(user.ID) == 0 {
+		user.ID = uuid.NewString()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range roles {
+		role, ok := s.data.roles[name]
+		if !ok {
+			role = &models.Role{BaseModel: models.BaseModel{ID: uuid.NewString()}, Name: name}
+			s.data.roles[name] = role
+		}
+		copied := *role
+		user.Roles = append(user.Roles, &copied)
+	}
+	s.data.users[user.ID] = copyUser(user)
+	return user
+}
+
+// AddRole adds a role granting the permissions, and returns it
+func (s *Store) AddRole(role *models.Role, permissions ...string) *models.Role {
+	if len(role.ID) == 0 {
+		role.ID = uuid.NewString()
+	}
+	for _, permission := range permissions {
+		role.Permissions = append(role.Permissions, &models.Permission{Name: permission})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *role
+	s.data.roles[role.Name] = &copied
+	return role
+}
+
+func (d *data) clone() *data {
+	c := &data{
+		users:     make(map[string]*models.User, len(d.users)),
+		roles:     make(map[string]*models.Role, len(d.roles)),
+		courts:    make(map[string]*models.BadmintonCourt, len(d.courts)),
+		sessions:  make(map[string]*models.Session, len(d.sessions)),
+		attendees: make(map[string]map[string]*models.SessionAttendee, len(d.attendees)),
+		groups:    make(map[string]*models.Group, len(d.groups)),
+		members:   make(map[string]map[string]*models.GroupMember, len(d.members)),
+		wallets:   make(map[string]*models.GroupWallet, len(d.wallets)),
+		balances:  make(map[string]map[string]*models.GroupWalletBalance, len(d.balances)),
+		ledger:    make([]*models.WalletTransaction, 0, len(d.ledger)),
+	}
+	for id, user := range d.users {
+		c.users[id] = copyUser(user)
+	}
+	for name, role := range d.roles {
+		copied := *role
+		c.roles[name] = &copied
+	}
+	for id, court := range d.courts {
+		copied := *court
+		c.courts[id] = &copied
+	}
+	for id, session := range d.sessions {
+		c.sessions[id] = copySession(session)
+	}
+	for sessionID, byUser := range d.attendees {
+		c.attendees[sessionID] = make(map[string]*models.SessionAttendee, len(byUser))
+		for userID, attendee := range byUser {
+			copied := *attendee
+			c.attendees[sessionID][userID] = &copied
+		}
+	}
+	for id, group := range d.groups {
+		c.groups[id] = copyGroup(group)
+	}
+	for groupID, byUser := range d.members {
+		c.members[groupID] = make(map[string]*models.GroupMember, len(byUser))
+		for userID, member := range byUser {
+			copied := *member
+			c.members[groupID][userID] = &copied
+		}
+	}
+	for groupID, wallet := range d.wallets {
+		copied := *wallet
+		c.wallets[groupID] = &copied
+	}
+	for groupID, byUser := range d.balances {
+		c.balances[groupID] = make(map[string]*models.GroupWalletBalance, len(byUser))
+		for userID, balance := range byUser {
+			copied := *balance
+			c.balances[groupID][userID] = &copied
+		}
+	}
+	for _, transaction := range d.ledger {
+		copied := *transaction
+		c.ledger = append(c.ledger, &copied)
+	}
+	return c
+}
+
+// created sets the ID, timestamps and version of a new record
+func created(base *models.BaseModel) {
+	if len(base.ID) == 0 {
+		base.ID = uuid.NewString()
+	}
+	now := time.Now()
+	base.CreatedAt = now
+	base.UpdatedAt = now
+	base.Version = 1
+}
+
+// updated moves a record saved at the version of current to the next version, failing with ErrStale when current
+// is at another version or was deleted
+func updated(current *models.BaseModel, base *models.BaseModel) error {
+	if deleted(current) || current.Version != base.Version {
+		return repository.ErrStale
+	}
+	base.Version++
+	base.UpdatedAt = time.Now()
+	return nil
+}
+
+func deleted(base *models.BaseModel) bool {
+	return base.DeletedAt.Valid
+}
+
+func markDeleted(base *models.BaseModel) {
+	base.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	copied.Roles = make([]*models.Role, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		r := *role
+		copied.Roles = append(copied.Roles, &r)
+	}
+	copied.Identities = nil
+	return &copied
+}
+
+func copySession(session *models.Session) *models.Session {
+	copied := *session
+	copied.Group = nil
+	copied.BadmintonCourt = nil
+	copied.Attendees = nil
+	return &copied
+}
+
+func copyGroup(group *models.Group) *models.Group {
+	copied := *group
+	copied.Members = nil
+	copied.Memberships = nil
+	copied.Sessions = nil
+	return &copied
+}
+
+// page returns the records of a page
+func page[T any](records []T, offset int, limit int) []T {
+	if offset >= len(records) {
+		return []T{}
+	}
+	end := len(records)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return records[offset:end]
+}
+
+// byCreation orders records oldest first, as ties in the database come back in insertion order
+func byCreation[T any](records []T, base func(T) *models.BaseModel) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := base(records[i]), base(records[j])
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.ID < b.ID
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+}
@@ -0,0 +1,235 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+type sessions struct {
+	s *Store
+}
+
+func (r *sessions) FindByID(ctx context.Context, id string) (*models.Session, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.data.sessions[id]
+	if !ok || deleted(&session.BaseModel) {
+		return nil, repository.ErrNotFound
+	}
+	return copySession(session), nil
+}
+
+// FindForUpdate returns a session like FindByID, as Atomic calls already run one after the other
+func (r *sessions) FindForUpdate(ctx context.Context, id string) (*models.Session, error) {
+	return r.FindByID(ctx, id)
+}
+
+func (r *sessions) FindWithDetails(ctx context.Context, id string) (*models.Session, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.data.sessions[id]
+	if !ok || deleted(&session.BaseModel) {
+		return nil, repository.ErrNotFound
+	}
+	return r.details(session), nil
+}
+
+// details copies a session with its group, court and attendees, the lock must be held
+func (r *sessions) details(session *models.Session) *models.Session {
+	copied := copySession(session)
+
+	if session.GroupID != nil {
+		if group, ok := r.s.data.groups[*session.GroupID]; ok && !deleted(&group.BaseModel) {
+			copied.Group = copyGroup(group)
+		}
+	}
+	if session.BadmintonCourtID != nil {
+		if court, ok := r.s.data.courts[*session.BadmintonCourtID]; ok && !deleted(&court.BaseModel) {
+			courtCopy := *court
+			copied.BadmintonCourt = &courtCopy
+		}
+	}
+	if creator, ok := r.s.data.users[session.CreatedBy]; ok {
+		copied.CreatedByName = creator.Name
+	}
+
+	for _, attendee := range r.s.data.attendees[session.ID] {
+		attendeeCopy := *attendee
+		if user, ok := r.s.data.users[attendee.UserID]; ok && !deleted(&user.BaseModel) {
+			attendeeCopy.User = copyUser(user)
+		}
+		copied.Attendees = append(copied.Attendees, &attendeeCopy)
+	}
+	return copied
+}
+
+func (r *sessions) List(ctx context.Context, filter repository.SessionFilter, offset int, limit int) ([]*models.Session, int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []*models.Session
+	for _, session := range r.s.data.sessions {
+		if deleted(&session.BaseModel) || session.DateTime == nil || !session.DateTime.After(filter.After) {
+			continue
+		}
+		if len(filter.VisibleTo) > 0 && session.GroupID != nil {
+			if _, ok := r.s.data.members[*session.GroupID][filter.VisibleTo]; !ok {
+				continue
+			}
+		}
+		list = append(list, r.details(session))
+	}
+	byCreation(list, func(session *models.Session) *models.BaseModel { return &session.BaseModel })
+	return page(list, offset, limit), int64(len(list)), nil
+}
+
+func (r *sessions) Create(ctx context.Context, session *models.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	created(&session.BaseModel)
+	r.s.data.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+func (r *sessions) Update(ctx context.Context, session *models.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	current, ok := r.s.data.sessions[session.ID]
+	if !ok {
+		return repository.ErrStale
+	}
+	if err := updated(&current.BaseModel, &session.BaseModel); err != nil {
+		return err
+	}
+	r.s.data.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+func (r *sessions) Delete(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.data.sessions[id]
+	if !ok || deleted(&session.BaseModel) {
+		return repository.ErrNotFound
+	}
+	markDeleted(&session.BaseModel)
+	return nil
+}
+
+func (r *sessions) FindAttendee(ctx context.Context, sessionID string, userID string) (*models.SessionAttendee, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	attendee, ok := r.s.data.attendees[sessionID][userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *attendee
+	return &copied, nil
+}
+
+func (r *sessions) ApprovedSlots(ctx context.Context, sessionID string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	slots := 0
+	for _, attendee := range r.s.data.attendees[sessionID] {
+		if attendee.Status == models.ApprovalStatusApproved {
+			slots += attendee.Slot
+		}
+	}
+	return slots, nil
+}
+
+func (r *sessions) ApprovedAttendees(ctx context.Context, sessionID string) ([]*models.SessionAttendee, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	attendees := make([]*models.SessionAttendee, 0)
+	for _, attendee := range r.s.data.attendees[sessionID] {
+		if attendee.Status == models.ApprovalStatusApproved {
+			copied := *attendee
+			attendees = append(attendees, &copied)
+		}
+	}
+	sort.Slice(attendees, func(i, j int) bool {
+		return attendees[i].UserID < attendees[j].UserID
+	})
+	return attendees, nil
+}
+
+func (r *sessions) AddAttendee(ctx context.Context, attendee *models.SessionAttendee) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.data.attendees[attendee.SessionID] == nil {
+		r.s.data.attendees[attendee.SessionID] = make(map[string]*models.SessionAttendee)
+	}
+	copied := *attendee
+	copied.User = nil
+	r.s.data.attendees[attendee.SessionID][attendee.UserID] = &copied
+	r.attendeesChanged(attendee.SessionID)
+	return nil
+}
+
+func (r *sessions) UpdateAttendee(ctx context.Context, attendee *models.SessionAttendee) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	existing, ok := r.s.data.attendees[attendee.SessionID][attendee.UserID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	existing.Slot = attendee.Slot
+	existing.Status = attendee.Status
+	existing.Remark = attendee.Remark
+	r.attendeesChanged(attendee.SessionID)
+	return nil
+}
+
+func (r *sessions) RemoveAttendee(ctx context.Context, sessionID string, userID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.attendees[sessionID][userID]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.s.data.attendees[sessionID], userID)
+	r.attendeesChanged(sessionID)
+	return nil
+}
+
+func (r *sessions) RemoveGroupAttendances(ctx context.Context, groupID string, userID string, after time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, session := range r.s.data.sessions {
+		if session.GroupID == nil || *session.GroupID != groupID || session.Status != models.SessionStatusOpen {
+			continue
+		}
+		if session.DateTime == nil || !session.DateTime.After(after) || deleted(&session.BaseModel) {
+			continue
+		}
+		if _, ok := r.s.data.attendees[session.ID][userID]; ok {
+			delete(r.s.data.attendees[session.ID], userID)
+			r.attendeesChanged(session.ID)
+		}
+	}
+	return nil
+}
+
+// attendeesChanged moves a session to its next version as its attendees changed, the lock must be held
+func (r *sessions) attendeesChanged(sessionID string) {
+	if session, ok := r.s.data.sessions[sessionID]; ok {
+		session.Version++
+	}
+}
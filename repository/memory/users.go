@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+type users struct {
+	s *Store
+}
+
+func (r *users) FindByID(ctx context.Context, id string) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.data.users[id]
+	if !ok || deleted(&user.BaseModel) {
+		return nil, repository.ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (r *users) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.data.users {
+		if user.Email == email && !deleted(&user.BaseModel) {
+			return copyUser(user), nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *users) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.data.users[userID]
+	if !ok {
+		return false, nil
+	}
+	for _, role := range user.Roles {
+		if role.Name == models.UserRoleAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *users) List(ctx context.Context, offset int, limit int) ([]*models.User, int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	list := make([]*models.User, 0, len(r.s.data.users))
+	for _, user := range r.s.data.users {
+		if !deleted(&user.BaseModel) {
+			list = append(list, copyUser(user))
+		}
+	}
+	byCreation(list, func(user *models.User) *models.BaseModel { return &user.BaseModel })
+	return page(list, offset, limit), int64(len(list)), nil
+}
+
+func (r *users) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	created(&user.BaseModel)
+	r.s.data.users[user.ID] = copyUser(user)
+	return nil
+}
+
+func (r *users) Update(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	current, ok := r.s.data.users[user.ID]
+	if !ok {
+		return repository.ErrStale
+	}
+	if err := updated(&current.BaseModel, &user.BaseModel); err != nil {
+		return err
+	}
+	copied := copyUser(user)
+	copied.Roles = current.Roles
+	r.s.data.users[user.ID] = copied
+	return nil
+}
+
+func (r *users) FindRole(ctx context.Context, name string) (*models.Role, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	role, ok := r.s.data.roles[name]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *role
+	return &copied, nil
+}
+
+func (r *users) ReplaceRoles(ctx context.Context, userID string, roles []*models.Role) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.data.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	user.Roles = make([]*models.Role, 0, len(roles))
+	for _, role := range roles {
+		copied := *role
+		user.Roles = append(user.Roles, &copied)
+	}
+	user.PermissionVersion++
+	return nil
+}
+
+func (r *users) Permissions(ctx context.Context, userID string) ([]string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	permissions := make([]string, 0)
+	user, ok := r.s.data.users[userID]
+	if !ok {
+		return permissions, nil
+	}
+	for _, held := range user.Roles {
+		role, ok := r.s.data.roles[held.Name]
+		if !ok {
+			continue
+		}
+		for _, permission := range role.Permissions {
+			permissions = append(permissions, permission.Name)
+		}
+	}
+	return permissions, nil
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/shopspring/decimal"
+)
+
+// wallets are locked by Atomic, which already runs one call at a time
+type wallets struct {
+	s *Store
+}
+
+func (r *wallets) Lock(ctx context.Context, groupID string) (*models.GroupWallet, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	wallet, ok := r.s.data.wallets[groupID]
+	if !ok {
+		wallet = &models.GroupWallet{GroupID: groupID}
+		created(&wallet.BaseModel)
+		r.s.data.wallets[groupID] = wallet
+	}
+	copied := *wallet
+	return &copied, nil
+}
+
+func (r *wallets) UpdateBalance(ctx context.Context, wallet *models.GroupWallet) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	current, ok := r.s.data.wallets[wallet.GroupID]
+	if !ok {
+		return nil
+	}
+	current.Balance = wallet.Balance
+	current.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *wallets) AdjustMemberBalance(ctx context.Context, groupID string, userID string, amount decimal.Decimal) (decimal.Decimal, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.data.balances[groupID] == nil {
+		r.s.data.balances[groupID] = make(map[string]*models.GroupWalletBalance)
+	}
+	balance, ok := r.s.data.balances[groupID][userID]
+	if !ok {
+		balance = &models.GroupWalletBalance{GroupID: groupID, UserID: userID}
+		r.s.data.balances[groupID][userID] = balance
+	}
+	balance.Balance = balance.Balance.Add(amount)
+	balance.UpdatedAt = time.Now()
+	return balance.Balance, nil
+}
+
+func (r *wallets) AddTransaction(ctx context.Context, transaction *models.WalletTransaction) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	created(&transaction.BaseModel)
+	copied := *transaction
+	r.s.data.ledger = append(r.s.data.ledger, &copied)
+	return nil
+}
+
+func (r *wallets) SessionDebited(ctx context.Context, sessionID string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, transaction := range r.s.data.ledger {
+		if transaction.Type == models.WalletTransactionSessionDebit && transaction.SessionID != nil && *transaction.SessionID == sessionID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
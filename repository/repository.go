@@ -0,0 +1,135 @@
+// Package repository hides how users, sessions, groups and courts are stored behind interfaces,
+// implemented with GORM for Postgres and in memory for tests.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/shopspring/decimal"
+)
+
+// ErrNotFound is returned when the record looked up or changed does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrStale is returned when a record is updated at a version it is no longer at, as it changed since it was read
+var ErrStale = errors.New("record changed since it was read")
+
+// Store gives access to the repositories
+type Store interface {
+	Users() UserRepository
+	Sessions() SessionRepository
+	Groups() GroupRepository
+	Courts() CourtRepository
+	Wallets() WalletRepository
+
+	// Atomic runs fn with repositories bound to a single transaction, which is rolled back when fn fails
+	Atomic(ctx context.Context, fn func(store Store) error) error
+}
+
+// UserRepository stores users and the roles they hold
+type UserRepository interface {
+	// FindByID returns a user with their roles
+	FindByID(ctx context.Context, id string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	IsAdmin(ctx context.Context, userID string) (bool, error)
+	// List returns a page of users with their roles, and the total number of users
+	List(ctx context.Context, offset int, limit int) ([]*models.User, int64, error)
+	Create(ctx context.Context, user *models.User) error
+	// Update saves a user without their roles at the version it was read and moves it to the next version, failing
+	// with ErrStale when it changed since
+	Update(ctx context.Context, user *models.User) error
+
+	// FindRole returns the role with a name
+	FindRole(ctx context.Context, name string) (*models.Role, error)
+	// ReplaceRoles gives a user the roles, and refuses the access tokens carrying their previous ones
+	ReplaceRoles(ctx context.Context, userID string, roles []*models.Role) error
+	// Permissions returns the names of the permissions the roles of a user grant
+	Permissions(ctx context.Context, userID string) ([]string, error)
+}
+
+// CourtRepository stores badminton courts
+type CourtRepository interface {
+	List(ctx context.Context) ([]*models.BadmintonCourt, error)
+	FindByID(ctx context.Context, id string) (*models.BadmintonCourt, error)
+	Create(ctx context.Context, court *models.BadmintonCourt) error
+	// Update saves a court at the version it was read and moves it to the next version, failing with ErrStale
+	// when it changed since
+	Update(ctx context.Context, court *models.BadmintonCourt) error
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionFilter selects the sessions listed
+type SessionFilter struct {
+	After     time.Time // Only sessions taking place after this time
+	VisibleTo string    // Only public sessions and sessions of the groups of this user, every session when empty
+}
+
+// SessionRepository stores sessions and their attendees
+type SessionRepository interface {
+	FindByID(ctx context.Context, id string) (*models.Session, error)
+	// FindForUpdate returns a session and locks it until the end of the Atomic call it is made in, so the slots of
+	// the session are reserved one after the other
+	FindForUpdate(ctx context.Context, id string) (*models.Session, error)
+	// FindWithDetails returns a session with its group, court and attendees with their users
+	FindWithDetails(ctx context.Context, id string) (*models.Session, error)
+	// List returns a page of sessions with their creator name, group, court and attendees, and the total number of sessions
+	List(ctx context.Context, filter SessionFilter, offset int, limit int) ([]*models.Session, int64, error)
+	Create(ctx context.Context, session *models.Session) error
+	// Update saves a session at the version it was read and moves it to the next version, failing with ErrStale
+	// when it changed since
+	Update(ctx context.Context, session *models.Session) error
+	Delete(ctx context.Context, id string) error
+
+	FindAttendee(ctx context.Context, sessionID string, userID string) (*models.SessionAttendee, error)
+	// ApprovedSlots returns the number of slots taken by the approved attendees of a session
+	ApprovedSlots(ctx context.Context, sessionID string) (int, error)
+	// ApprovedAttendees returns the approved attendees of a session ordered by user ID
+	ApprovedAttendees(ctx context.Context, sessionID string) ([]*models.SessionAttendee, error)
+
+	// The attendees are part of a session, changing them moves the session to its next version
+	AddAttendee(ctx context.Context, attendee *models.SessionAttendee) error
+	UpdateAttendee(ctx context.Context, attendee *models.SessionAttendee) error
+	RemoveAttendee(ctx context.Context, sessionID string, userID string) error
+	// RemoveGroupAttendances removes a user from the open sessions of a group taking place after a time
+	RemoveGroupAttendances(ctx context.Context, groupID string, userID string, after time.Time) error
+}
+
+// GroupRepository stores groups and their members
+type GroupRepository interface {
+	FindByID(ctx context.Context, id string) (*models.Group, error)
+	// FindWithMembers returns a group with its members and their memberships
+	FindWithMembers(ctx context.Context, id string) (*models.Group, error)
+	// FindIncludingDeleted returns a group even when it was deleted, as its sessions are still decided by it
+	FindIncludingDeleted(ctx context.Context, id string) (*models.Group, error)
+	// List returns a page of groups with their members, only those of a member unless memberID is empty,
+	// and the total number of groups
+	List(ctx context.Context, memberID string, offset int, limit int) ([]*models.Group, int64, error)
+	Create(ctx context.Context, group *models.Group) error
+	// Update saves a group at the version it was read and moves it to the next version, failing with ErrStale
+	// when it changed since
+	Update(ctx context.Context, group *models.Group) error
+	Delete(ctx context.Context, id string) error
+
+	// MemberRole returns the role of a user in a group, or an empty string if the user is not a member
+	MemberRole(ctx context.Context, groupID string, userID string) (string, error)
+	AddMember(ctx context.Context, member *models.GroupMember) error
+	UpdateMemberRole(ctx context.Context, groupID string, userID string, role string) error
+	RemoveMember(ctx context.Context, groupID string, userID string) error
+}
+
+// WalletRepository stores the wallets of groups, the credit of their members and their history
+type WalletRepository interface {
+	// Lock returns the wallet of a group, created on first use, and locks it until the end of the Atomic call it is
+	// made in. Every change to a group wallet goes through this lock, which serializes them.
+	Lock(ctx context.Context, groupID string) (*models.GroupWallet, error)
+	// UpdateBalance saves the pool balance of a locked wallet
+	UpdateBalance(ctx context.Context, wallet *models.GroupWallet) error
+	// AdjustMemberBalance adds an amount to the credit of a member and returns the new balance, the wallet must be locked
+	AdjustMemberBalance(ctx context.Context, groupID string, userID string, amount decimal.Decimal) (decimal.Decimal, error)
+	AddTransaction(ctx context.Context, transaction *models.WalletTransaction) error
+	// SessionDebited tells whether a session was already paid for out of its group wallet
+	SessionDebited(ctx context.Context, sessionID string) (bool, error)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/auth"
+	"github.com/alanrb/badminton/backend/handlers"
+	"github.com/alanrb/badminton/backend/middleware"
+	"github.com/alanrb/badminton/backend/rbac"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/alanrb/badminton/backend/service"
+	"github.com/alanrb/badminton/backend/validate"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+)
+
+// serverConfig is what the API server is built from
+type serverConfig struct {
+	DB        *gorm.DB
+	JWTSecret []byte
+	CMSURL    string // Where users are sent back to after logging in
+	Providers map[string]auth.IdentityProvider
+
+	// Cognito tokens are accepted instead of the JWTs issued by the server when an issuer is set
+	CognitoIssuer    string
+	CognitoClientIDs []string
+
+	Debug bool
+}
+
+// newServer creates the Echo app with its middleware and routes.
+// Handlers not yet moved to the services still use database.DB, which must be the same database.
+func newServer(cfg serverConfig) *echo.Echo {
+	// Handlers reach the data through the services, which enforce the business rules
+	store := repository.NewStore(cfg.DB)
+	sessionHandler := handlers.NewSessionHandler(service.NewSessionService(store))
+	groupHandler := handlers.NewGroupHandler(service.NewGroupService(store))
+	courtHandler := handlers.NewCourtHandler(service.NewCourtService(store))
+	userHandler := handlers.NewUserHandler(service.NewUserService(store))
+
+	// Create Echo instance
+	e := echo.New()
+	e.Server.ReadHeaderTimeout = time.Duration(10) * time.Second
+	e.Server.ReadTimeout = time.Duration(30) * time.Second
+	e.Server.WriteTimeout = time.Duration(60) * time.Second
+	e.Debug = cfg.Debug
+	e.HTTPErrorHandler = apperror.Handler
+	e.Validator = validate.Validator{}
+
+	// Middleware
+	e.Use(echomiddleware.ContextTimeoutWithConfig(echomiddleware.ContextTimeoutConfig{
+		Timeout: 29 * time.Second,
+	}))
+	e.Use(echomiddleware.RequestID())
+	e.Use(middleware.Logger())
+	e.Use(echomiddleware.Recover())
+	e.Use(middleware.CORS())
+	e.Use(middleware.Context)
+
+	// Public routes
+	e.GET("/auth/providers", func(c echo.Context) error {
+		return handlers.ListIdentityProviders(c, cfg.Providers)
+	})
+	e.GET("/auth/:provider/login", func(c echo.Context) error {
+		return handlers.HandleLogin(c, cfg.JWTSecret, cfg.CMSURL, cfg.Providers)
+	})
+	e.GET("/auth/:provider/callback", func(c echo.Context) error {
+		return handlers.HandleCallback(c, cfg.JWTSecret, cfg.CMSURL, cfg.Providers)
+	})
+	e.POST("/auth/token", func(c echo.Context) error {
+		return handlers.ExchangeLoginCode(c, cfg.JWTSecret)
+	})
+	e.POST("/auth/refresh", func(c echo.Context) error {
+		return handlers.RefreshTokens(c, cfg.JWTSecret)
+	})
+
+	// Protected routes
+	var protected *echo.Group
+	if len(cfg.CognitoIssuer) == 0 {
+		// If Cognito is not used, use JWT middleware
+		protected = e.Group("/api", middleware.APIKey(cfg.DB, middleware.JWTConfig(cfg.JWTSecret, cfg.DB)), middleware.Audit(cfg.DB))
+		protected.POST("/auth/logout", handlers.Logout, middleware.NoAPIKey)
+		protected.POST("/auth/logout-all", handlers.LogoutEverywhere, middleware.NoAPIKey, middleware.NoImpersonation)
+		protected.DELETE("/auth/impersonation", handlers.EndImpersonation)
+	} else {
+		// If Cognito is used, use Cognito middleware
+		verifier := auth.NewCognitoVerifier(cfg.CognitoIssuer, cfg.CognitoClientIDs)
+		protected = e.Group("/api", middleware.APIKey(cfg.DB, middleware.Cognito(verifier, cfg.DB)), middleware.Audit(cfg.DB))
+		protected.PUT("/auth/cognito", handlers.HandleCognitoUser, middleware.NoAPIKey)
+	}
+
+	protected.POST("/sessions", sessionHandler.CreateSession, middleware.RBAC(cfg.DB, string(rbac.PermissionCreateSessions)))
+	protected.GET("/sessions", sessionHandler.GetSessions, middleware.Scope(string(rbac.PermissionListSessions)))
+	protected.GET("/sessions/:session_id", sessionHandler.GetSessionDetails, middleware.Scope(string(rbac.PermissionListSessions)))
+	protected.PUT("/sessions/:session_id", sessionHandler.UpdateSession, middleware.RBAC(cfg.DB, string(rbac.PermissionCreateSessions)))
+	protected.PATCH("/sessions/:session_id", sessionHandler.PatchSession, middleware.RBAC(cfg.DB, string(rbac.PermissionCreateSessions)))
+	protected.DELETE("/sessions/:session_id", sessionHandler.DeleteSession, middleware.RBAC(cfg.DB, string(rbac.PermissionDeleteSessions)))
+	protected.DELETE("/sessions/:session_id/attend", sessionHandler.CancelAttendance, middleware.Scope(string(rbac.PermissionEditSessions)))
+	protected.POST("/sessions/:session_id/attend", sessionHandler.AttendSession, middleware.Scope(string(rbac.PermissionEditSessions)))
+	protected.PUT("/sessions/:session_id/attendees/:user_id", sessionHandler.UpdateAttendeeStatus, middleware.Scope(string(rbac.PermissionEditSessions)))
+	protected.GET("/sessions/:session_id/comments", handlers.ListSessionComments, middleware.Scope(string(rbac.PermissionListSessions)))
+	protected.POST("/sessions/:session_id/comments", handlers.CreateSessionComment, middleware.Scope(string(rbac.PermissionEditSessions)))
+	protected.PUT("/sessions/:session_id/comments/:comment_id", handlers.UpdateSessionComment, middleware.Scope(string(rbac.PermissionEditSessions)))
+	protected.DELETE("/sessions/:session_id/comments/:comment_id", handlers.DeleteSessionComment, middleware.Scope(string(rbac.PermissionEditSessions)))
+
+	protected.GET("/profile", userHandler.GetProfile)
+
+	protected.GET("/api-keys", handlers.ListAPIKeys, middleware.NoAPIKey, middleware.NoImpersonation)
+	protected.POST("/api-keys", handlers.CreateAPIKey, middleware.NoAPIKey, middleware.NoImpersonation)
+	protected.POST("/api-keys/:key_id/issue", handlers.IssueAPIKey, middleware.NoAPIKey, middleware.NoImpersonation)
+	protected.DELETE("/api-keys/:key_id", handlers.RevokeAPIKey, middleware.NoAPIKey, middleware.NoImpersonation)
+
+	protected.GET("/users/attended-sessions", handlers.GetAttendedSessions, middleware.Scope(string(rbac.PermissionListSessions)))
+
+	protected.GET("/groups", groupHandler.ListGroups, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.POST("/groups", groupHandler.CreateGroup, middleware.RBAC(cfg.DB, string(rbac.PermissionCreateGroups)))
+	protected.POST("/groups/:group_id/players", groupHandler.AddPlayerToGroup, middleware.Scope(string(rbac.PermissionAddGroupPlayer)))
+	protected.DELETE("/groups/:group_id", groupHandler.DeleteGroup, middleware.NoImpersonation, middleware.RBAC(cfg.DB, string(rbac.PermissionDeleteGroups)))
+	protected.GET("/groups/:group_id", groupHandler.GetGroupDetails, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.PUT("/groups/:group_id", groupHandler.UpdateGroup, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.PATCH("/groups/:group_id", groupHandler.PatchGroup, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.PUT("/groups/:group_id/owner", groupHandler.TransferGroupOwnership, middleware.NoImpersonation, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.DELETE("/groups/:group_id/members/:user_id", groupHandler.RemoveGroupMember, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.PUT("/groups/:group_id/members/:user_id/role", groupHandler.UpdateGroupMemberRole, middleware.NoImpersonation, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.POST("/groups/:group_id/leave", groupHandler.LeaveGroup, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.GET("/groups/:group_id/announcements", handlers.ListGroupAnnouncements, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.POST("/groups/:group_id/announcements", handlers.CreateGroupAnnouncement, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.PUT("/groups/:group_id/announcements/:announcement_id", handlers.UpdateGroupAnnouncement, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.DELETE("/groups/:group_id/announcements/:announcement_id", handlers.DeleteGroupAnnouncement, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.GET("/groups/:group_id/wallet", handlers.GetGroupWallet, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.PUT("/groups/:group_id/wallet", handlers.UpdateGroupWallet, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.POST("/groups/:group_id/wallet/top-ups", handlers.TopUpGroupWallet, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.GET("/groups/:group_id/wallet/transactions", handlers.ListWalletTransactions, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.GET("/groups/:group_id/wallet/report", handlers.GetLowBalanceReport, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.GET("/groups/directory", handlers.ListGroupDirectory, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.POST("/groups/:group_id/join", handlers.JoinGroup, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.DELETE("/groups/:group_id/join", handlers.CancelJoinRequest, middleware.Scope(string(rbac.PermissionEditGroups)))
+	protected.GET("/groups/:group_id/join-requests", handlers.ListGroupJoinRequests, middleware.Scope(string(rbac.PermissionListGroups)))
+	protected.PUT("/groups/:group_id/join-requests/:request_id", handlers.ReviewGroupJoinRequest, middleware.Scope(string(rbac.PermissionEditGroups)))
+
+	protected.GET("/courts", courtHandler.GetBadmintonCourts, middleware.Scope(string(rbac.PermissionListCourts)))
+	protected.GET("/courts/:id", courtHandler.GetBadmintonCourt, middleware.Scope(string(rbac.PermissionListCourts)))
+
+	// Admin routes (only accessible to admins)
+	adminGroup := protected.Group("/admin", middleware.AdminOnly, middleware.NoImpersonation)
+	adminGroup.POST("/users", userHandler.CreateUser, middleware.RBAC(cfg.DB, string(rbac.PermissionListUsers)))
+	adminGroup.GET("/users/:user_id", userHandler.GetUser, middleware.RBAC(cfg.DB, string(rbac.PermissionEditUsers)))
+	adminGroup.GET("/users", userHandler.GetUsers, middleware.RBAC(cfg.DB, string(rbac.PermissionListUsers)))
+	adminGroup.PUT("/users/:user_id", userHandler.UpdateUser, middleware.RBAC(cfg.DB, string(rbac.PermissionEditUsers)))
+	adminGroup.PATCH("/users/:user_id", userHandler.PatchUser, middleware.RBAC(cfg.DB, string(rbac.PermissionEditUsers)))
+	adminGroup.POST("/users/:user_id/api-keys", handlers.CreateUserAPIKey, middleware.NoAPIKey, middleware.NoImpersonation, middleware.RBAC(cfg.DB, string(rbac.PermissionEditUsers)))
+	adminGroup.GET("/impersonations", handlers.ListImpersonations, middleware.RBAC(cfg.DB, string(rbac.PermissionListUsers)))
+	adminGroup.GET("/audit-logs", handlers.ListAuditLogs, middleware.RBAC(cfg.DB, string(rbac.PermissionViewAuditLog)))
+	adminGroup.GET("/api-keys", handlers.ListAllAPIKeys, middleware.NoAPIKey, middleware.RBAC(cfg.DB, string(rbac.PermissionListUsers)))
+	adminGroup.DELETE("/api-keys/:key_id", handlers.RevokeAPIKey, middleware.NoAPIKey, middleware.RBAC(cfg.DB, string(rbac.PermissionEditUsers)))
+
+	if len(cfg.CognitoIssuer) == 0 {
+		// Impersonation tokens are only accepted by the JWT middleware
+		adminGroup.POST("/users/:user_id/impersonate", func(c echo.Context) error {
+			return handlers.StartImpersonation(c, cfg.JWTSecret)
+		}, middleware.NoAPIKey, middleware.RBAC(cfg.DB, string(rbac.PermissionImpersonateUsers)))
+	}
+
+	adminGroup.GET("/roles", handlers.ListRoles, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.POST("/roles", handlers.CreateRole, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.GET("/roles/:role_id", handlers.GetRole, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.PUT("/roles/:role_id", handlers.UpdateRole, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.DELETE("/roles/:role_id", handlers.DeleteRole, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.PUT("/roles/:role_id/permissions/:permission", handlers.GrantRolePermission, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.DELETE("/roles/:role_id/permissions/:permission", handlers.RevokeRolePermission, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.GET("/roles/:role_id/users", handlers.ListRoleUsers, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+	adminGroup.GET("/permissions", handlers.ListAllPermissions, middleware.RBAC(cfg.DB, string(rbac.PermissionManageRoles)))
+
+	adminGroup.POST("/sessions", sessionHandler.CreateSession, middleware.RBAC(cfg.DB, string(rbac.PermissionCreateSessions)))
+	adminGroup.PUT("/sessions/:session_id/status", sessionHandler.UpdateSessionStatus, middleware.RBAC(cfg.DB, string(rbac.PermissionCreateSessions)))
+	adminGroup.DELETE("/sessions/:session_id", sessionHandler.DeleteSession, middleware.RBAC(cfg.DB, string(rbac.PermissionDeleteSessions)))
+
+	adminGroup.POST("/courts", courtHandler.CreateBadmintonCourt, middleware.RBAC(cfg.DB, string(rbac.PermissionCreateCourts)))
+	adminGroup.PUT("/courts/:id", courtHandler.UpdateBadmintonCourt, middleware.RBAC(cfg.DB, string(rbac.PermissionEditCourts)))
+	adminGroup.PATCH("/courts/:id", courtHandler.PatchBadmintonCourt, middleware.RBAC(cfg.DB, string(rbac.PermissionEditCourts)))
+	adminGroup.DELETE("/courts/:id", courtHandler.DeleteBadmintonCourt, middleware.RBAC(cfg.DB, string(rbac.PermissionDeleteCourts)))
+
+	return e
+}
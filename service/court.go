@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	courtForbidden = "Only admins can manage courts"
+	courtChanged   = "Court changed since it was fetched"
+)
+
+// CourtService manages badminton courts, which only admins may change
+type CourtService struct {
+	store repository.Store
+}
+
+func NewCourtService(store repository.Store) *CourtService {
+	return &CourtService{store: store}
+}
+
+// CourtChanges are the fields of a court that can be updated, the map URL is kept when nil
+type CourtChanges struct {
+	Name                 string
+	Address              string
+	GoogleMapURL         *string
+	EstimatePricePerHour decimal.Decimal
+	Contact              string
+}
+
+func (s *CourtService) List(ctx context.Context) ([]*models.BadmintonCourt, error) {
+	return s.store.Courts().List(ctx)
+}
+
+func (s *CourtService) Get(ctx context.Context, id string) (*models.BadmintonCourt, error) {
+	court, err := s.store.Courts().FindByID(ctx, id)
+	if err != nil {
+		return nil, lookup(err, "Court not found")
+	}
+	return court, nil
+}
+
+func (s *CourtService) Create(ctx context.Context, userID string, court *models.BadmintonCourt) error {
+	if err := authorize(ctx, s.store, userID, policy.Create, &policy.Court{}, courtForbidden); err != nil {
+		return err
+	}
+	return s.store.Courts().Create(ctx, court)
+}
+
+// Update changes a court at a version the precondition holds for, and returns it along with the court as it was before
+func (s *CourtService) Update(ctx context.Context, userID string, id string, precondition Precondition, changes CourtChanges) (*models.BadmintonCourt, models.BadmintonCourt, error) {
+	court, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, models.BadmintonCourt{}, err
+	}
+	before := *court
+
+	if err := authorize(ctx, s.store, userID, policy.Update, &policy.Court{}, courtForbidden); err != nil {
+		return nil, before, err
+	}
+	if err := checkVersion(precondition, court.Version, courtChanged); err != nil {
+		return nil, before, err
+	}
+
+	court.Name = changes.Name
+	court.Address = changes.Address
+	if changes.GoogleMapURL != nil {
+		court.GoogleMapURL = *changes.GoogleMapURL
+	}
+	court.EstimatePricePerHour = changes.EstimatePricePerHour
+	court.Contact = changes.Contact
+
+	if err := s.store.Courts().Update(ctx, court); err != nil {
+		return nil, before, stale(err, courtChanged)
+	}
+	return court, before, nil
+}
+
+// Delete deletes a court at a version the precondition holds for, and returns it
+func (s *CourtService) Delete(ctx context.Context, userID string, id string, precondition Precondition) (*models.BadmintonCourt, error) {
+	court, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorize(ctx, s.store, userID, policy.Delete, &policy.Court{}, courtForbidden); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(precondition, court.Version, courtChanged); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Courts().Delete(ctx, id); err != nil {
+		return nil, lookup(err, "Court not found")
+	}
+	return court, nil
+}
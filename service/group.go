@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+const groupChanged = "Group changed since it was fetched"
+
+// GroupService manages groups, their members and who owns them
+type GroupService struct {
+	store repository.Store
+}
+
+func NewGroupService(store repository.Store) *GroupService {
+	return &GroupService{store: store}
+}
+
+// Create creates a group owned by the user, who becomes its first member
+func (s *GroupService) Create(ctx context.Context, userID string, request dto.NewGroupRequest) (*models.Group, error) {
+	group := models.Group{
+		OwnerID:    userID,
+		Name:       request.Name,
+		ImageUrl:   request.ImageUrl,
+		Remark:     request.Remark,
+		Visibility: request.Visibility,
+	}
+
+	if err := s.store.Atomic(ctx, func(store repository.Store) error {
+		if err := store.Groups().Create(ctx, &group); err != nil {
+			return err
+		}
+
+		return store.Groups().AddMember(ctx, &models.GroupMember{
+			GroupID: group.ID,
+			UserID:  group.OwnerID,
+			Role:    models.GroupRoleOwner,
+		})
+	}); err != nil {
+		return nil, apperror.Internal("Failed to create group", err)
+	}
+	return &group, nil
+}
+
+// Get returns a group with its members, groups are only visible to their members
+func (s *GroupService) Get(ctx context.Context, userID string, id string) (*models.Group, error) {
+	group, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeGroup(ctx, s.store, group, userID, policy.View, "You are not a member of this group"); err != nil {
+		return nil, err
+	}
+
+	group, err = s.store.Groups().FindWithMembers(ctx, id)
+	if err != nil {
+		return nil, lookup(err, "Group not found")
+	}
+	return group, nil
+}
+
+// List returns a page of the groups of a user with their members, and their total. Admins see every group.
+func (s *GroupService) List(ctx context.Context, userID string, offset int, limit int) ([]*models.Group, int64, error) {
+	isAdmin, err := s.store.Users().IsAdmin(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	memberID := userID
+	if isAdmin {
+		memberID = ""
+	}
+
+	groups, total, err := s.store.Groups().List(ctx, memberID, offset, limit)
+	if err != nil {
+		return nil, 0, apperror.Internal("Failed to fetch groups", err)
+	}
+	return groups, total, nil
+}
+
+// Update changes a group at a version the precondition holds for, and returns it along with the group as it was before
+func (s *GroupService) Update(ctx context.Context, userID string, id string, precondition Precondition, request dto.UpdateGroupRequest) (*models.Group, models.Group, error) {
+	group, err := s.find(ctx, id)
+	if err != nil {
+		return nil, models.Group{}, err
+	}
+	before := *group
+
+	if err := authorizeGroup(ctx, s.store, group, userID, policy.Update, "You do not have permission to update this group"); err != nil {
+		return nil, before, err
+	}
+	if err := checkVersion(precondition, group.Version, groupChanged); err != nil {
+		return nil, before, err
+	}
+
+	group.Name = request.Name
+	group.ImageUrl = request.ImageUrl
+	group.Remark = request.Remark
+	if len(request.Visibility) > 0 {
+		group.Visibility = request.Visibility
+	}
+
+	if err := s.store.Groups().Update(ctx, group); err != nil {
+		return nil, before, stale(err, groupChanged)
+	}
+	return group, before, nil
+}
+
+// Delete deletes a group at a version the precondition holds for, and returns it
+func (s *GroupService) Delete(ctx context.Context, userID string, id string, precondition Precondition) (*models.Group, error) {
+	group, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeGroup(ctx, s.store, group, userID, policy.Delete, "You do not have permission to delete this group"); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(precondition, group.Version, groupChanged); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Groups().Delete(ctx, id); err != nil {
+		return nil, apperror.Internal("Failed to delete group", err)
+	}
+	return group, nil
+}
+
+// AddMember adds the user with an email to a group and returns their membership
+func (s *GroupService) AddMember(ctx context.Context, userID string, groupID string, email string) (*models.GroupMember, error) {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeGroup(ctx, s.store, group, userID, policy.AddMember, "Only group organizers can add players"); err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.Users().FindByEmail(ctx, email)
+	if err != nil {
+		return nil, lookup(err, "User not found")
+	}
+
+	role, err := s.store.Groups().MemberRole(ctx, groupID, user.ID)
+	if err != nil {
+		return nil, apperror.Internal("Failed to check group membership", err)
+	}
+	if len(role) > 0 {
+		return nil, apperror.BadRequest("User is already a member of the group")
+	}
+
+	member := models.GroupMember{
+		GroupID: groupID,
+		UserID:  user.ID,
+		Role:    models.GroupRoleMember,
+	}
+	if err := s.store.Groups().AddMember(ctx, &member); err != nil {
+		return nil, apperror.Internal("Failed to add player to group", err)
+	}
+	return &member, nil
+}
+
+// RemoveMember removes a member other than the owner from a group
+func (s *GroupService) RemoveMember(ctx context.Context, userID string, groupID string, memberID string) error {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeGroup(ctx, s.store, group, userID, policy.RemoveMember, "Only the group owner can remove members"); err != nil {
+		return err
+	}
+
+	if memberID == group.OwnerID {
+		return apperror.BadRequest("The group owner cannot be removed, transfer ownership first")
+	}
+
+	if err := s.removeMember(ctx, groupID, memberID); err != nil {
+		return lookup(err, "User is not a member of the group")
+	}
+	return nil
+}
+
+// Leave removes the user from a group, the owner has to transfer ownership first
+func (s *GroupService) Leave(ctx context.Context, userID string, groupID string) error {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	// The group would be left without an owner
+	if group.OwnerID == userID {
+		return apperror.BadRequest("The group owner cannot leave, transfer ownership first")
+	}
+
+	if err := s.removeMember(ctx, groupID, userID); err != nil {
+		return lookup(err, "You are not a member of the group")
+	}
+	return nil
+}
+
+// TransferOwnership hands a group over to one of its members, the previous owner stays on as a co-organizer.
+// It returns the group along with the group as it was before.
+func (s *GroupService) TransferOwnership(ctx context.Context, userID string, groupID string, newOwnerID string) (*models.Group, models.Group, error) {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return nil, models.Group{}, err
+	}
+	before := *group
+
+	if err := authorizeGroup(ctx, s.store, group, userID, policy.TransferOwnership, "Only the group owner can transfer ownership"); err != nil {
+		return nil, before, err
+	}
+
+	if newOwnerID == group.OwnerID {
+		return nil, before, apperror.BadRequest("User is already the group owner")
+	}
+
+	// The new owner must already be a member of the group
+	role, err := s.store.Groups().MemberRole(ctx, groupID, newOwnerID)
+	if err != nil {
+		return nil, before, apperror.Internal("Failed to check group membership", err)
+	}
+	if len(role) == 0 {
+		return nil, before, apperror.BadRequest("The new owner must be a member of the group")
+	}
+
+	group.OwnerID = newOwnerID
+	if err := s.store.Atomic(ctx, func(store repository.Store) error {
+		if err := store.Groups().Update(ctx, group); err != nil {
+			return stale(err, groupChanged)
+		}
+		if err := store.Groups().UpdateMemberRole(ctx, groupID, before.OwnerID, models.GroupRoleCoOrganizer); err != nil {
+			return err
+		}
+		return store.Groups().UpdateMemberRole(ctx, groupID, newOwnerID, models.GroupRoleOwner)
+	}); err != nil {
+		return nil, before, apperror.Wrap(err, "Failed to transfer ownership")
+	}
+	return group, before, nil
+}
+
+// UpdateMemberRole changes the role of a member other than the owner and returns their previous role.
+// Ownership changes hands through TransferOwnership.
+func (s *GroupService) UpdateMemberRole(ctx context.Context, userID string, groupID string, memberID string, role string) (string, error) {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := authorizeGroup(ctx, s.store, group, userID, policy.ManageMemberRoles, "Only the group owner can change member roles"); err != nil {
+		return "", err
+	}
+
+	if memberID == group.OwnerID {
+		return "", apperror.BadRequest("The group owner role can only be changed by transferring ownership")
+	}
+
+	previousRole, err := s.store.Groups().MemberRole(ctx, groupID, memberID)
+	if err != nil {
+		return "", apperror.Internal("Failed to check group membership", err)
+	}
+
+	if err := s.store.Groups().UpdateMemberRole(ctx, groupID, memberID, role); err != nil {
+		return "", lookup(err, "User is not a member of the group")
+	}
+	return previousRole, nil
+}
+
+func (s *GroupService) find(ctx context.Context, id string) (*models.Group, error) {
+	group, err := s.store.Groups().FindByID(ctx, id)
+	if err != nil {
+		return nil, lookup(err, "Group not found")
+	}
+	return group, nil
+}
+
+// removeMember removes a user from a group along with their attendance of the group's upcoming sessions,
+// so departing members do not keep holding slots they can no longer see
+func (s *GroupService) removeMember(ctx context.Context, groupID string, userID string) error {
+	return s.store.Atomic(ctx, func(store repository.Store) error {
+		if err := store.Groups().RemoveMember(ctx, groupID, userID); err != nil {
+			return err
+		}
+		return store.Sessions().RemoveGroupAttendances(ctx, groupID, userID, time.Now())
+	})
+}
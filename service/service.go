@@ -0,0 +1,117 @@
+// Package service holds the business rules of sessions, groups and courts, such as capacity, membership and ownership.
+// Services only reach the data through the repositories, so they run the same against the database and in memory.
+// Their failures are apperror errors, which handlers return as they are.
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+// Precondition tells whether a resource at a version may be changed, handlers take it from the If-Match header
+type Precondition func(version int64) bool
+
+// checkVersion fails when a resource at a version may not be changed, message names the resource
+func checkVersion(precondition Precondition, version int64, message string) error {
+	if !precondition(version) {
+		return apperror.PreconditionFailed(message)
+	}
+	return nil
+}
+
+// stale turns repository.ErrStale into the error of a failed precondition, as the resource changed since it was
+// checked. Other errors stay internal.
+func stale(err error, message string) error {
+	if errors.Is(err, repository.ErrStale) {
+		return apperror.PreconditionFailed(message)
+	}
+	return err
+}
+
+// lookup turns repository.ErrNotFound into a not found error with message, other errors stay internal
+func lookup(err error, message string) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound(message)
+	}
+	return err
+}
+
+// Allowed decides if a user may perform an action on a resource.
+// Admin status is only looked up when the decision depends on it, admins never have fewer rights.
+func Allowed(ctx context.Context, store repository.Store, userID string, action policy.Action, resource policy.Resource) (bool, error) {
+	if policy.Allowed(policy.Subject{UserID: userID}, action, resource) {
+		return true, nil
+	}
+
+	isAdmin, err := store.Users().IsAdmin(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return isAdmin && policy.Allowed(policy.Subject{UserID: userID, Admin: true}, action, resource), nil
+}
+
+// authorize fails with a forbidden error with message when the user may not perform the action
+func authorize(ctx context.Context, store repository.Store, userID string, action policy.Action, resource policy.Resource, message string) error {
+	ok, err := Allowed(ctx, store, userID, action, resource)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	if !ok {
+		return apperror.Forbidden(message)
+	}
+	return nil
+}
+
+// authorizeGroup fails when the user may not perform the action on a group
+func authorizeGroup(ctx context.Context, store repository.Store, group *models.Group, userID string, action policy.Action, message string) error {
+	resource, err := GroupResource(ctx, store, group.ID, group.OwnerID, userID)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	return authorize(ctx, store, userID, action, resource, message)
+}
+
+// authorizeSession fails when the user may not perform the action on a session
+func authorizeSession(ctx context.Context, store repository.Store, session *models.Session, userID string, action policy.Action, message string) error {
+	resource, err := SessionResource(ctx, store, session, userID)
+	if err != nil {
+		return apperror.Internal("Failed to check group membership", err)
+	}
+	return authorize(ctx, store, userID, action, resource, message)
+}
+
+// GroupResource loads what policy decisions about a group depend on for a user
+func GroupResource(ctx context.Context, store repository.Store, groupID string, ownerID string, userID string) (*policy.Group, error) {
+	role, err := store.Groups().MemberRole(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &policy.Group{OwnerID: ownerID, MemberRole: role}, nil
+}
+
+// LoadGroupResource loads a group and what policy decisions about it depend on for a user.
+// Deleted groups are included, as their sessions and announcements are still decided by them.
+func LoadGroupResource(ctx context.Context, store repository.Store, groupID string, userID string) (*policy.Group, error) {
+	group, err := store.Groups().FindIncludingDeleted(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return GroupResource(ctx, store, group.ID, group.OwnerID, userID)
+}
+
+// SessionResource loads what policy decisions about a session depend on for a user
+func SessionResource(ctx context.Context, store repository.Store, session *models.Session, userID string) (*policy.Session, error) {
+	resource := &policy.Session{CreatedBy: session.CreatedBy}
+	if session.GroupID == nil {
+		return resource, nil
+	}
+
+	var err error
+	resource.Group, err = LoadGroupResource(ctx, store, *session.GroupID, userID)
+	return resource, err
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/policy"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+const (
+	sessionForbidden = "You are not the creator of this session"
+	sessionChanged   = "Session changed since it was fetched"
+)
+
+// SessionService manages sessions and who attends them
+type SessionService struct {
+	store repository.Store
+}
+
+func NewSessionService(store repository.Store) *SessionService {
+	return &SessionService{store: store}
+}
+
+// Create creates an open session, group sessions can only be created by the members of the group
+func (s *SessionService) Create(ctx context.Context, userID string, request dto.NewSessionRequest) (*models.Session, error) {
+	session := models.Session{
+		CreatedBy:   userID,
+		Description: request.Description,
+		Status:      models.SessionStatusOpen,
+		MaxMembers:  request.MaxMembers,
+		DateTime:    request.DateTime,
+		Cost:        request.Cost,
+		CostSplit:   models.SessionCostSplitPool,
+	}
+	if len(request.CostSplit) > 0 {
+		session.CostSplit = request.CostSplit
+	}
+
+	if len(request.BadmintonCourtID) > 0 {
+		if _, err := s.store.Courts().FindByID(ctx, request.BadmintonCourtID); err != nil {
+			return nil, lookup(err, "Badminton Court not found")
+		}
+		session.BadmintonCourtID = &request.BadmintonCourtID
+	}
+
+	if len(request.GroupID) > 0 {
+		group, err := s.store.Groups().FindByID(ctx, request.GroupID)
+		if err != nil {
+			return nil, lookup(err, "Group not found")
+		}
+
+		if err := authorizeGroup(ctx, s.store, group, userID, policy.CreateSession, "Only group members can create sessions for the group"); err != nil {
+			return nil, err
+		}
+		session.GroupID = &group.ID
+	}
+
+	if err := s.store.Sessions().Create(ctx, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Get returns a session with its group, court and attendees, group sessions are only visible to the group
+func (s *SessionService) Get(ctx context.Context, userID string, id string) (*models.Session, error) {
+	session, err := s.store.Sessions().FindWithDetails(ctx, id)
+	if err != nil {
+		return nil, lookup(err, "Session not found")
+	}
+
+	if err := authorizeSession(ctx, s.store, session, userID, policy.View, "You must be a member of the group to view this session"); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// List returns a page of the upcoming sessions visible to a user and their total.
+// Admins see every session, other users the public sessions and those of their groups.
+func (s *SessionService) List(ctx context.Context, userID string, offset int, limit int) ([]*models.Session, int64, error) {
+	isAdmin, err := s.store.Users().IsAdmin(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := repository.SessionFilter{After: time.Now()}
+	if !isAdmin {
+		filter.VisibleTo = userID
+	}
+	return s.store.Sessions().List(ctx, filter, offset, limit)
+}
+
+// Update changes the fields of an open session set by the request at a version the precondition holds for,
+// and returns it along with the session as it was before
+func (s *SessionService) Update(ctx context.Context, userID string, id string, precondition Precondition, request dto.UpdateSessionRequest) (*models.Session, models.Session, error) {
+	session, err := s.store.Sessions().FindByID(ctx, id)
+	if err != nil {
+		return nil, models.Session{}, lookup(err, "Session not found")
+	}
+	before := *session
+
+	if session.Status != models.SessionStatusOpen {
+		return nil, before, apperror.BadRequest("Session is not open for update")
+	}
+
+	if err := authorizeSession(ctx, s.store, session, userID, policy.Update, sessionForbidden); err != nil {
+		return nil, before, err
+	}
+	if err := checkVersion(precondition, session.Version, sessionChanged); err != nil {
+		return nil, before, err
+	}
+
+	if request.DateTime != nil {
+		session.DateTime = request.DateTime
+	}
+
+	if request.BadmintonCourtID != nil {
+		if len(*request.BadmintonCourtID) == 0 {
+			session.BadmintonCourtID = nil
+		} else if session.BadmintonCourtID == nil || *session.BadmintonCourtID != *request.BadmintonCourtID {
+			if _, err := s.store.Courts().FindByID(ctx, *request.BadmintonCourtID); err != nil {
+				return nil, before, lookup(err, "Badminton Court not found")
+			}
+			courtID := *request.BadmintonCourtID
+			session.BadmintonCourtID = &courtID
+		}
+	}
+
+	if request.Cost != nil {
+		session.Cost = *request.Cost
+	}
+	if len(request.CostSplit) > 0 {
+		session.CostSplit = request.CostSplit
+	}
+
+	if request.Description != nil {
+		session.Description = *request.Description
+	}
+
+	// Attendees already approved keep their slots. Those joining meanwhile move the session to its next version,
+	// so the update fails rather than going below their slots.
+	if request.MaxMembers != nil {
+		slots, err := s.store.Sessions().ApprovedSlots(ctx, session.ID)
+		if err != nil {
+			return nil, before, apperror.Internal("Failed to calculate total slots", err)
+		}
+		if *request.MaxMembers < slots {
+			return nil, before, apperror.BadRequest(fmt.Sprintf("Max members cannot be lower than the %v slots taken", slots))
+		}
+		session.MaxMembers = *request.MaxMembers
+	}
+
+	if err := s.store.Sessions().Update(ctx, session); err != nil {
+		return nil, before, stale(err, sessionChanged)
+	}
+	return session, before, nil
+}
+
+// Delete deletes a session at a version the precondition holds for, and returns it
+func (s *SessionService) Delete(ctx context.Context, userID string, id string, precondition Precondition) (*models.Session, error) {
+	session, err := s.store.Sessions().FindByID(ctx, id)
+	if err != nil {
+		return nil, lookup(err, "Session not found")
+	}
+
+	if err := authorizeSession(ctx, s.store, session, userID, policy.Delete, sessionForbidden); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(precondition, session.Version, sessionChanged); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Sessions().Delete(ctx, id); err != nil {
+		return nil, lookup(err, "Session not found")
+	}
+	return session, nil
+}
+
+// UpdateStatus moves a session at a version the precondition holds for to another status, and returns it along with
+// the session as it was before. Completed group sessions are paid for out of the group wallet.
+func (s *SessionService) UpdateStatus(ctx context.Context, userID string, id string, precondition Precondition, status string) (*models.Session, models.Session, error) {
+	var session *models.Session
+	var before models.Session
+
+	err := s.store.Atomic(ctx, func(store repository.Store) error {
+		var err error
+		session, err = store.Sessions().FindByID(ctx, id)
+		if err != nil {
+			return lookup(err, "Session not found")
+		}
+		before = *session
+
+		if session.Status == status {
+			return apperror.BadRequest("Session status is already " + status)
+		}
+		if err := checkVersion(precondition, session.Version, sessionChanged); err != nil {
+			return err
+		}
+
+		session.Status = status
+		if err := store.Sessions().Update(ctx, session); err != nil {
+			return stale(err, sessionChanged)
+		}
+
+		if status == models.SessionStatusCompleted {
+			return debitCompletedSession(ctx, store, session, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, before, err
+	}
+	return session, before, nil
+}
+
+// Attend adds a user to an open session with a number of slots, as long as the session has room for them.
+// The session is locked while its slots are counted, so concurrent attendees never take more than it has.
+func (s *SessionService) Attend(ctx context.Context, userID string, sessionID string, slot int) error {
+	return s.store.Atomic(ctx, func(store repository.Store) error {
+		session, err := store.Sessions().FindForUpdate(ctx, sessionID)
+		if err != nil {
+			return lookup(err, "Session not found")
+		}
+
+		if !session.CanAttend() {
+			return apperror.BadRequest("Session is not open for attendance")
+		}
+
+		// Only group members or admins can attend group sessions
+		if err := authorizeSession(ctx, store, session, userID, policy.Attend, "Only group members can attend this session"); err != nil {
+			return err
+		}
+
+		_, err = store.Sessions().FindAttendee(ctx, sessionID, userID)
+		if err == nil {
+			return apperror.BadRequest("User is already attending this session")
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		if err := checkCapacity(ctx, store, session, slot); err != nil {
+			return err
+		}
+
+		attendee := models.SessionAttendee{
+			SessionID: sessionID,
+			UserID:    userID,
+			Status:    models.ApprovalStatusApproved,
+			Slot:      slot,
+		}
+		if err := store.Sessions().AddAttendee(ctx, &attendee); err != nil {
+			return apperror.Internal("Failed to attend session", err)
+		}
+		return nil
+	})
+}
+
+// CancelAttendance removes a user from a session
+func (s *SessionService) CancelAttendance(ctx context.Context, userID string, sessionID string) error {
+	if err := s.store.Sessions().RemoveAttendee(ctx, sessionID, userID); err != nil {
+		return lookup(err, "Attendance record not found")
+	}
+	return nil
+}
+
+// UpdateAttendeeStatus approves or rejects an attendee and returns them along with the attendee as they were before.
+// Approving must not take more slots than the session has.
+func (s *SessionService) UpdateAttendeeStatus(ctx context.Context, userID string, sessionID string, attendeeID string, status models.ApprovalStatus, remark *string) (*models.SessionAttendee, models.SessionAttendee, error) {
+	var attendee *models.SessionAttendee
+	var before models.SessionAttendee
+
+	session, err := s.store.Sessions().FindByID(ctx, sessionID)
+	if err != nil {
+		return nil, before, lookup(err, "Session not found")
+	}
+
+	if err := authorizeSession(ctx, s.store, session, userID, policy.ManageAttendees, "Only session organizers can approve attendees"); err != nil {
+		return nil, before, err
+	}
+
+	err = s.store.Atomic(ctx, func(store repository.Store) error {
+		// Locked like in Attend, and read again as its max members may have changed since it was authorized
+		session, err := store.Sessions().FindForUpdate(ctx, sessionID)
+		if err != nil {
+			return lookup(err, "Session not found")
+		}
+
+		attendee, err = store.Sessions().FindAttendee(ctx, sessionID, attendeeID)
+		if err != nil {
+			return lookup(err, "Attendance record not found")
+		}
+		before = *attendee
+
+		if status == models.ApprovalStatusApproved && attendee.Status != models.ApprovalStatusApproved {
+			if err := checkCapacity(ctx, store, session, attendee.Slot); err != nil {
+				return err
+			}
+		}
+
+		attendee.Status = status
+		if remark != nil {
+			attendee.Remark = *remark
+		}
+		return store.Sessions().UpdateAttendee(ctx, attendee)
+	})
+	if err != nil {
+		return nil, before, err
+	}
+	return attendee, before, nil
+}
+
+// checkCapacity fails when approving more slots would exceed the members of a session
+func checkCapacity(ctx context.Context, store repository.Store, session *models.Session, slot int) error {
+	slots, err := store.Sessions().ApprovedSlots(ctx, session.ID)
+	if err != nil {
+		return apperror.Internal("Failed to calculate total slots", err)
+	}
+
+	if slots+slot > session.MaxMembers {
+		return apperror.New(http.StatusBadRequest, apperror.CodeSessionFull, fmt.Sprintf("Session is full: max members is %v", session.MaxMembers))
+	}
+	return nil
+}
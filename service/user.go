@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/models/dto"
+	"github.com/alanrb/badminton/backend/repository"
+)
+
+const userChanged = "User changed since it was fetched"
+
+// UserService manages users and the roles they hold, which only admins may change
+type UserService struct {
+	store repository.Store
+}
+
+func NewUserService(store repository.Store) *UserService {
+	return &UserService{store: store}
+}
+
+// UserProfile is a user with the names of their roles, highest priority first, and of the permissions they grant
+type UserProfile struct {
+	User        *models.User
+	Roles       []string
+	Permissions []string
+}
+
+// UserChanges are the fields of a user that can be updated, the avatar is kept when nil and the roles when empty
+type UserChanges struct {
+	AvatarURL *string
+	Roles     []string
+}
+
+// Create creates a user, who is linked to their account on first login
+func (s *UserService) Create(ctx context.Context, request dto.NewUserRequest) (*models.User, error) {
+	user := models.User{
+		Name:      request.Name,
+		Email:     request.Email,
+		AvatarURL: request.AvatarURL,
+	}
+	if err := s.store.Users().Create(ctx, &user); err != nil {
+		return nil, apperror.Internal("Failed to create user", err)
+	}
+	return &user, nil
+}
+
+// List returns a page of users with their roles, and their total
+func (s *UserService) List(ctx context.Context, offset int, limit int) ([]*models.User, int64, error) {
+	users, total, err := s.store.Users().List(ctx, offset, limit)
+	if err != nil {
+		return nil, 0, apperror.Internal("Failed to fetch users", err)
+	}
+	return users, total, nil
+}
+
+// Get returns a user with their roles
+func (s *UserService) Get(ctx context.Context, id string) (*models.User, error) {
+	user, err := s.store.Users().FindByID(ctx, id)
+	if err != nil {
+		return nil, lookup(err, "User not found")
+	}
+	return user, nil
+}
+
+// Profile returns a user along with their roles and permissions
+func (s *UserService) Profile(ctx context.Context, id string) (*UserProfile, error) {
+	user, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.store.Users().Permissions(ctx, id)
+	if err != nil {
+		return nil, apperror.Internal("Failed to fetch permissions", err)
+	}
+
+	roles := slices.Clone(user.Roles)
+	slices.SortStableFunc(roles, func(a, b *models.Role) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+
+	return &UserProfile{User: user, Roles: names, Permissions: permissions}, nil
+}
+
+// Update changes a user, and returns them along with the user as they were before. Only admins can change roles, and
+// the access tokens carrying the previous roles are refused.
+func (s *UserService) Update(ctx context.Context, userID string, id string, changes UserChanges) (*models.User, models.User, error) {
+	var user *models.User
+	var before models.User
+
+	var roles []*models.Role
+	if len(changes.Roles) > 0 {
+		isAdmin, err := s.store.Users().IsAdmin(ctx, userID)
+		if err != nil {
+			return nil, before, apperror.Internal("Failed to check permissions", err)
+		}
+		if !isAdmin {
+			return nil, before, apperror.Forbidden("Only admins can update user roles")
+		}
+
+		for _, name := range changes.Roles {
+			role, err := s.store.Users().FindRole(ctx, name)
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, before, apperror.BadRequest("Invalid role: " + name)
+			}
+			if err != nil {
+				return nil, before, apperror.Internal("Failed to fetch roles", err)
+			}
+			roles = append(roles, role)
+		}
+	}
+
+	err := s.store.Atomic(ctx, func(store repository.Store) error {
+		var err error
+		user, err = store.Users().FindByID(ctx, id)
+		if err != nil {
+			return lookup(err, "User not found")
+		}
+		before = *user
+
+		if changes.AvatarURL != nil {
+			user.AvatarURL = *changes.AvatarURL
+		}
+		if err := store.Users().Update(ctx, user); err != nil {
+			return stale(err, userChanged)
+		}
+
+		if len(roles) > 0 {
+			if err := store.Users().ReplaceRoles(ctx, user.ID, roles); err != nil {
+				return lookup(err, "Role not found")
+			}
+			user.Roles = roles
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, before, err
+	}
+	return user, before, nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+
+	"github.com/alanrb/badminton/backend/models"
+	"github.com/alanrb/badminton/backend/repository"
+	"github.com/shopspring/decimal"
+)
+
+// debitCompletedSession pays for a completed group session out of the group wallet.
+// The pool always pays the court; with the attendees split each approved attendee is also
+// charged their share by slot. Sessions are only ever debited once.
+func debitCompletedSession(ctx context.Context, store repository.Store, session *models.Session, actorID string) error {
+	if session.GroupID == nil || !session.Cost.IsPositive() {
+		return nil
+	}
+
+	debited, err := store.Wallets().SessionDebited(ctx, session.ID)
+	if err != nil || debited {
+		return err
+	}
+
+	wallet, err := store.Wallets().Lock(ctx, *session.GroupID)
+	if err != nil {
+		return err
+	}
+
+	wallet.Balance = wallet.Balance.Sub(session.Cost)
+	if err := store.Wallets().UpdateBalance(ctx, wallet); err != nil {
+		return err
+	}
+
+	if err := store.Wallets().AddTransaction(ctx, &models.WalletTransaction{
+		GroupID:     wallet.GroupID,
+		SessionID:   &session.ID,
+		Type:        models.WalletTransactionSessionDebit,
+		Amount:      session.Cost.Neg(),
+		PoolBalance: wallet.Balance,
+		Note:        session.Description,
+		CreatedBy:   actorID,
+	}); err != nil {
+		return err
+	}
+
+	if session.CostSplit != models.SessionCostSplitAttendees {
+		return nil
+	}
+
+	attendees, err := store.Sessions().ApprovedAttendees(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+
+	for i, share := range splitCost(session.Cost, attendees) {
+		memberBalance, err := store.Wallets().AdjustMemberBalance(ctx, wallet.GroupID, attendees[i].UserID, share.Neg())
+		if err != nil {
+			return err
+		}
+
+		if err := store.Wallets().AddTransaction(ctx, &models.WalletTransaction{
+			GroupID:       wallet.GroupID,
+			UserID:        &attendees[i].UserID,
+			SessionID:     &session.ID,
+			Type:          models.WalletTransactionMemberCharge,
+			Amount:        share.Neg(),
+			PoolBalance:   wallet.Balance,
+			MemberBalance: &memberBalance,
+			Note:          session.Description,
+			CreatedBy:     actorID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitCost divides a cost between attendees by slot, rounded to cents.
+// The last attendee takes the rounding remainder so the shares add up to the cost.
+func splitCost(cost decimal.Decimal, attendees []*models.SessionAttendee) []decimal.Decimal {
+	var totalSlots int64
+	for _, attendee := range attendees {
+		totalSlots += int64(attendee.Slot)
+	}
+	if totalSlots == 0 {
+		return nil
+	}
+
+	shares := make([]decimal.Decimal, len(attendees))
+	remaining := cost
+	for i, attendee := range attendees {
+		if i == len(attendees)-1 {
+			shares[i] = remaining
+			break
+		}
+		shares[i] = cost.Mul(decimal.NewFromInt(int64(attendee.Slot))).Div(decimal.NewFromInt(totalSlots)).Round(2)
+		remaining = remaining.Sub(shares[i])
+	}
+	return shares
+}
@@ -0,0 +1,130 @@
+// Package validate checks the requests of the API. Request types declare their rules in a Validate method built
+// with Errors, which Echo's Validator runs once the request is bound, so the same rules hold in every handler.
+package validate
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alanrb/badminton/backend/apperror"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Validatable is a request that checks its own fields
+type Validatable interface {
+	Validate() error
+}
+
+// Validator is the Validator of Echo, requests without rules are always valid
+type Validator struct{}
+
+func (Validator) Validate(i interface{}) error {
+	if v, ok := i.(Validatable); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// Errors collects the invalid fields of a request, each check only reports a field once
+type Errors struct {
+	fields []apperror.FieldError
+}
+
+// Err is a validation error summed up by the first invalid field, or nil when every field is valid
+func (e *Errors) Err() error {
+	if len(e.fields) == 0 {
+		return nil
+	}
+	return apperror.Validation(e.fields[0].Message, e.fields...)
+}
+
+// Check reports the field with message unless ok
+func (e *Errors) Check(ok bool, field string, message string) {
+	if ok {
+		return
+	}
+	for _, f := range e.fields {
+		if f.Field == field {
+			return
+		}
+	}
+	e.fields = append(e.fields, apperror.FieldError{Field: field, Message: message})
+}
+
+// Required checks the value is not blank
+func (e *Errors) Required(field string, value string, message string) {
+	e.Check(len(strings.TrimSpace(value)) > 0, field, message)
+}
+
+// MaxLength checks the value has at most max characters
+func (e *Errors) MaxLength(field string, value string, max int, message string) {
+	e.Check(utf8.RuneCountInString(value) <= max, field, message)
+}
+
+// UUID checks the value is a UUID, empty values are left to Required
+func (e *Errors) UUID(field string, value string, message string) {
+	e.Check(len(value) == 0 || uuid.Validate(value) == nil, field, message)
+}
+
+// UUIDs checks every value is a UUID
+func (e *Errors) UUIDs(field string, values []string, message string) {
+	for _, value := range values {
+		e.Check(uuid.Validate(value) == nil, field, message)
+	}
+}
+
+// Range checks min <= value <= max
+func (e *Errors) Range(field string, value int, min int, max int, message string) {
+	e.Check(value >= min && value <= max, field, message)
+}
+
+// NotNegative checks the amount is zero or more
+func (e *Errors) NotNegative(field string, value decimal.Decimal, message string) {
+	e.Check(!value.IsNegative(), field, message)
+}
+
+// Positive checks the amount is more than zero
+func (e *Errors) Positive(field string, value decimal.Decimal, message string) {
+	e.Check(value.IsPositive(), field, message)
+}
+
+// URL checks the value is an absolute http or https URL, empty values are left to Required
+func (e *Errors) URL(field string, value string, message string) {
+	if len(value) == 0 {
+		return
+	}
+	u, err := url.ParseRequestURI(value)
+	e.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0, field, message)
+}
+
+// emailPattern is a basic email check, it does not cover every address the RFCs allow
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// Email checks the value is an email address, empty values are left to Required
+func (e *Errors) Email(field string, value string, message string) {
+	e.Check(len(value) == 0 || emailPattern.MatchString(value), field, message)
+}
+
+// OneOf checks the value is one of the allowed values
+func (e *Errors) OneOf(field string, value string, allowed []string, message string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	e.Check(false, field, message)
+}
+
+// Within checks the time is in the future, and no further than max from now when max is set.
+// Missing times are left to the caller.
+func (e *Errors) Within(field string, value *time.Time, max time.Duration, message string) {
+	if value == nil {
+		return
+	}
+	now := time.Now()
+	e.Check(value.After(now) && (max == 0 || value.Before(now.Add(max))), field, message)
+}
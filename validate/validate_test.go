@@ -0,0 +1,69 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alanrb/badminton/backend/apperror"
+)
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	if err := errs.Err(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	errs.Required("name", " ", "Invalid name")
+	errs.MaxLength("name", "a very long name", 5, "Name is too long")
+	errs.UUID("group_id", "", "Invalid group ID")
+	errs.URL("image_url", "not a url", "Invalid image URL")
+	errs.Email("email", "player@example.com", "Email is invalid")
+	errs.OneOf("status", "pending", []string{"approved", "rejected"}, "Invalid status")
+	errs.Within("date_time", &past, 0, "Invalid DateTime")
+
+	var appErr *apperror.Error
+	if !errors.As(errs.Err(), &appErr) {
+		t.Fatalf("expected an application error, got %v", errs.Err())
+	}
+	if appErr.Code != apperror.CodeValidation || appErr.Message != "Invalid name" {
+		t.Errorf("expected the first field to sum up the error, got %s %q", appErr.Code, appErr.Message)
+	}
+
+	expected := []apperror.FieldError{
+		{Field: "name", Message: "Invalid name"},
+		{Field: "image_url", Message: "Invalid image URL"},
+		{Field: "status", Message: "Invalid status"},
+		{Field: "date_time", Message: "Invalid DateTime"},
+	}
+	if len(appErr.Fields) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, appErr.Fields)
+	}
+	for i, field := range expected {
+		if appErr.Fields[i] != field {
+			t.Errorf("expected %v, got %v", field, appErr.Fields[i])
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		value time.Duration
+		valid bool
+	}{
+		{"tomorrow", 24 * time.Hour, true},
+		{"an hour ago", -time.Hour, false},
+		{"too far ahead", 48 * time.Hour, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var errs Errors
+			value := time.Now().Add(test.value)
+			errs.Within("date_time", &value, 36*time.Hour, "Invalid DateTime")
+			if valid := errs.Err() == nil; valid != test.valid {
+				t.Errorf("expected valid to be %v", test.valid)
+			}
+		})
+	}
+}